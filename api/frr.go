@@ -0,0 +1,35 @@
+package api
+
+// Frr configures the routing protocols FRR runs in a container node,
+// the configuration is rendered from the links of the node
+type Frr struct {
+	RouterID string `yaml:"routerId,omitempty"` // derived from the Uid if empty
+	Ospf     *Ospf  `yaml:"ospf,omitempty"`
+	Bgp      *Bgp   `yaml:"bgp,omitempty"`
+	Isis     *Isis  `yaml:"isis,omitempty"`
+}
+
+// Ospf runs OSPFv2 on the veth of the node, neighbours are the linked
+// nodes running OSPF in the same area
+type Ospf struct {
+	Area          string `yaml:"area,omitempty"`          // dotted or decimal, 0.0.0.0 if empty
+	Cost          uint32 `yaml:"cost,omitempty"`          // of the interface, FRR derives it from the bandwidth if 0
+	HelloInterval uint32 `yaml:"helloInterval,omitempty"` // seconds, 10 if 0
+	DeadInterval  uint32 `yaml:"deadInterval,omitempty"`  // seconds, 4 hello intervals if 0
+}
+
+// Bgp runs BGP with the address of the node as the advertised network
+type Bgp struct {
+	Asn       uint32   `yaml:"asn"`
+	Neighbors []string `yaml:"neighbors,omitempty"` // nodes running BGP, the linked ones if empty
+	Networks  []string `yaml:"networks,omitempty"`  // advertised prefixes, the /32 of the node if empty
+	Keepalive uint32   `yaml:"keepalive,omitempty"` // seconds, 60 if 0
+	HoldTime  uint32   `yaml:"holdTime,omitempty"`  // seconds, 3 keepalives if 0
+}
+
+// Isis runs IS-IS level 2 on the veth of the node
+type Isis struct {
+	Area          string `yaml:"area,omitempty"`          // area address of the NET, 49.0001 if empty
+	Metric        uint32 `yaml:"metric,omitempty"`        // of the interface, 10 if 0
+	HelloInterval uint32 `yaml:"helloInterval,omitempty"` // seconds, 3 if 0
+}
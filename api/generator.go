@@ -0,0 +1,34 @@
+package api
+
+// Generator describes a parametric topology that is expanded into
+// nodes and links before the topology is applied
+type Generator struct {
+	Type   string `yaml:"type"`             // fattree, leafspine, ring, grid, torus, star, mesh, erdos-renyi, barabasi-albert
+	Prefix string `yaml:"prefix,omitempty"` // prepended to every generated node name
+	Image  string `yaml:"image,omitempty"`
+	Subnet string `yaml:"subnet,omitempty"` // CIDR to number the nodes from, automatic addresses if empty
+	Frr    *Frr   `yaml:"frr,omitempty"`    // routing protocols of every generated node
+
+	K            int     `yaml:"k,omitempty"`            // fattree: arity, must be even
+	Nodes        int     `yaml:"nodes,omitempty"`        // ring, star (leaves), mesh, erdos-renyi, barabasi-albert
+	Spines       int     `yaml:"spines,omitempty"`       // leafspine
+	Leaves       int     `yaml:"leaves,omitempty"`       // leafspine
+	HostsPerLeaf int     `yaml:"hostsPerLeaf,omitempty"` // leafspine
+	Dims         []int   `yaml:"dims,omitempty"`         // grid, torus: 2 or 3 dimensions
+	P            float64 `yaml:"p,omitempty"`            // erdos-renyi: edge probability
+	M            int     `yaml:"m,omitempty"`            // barabasi-albert: edges per new node
+	Seed         int64   `yaml:"seed,omitempty"`         // random graphs and distributions
+
+	Properties          LinkProperties            `yaml:"properties,omitempty"`          // applied to every link
+	Tiers               map[string]LinkProperties `yaml:"tiers,omitempty"`               // per tier overrides, e.g. core/aggregation/edge, spine/leaf
+	LatencyDistribution *Distribution             `yaml:"latencyDistribution,omitempty"` // sampled per link, overrides latency
+}
+
+// Distribution is a random distribution in ms
+type Distribution struct {
+	Type   string  `yaml:"type"` // constant, uniform or normal
+	Min    float64 `yaml:"min,omitempty"`
+	Max    float64 `yaml:"max,omitempty"`
+	Mean   float64 `yaml:"mean,omitempty"`
+	Stddev float64 `yaml:"stddev,omitempty"`
+}
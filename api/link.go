@@ -1,23 +1,24 @@
 package api
 
 type Link struct {
-	Uid            int32
+	Uid            int32          `yaml:"-"`
 	SrcNode        string         `yaml:"srcNode"` // SrcNodeName
 	DstNode        string         `yaml:"dstNode"` // DstNodeName
-	Properties     LinkProperties `yaml:"properties"`
-	UniDirectional bool           `yaml:"uniDirectional" default:"false"`
+	Properties     LinkProperties `yaml:"properties,omitempty"`
+	UniDirectional bool           `yaml:"uniDirectional,omitempty" default:"false"`
 
-	SrcIntf NodeInterface
-	DstIntf NodeInterface
+	SrcIntf NodeInterface `yaml:"-"`
+	DstIntf NodeInterface `yaml:"-"`
 
-	IsPhysicalVirtual bool
+	IsPhysicalVirtual bool `yaml:"-"`
 }
 
 type LinkProperties struct {
-	Latency       uint32  `yaml:"latency"` // in ms
-	Loss          float32 `yaml:"loss"`    // in percentage
-	Rate          uint64  `yaml:"rate"`    // in mbps
-	HTBClassid    uint32  // netlink.Makehandle(1, 1)
-	DstIP         string  // for filtering (192.168.1.1)
-	NetemHandleId uint32
+	Latency       uint32  `yaml:"latency,omitempty"` // in ms
+	Loss          float32 `yaml:"loss,omitempty"`    // in percentage
+	Rate          uint64  `yaml:"rate,omitempty"`    // in mbps
+	HTBClassid    uint32  `yaml:"-"`                 // netlink.Makehandle(1, 1)
+	DstIP         string  `yaml:"-"`                 // address of the destination (192.168.1.1)
+	DstMac        string  `yaml:"-"`                 // for filtering, see node.Mac (02:4e:4c:00:00:01)
+	NetemHandleId uint32  `yaml:"-"`
 }
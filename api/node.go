@@ -1,24 +1,64 @@
 package api
 
+// node kinds
+const (
+	KindContainer = "container" // docker container, the default
+	KindNetns     = "netns"     // bare named network namespace
+	KindHost      = "host"      // interface in the host namespace
+	KindNat       = "nat"       // namespace masquerading traffic out of a host interface
+)
+
+// image pull policies
+const (
+	PullAlways       = "Always"       // pull before every apply
+	PullIfNotPresent = "IfNotPresent" // pull or load missing images, the default
+	PullNever        = "Never"        // fail if the image is missing
+)
+
 type Node struct {
-	Uid       int
-	Name      string        `yaml:"name"`
-	Interface NodeInterface `yaml:"interface"`
-	NetNs     string
-	IsNormal  bool
-	Image     string `yaml:"image"`
+	Uid       int               `yaml:"-"`
+	Name      string            `yaml:"name"`
+	Kind      string            `yaml:"kind,omitempty"` // KindContainer if empty
+	Interface NodeInterface     `yaml:"interface,omitempty"`
+	NetNs     string            `yaml:"-"`
+	IsNormal  bool              `yaml:"-"`
+	Image     string            `yaml:"image,omitempty"`
+	Labels    map[string]string `yaml:"labels,omitempty"`
+	Command   []string          `yaml:"command,omitempty"` // command of the container, process started in a netns node
+	Uplink    string            `yaml:"uplink,omitempty"`  // nat: host interface traffic leaves through
+	Gateway   string            `yaml:"gateway,omitempty"` // node the default route points to, e.g. a nat node
+	Frr       *Frr              `yaml:"frr,omitempty"`     // routing protocols, container nodes only
+
+	// container settings
+	Entrypoint      []string          `yaml:"entrypoint,omitempty"`
+	Env             map[string]string `yaml:"env,omitempty"`
+	Binds           []string          `yaml:"binds,omitempty"` // host-src:container-dest[:options]
+	Workdir         string            `yaml:"workdir,omitempty"`
+	Cpus            float64           `yaml:"cpus,omitempty"`            // number of CPUs, e.g. 0.5
+	Memory          string            `yaml:"memory,omitempty"`          // limit with unit suffix, e.g. 512m or 2g
+	Sysctls         map[string]string `yaml:"sysctls,omitempty"`         // in addition to ip forwarding
+	Capabilities    []string          `yaml:"capabilities,omitempty"`    // added capabilities, the container is privileged if nil
+	RestartPolicy   string            `yaml:"restartPolicy,omitempty"`   // no, always, unless-stopped, on-failure[:max-retries]
+	ImagePullPolicy string            `yaml:"imagePullPolicy,omitempty"` // PullIfNotPresent if empty
+	ImageArchive    string            `yaml:"imageArchive,omitempty"`    // tarball loaded with docker load instead of pulling
+
+	ContainerID string `yaml:"-"`
+	Pid         int    `yaml:"-"`
 
-	Rules map[string]LinkProperties // len(Rules) will never decrease, used for classid, map dst --> properties
+	Rules   map[string]LinkProperties `yaml:"-"` // len(Rules) will never decrease, used for classid, map dst --> properties
+	Routes  []Route                   `yaml:"-"` // installed by the static routing mode, ordered by Dst
+	FrrConf string                    `yaml:"-"` // frr.conf last written to the container
 }
 
 type NodeInterface struct {
-	Uid      int32
-	Name     string
-	Mac      string
-	Ipv4     string `yaml:"ipv4"`
-	Ipv6     string
-	NetNs    string
-	Class    string
-	NodeName string
-	BrName   string
+	Uid      int32  `yaml:"-"`
+	Name     string `yaml:"-"`
+	Mac      string `yaml:"-"`
+	Ipv4     string `yaml:"ipv4,omitempty"`
+	Ipv6     string `yaml:"-"`
+	NetNs    string `yaml:"-"`
+	Class    string `yaml:"-"`
+	NodeName string `yaml:"-"`
+	BrName   string `yaml:"-"`
+	OvsPort  int    `yaml:"-"` // ofport of the OVS side veth
 }
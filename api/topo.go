@@ -1,6 +1,37 @@
 package api
 
 type TopoConfig struct {
-	Nodes []Node `yaml:"nodes"`
-	Links []Link `yaml:"links"`
+	Nodes      []Node      `yaml:"nodes,omitempty"`
+	Links      []Link      `yaml:"links,omitempty"`
+	Generators []Generator `yaml:"generators,omitempty"`
+	Routing    *Routing    `yaml:"routing,omitempty"` // the running mode is kept if nil
+}
+
+// routing modes
+const (
+	RoutingNone   = "none"   // only neighbours reach each other, the default
+	RoutingStatic = "static" // routes along the shortest paths in every node
+)
+
+// metrics of the shortest paths
+const (
+	MetricLatency = "latency" // sum of the configured latencies, the default
+	MetricHops    = "hops"    // number of links
+)
+
+// Routing selects how nodes reach the nodes they have no link to
+type Routing struct {
+	Mode   string `yaml:"mode,omitempty"`   // RoutingNone if empty
+	Metric string `yaml:"metric,omitempty"` // MetricLatency if empty
+}
+
+// Route forwards the packets of a node to Dst through its neighbour Via,
+// installed by the static routing mode
+type Route struct {
+	Dst        string // destination node
+	DstIP      string
+	Via        string // next hop on the shortest path
+	ViaIP      string
+	Cost       uint64 // of the path by the metric, ms or hops
+	HTBClassid uint32 // class of the link to Via, 0 if it is not shaped
 }
@@ -1,26 +1,73 @@
 package cmd
 
 import (
+	"Netlink/pkg"
+	"Netlink/pkg/validate"
+	"errors"
+	"fmt"
 	"github.com/spf13/cobra"
-	"log"
 )
 
 var applyCmd = &cobra.Command{
-	Use:   "apply",
+	Use:   "apply [FILE]",
 	Short: "Apply Topology",
-	Long:  `Apply Topology with Nodes list and Links list.`,
-	Run: func(cmd *cobra.Command, args []string) {
+	Long: `Apply Topology with Nodes list and Links list.
+Topologies written for containerlab, GNS3 or NetworkX can be applied directly
+with --format, by default the format is guessed from the file name.
+With --dry-run the operations are printed as by plan and nothing is changed.
+Nodes and then links are provisioned by --parallelism workers, the default is
+the value the session was started with.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		if err := requireCalculator(); err != nil && !dryRun {
+			return err
+		}
 		filepath, _ := cmd.Flags().GetString("from")
-		err := Calculator.ApplyTopoConfig(filepath)
+		if len(args) == 1 {
+			filepath = args[0]
+		}
+		if filepath == "" {
+			return errors.New("no topology file given, use -f FILE")
+		}
+		format, _ := cmd.Flags().GetString("format")
+		// validate before anything is created
+		var opts validate.Options
+		if Calculator != nil {
+			opts = Calculator.ValidateOptions()
+		}
+		topo, report, err := validate.File(filepath, format, opts)
 		if err != nil {
-			log.Fatal(err.Error())
-			return
+			return err
+		}
+		for _, issue := range report.Warnings() {
+			fmt.Fprintln(cmd.ErrOrStderr(), issue.String())
+		}
+		if err = report.Err(); err != nil {
+			return err
+		}
+		if dryRun {
+			output, _ := cmd.Flags().GetString("output")
+			return printPlan(cmd, topo, output)
+		}
+		ctx := cmd.Context()
+		if parallelism, _ := cmd.Flags().GetInt("parallelism"); parallelism > 0 {
+			ctx = pkg.WithParallelism(ctx, parallelism)
+		}
+		if err = Calculator.ApplyTopo(ctx, topo); err != nil {
+			return err
 		}
+		fmt.Fprintln(cmd.OutOrStdout(), "Configuration applied successfully.")
+		return nil
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(applyCmd)
 	applyCmd.Flags().StringP("from", "f", "", "Path to the topology configuration file")
+	applyCmd.Flags().String("format", "", "Topology format: native, containerlab, gns3 or networkx (guessed from the file name if empty)")
+	applyCmd.Flags().Bool("dry-run", false, "Print the operations instead of executing them")
+	applyCmd.Flags().StringP("output", "o", "text", "Output format of --dry-run: text or json")
+	applyCmd.Flags().Int("parallelism", 0, "Nodes or links provisioned at once (default: the session setting)")
 	//applyCmd.MarkFlagRequired("from")
 }
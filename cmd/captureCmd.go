@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"Netlink/pkg/capture"
+	"Netlink/pkg/node"
+	"Netlink/pkg/ovs"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	sideNode   = "node"
+	sideOvs    = "ovs"
+	sideMirror = "mirror"
+)
+
+var captureCmd = &cobra.Command{
+	Use:   "capture NODE [PEER]",
+	Short: "Capture Packets",
+	Long: `Capture the packets of a node as pcapng, without tcpdump in the image.
+With PEER only packets from or to the address of PEER are kept.
+
+--side selects where the packets are taken:
+  node    the veth inside the node namespace (default), outgoing packets are
+          seen as they leave the HTB class and netem qdisc of the node
+  ovs     the host side of the veth
+  mirror  an OVS mirror of the node port on a temporary internal port
+
+Capturing on both ends of a link shows the impairments applied in between.
+Use -w - to stream to stdout, e.g. net capture node1 node2 -w - | wireshark -k -i -`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output, _ := cmd.Flags().GetString("write")
+		side, _ := cmd.Flags().GetString("side")
+		count, _ := cmd.Flags().GetInt("count")
+		snaplen, _ := cmd.Flags().GetInt("snaplen")
+		duration, _ := cmd.Flags().GetDuration("duration")
+		noFilter, _ := cmd.Flags().GetBool("no-filter")
+		if output == "" {
+			return errors.New("no output given, use -w FILE or -w - for stdout")
+		}
+
+		ctx := cmd.Context()
+		n, err := findNode(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		opts := capture.Options{Count: count, Snaplen: snaplen}
+		if len(args) == 2 && !noFilter {
+			peer, err := findNode(ctx, args[1])
+			if err != nil {
+				return err
+			}
+			opts.Host = strings.Split(peer.Interface.Ipv4, "/")[0]
+		}
+
+		switch side {
+		case sideNode:
+			opts.Netns = n.NetNs
+			opts.Interface = n.Name + node.NodeVethSuffix
+		case sideOvs:
+			opts.Interface = n.Name + ovs.VethOvsSideSuffix
+		case sideMirror:
+			bridge := ovs.DefaultBridge
+			if Calculator != nil {
+				bridge = Calculator.Bridge()
+			}
+			// the mirror and its port share the name, <node>-mir fits the interface name limit
+			mirror := n.Name + "-mir"
+			if err = ovs.AddMirror(bridge, mirror, n.Name+ovs.VethOvsSideSuffix, mirror); err != nil {
+				_ = ovs.DeleteMirror(bridge, mirror, mirror)
+				return err
+			}
+			defer func() {
+				if err := ovs.DeleteMirror(bridge, mirror, mirror); err != nil {
+					fmt.Fprintln(cmd.ErrOrStderr(), err)
+				}
+			}()
+			opts.Interface = mirror
+		default:
+			return fmt.Errorf("unknown side %q, expected node, ovs or mirror", side)
+		}
+
+		var w io.Writer = cmd.OutOrStdout()
+		if output != "-" {
+			f, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %w", output, err)
+			}
+			defer f.Close()
+			w = f
+		}
+		if duration > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, duration)
+			defer cancel()
+		}
+
+		fmt.Fprintf(cmd.ErrOrStderr(), "capturing on %s, Ctrl-C to stop\n", opts.Interface)
+		written, err := capture.Run(ctx, opts, w)
+		fmt.Fprintf(cmd.ErrOrStderr(), "%d packet(s) captured\n", written)
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(captureCmd)
+	captureCmd.Flags().StringP("write", "w", "", "Write pcapng to this file, - for stdout")
+	captureCmd.Flags().String("side", sideNode, "Capture point: node, ovs or mirror")
+	captureCmd.Flags().IntP("count", "c", 0, "Stop after this many packets, 0 captures until interrupted")
+	captureCmd.Flags().Int("snaplen", capture.DefaultSnaplen, "Bytes kept of every packet")
+	captureCmd.Flags().Duration("duration", 0, "Stop after this long, 0 captures until interrupted")
+	captureCmd.Flags().Bool("no-filter", false, "Keep all packets even if PEER is given")
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"Netlink/pkg/importer"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+)
+
+var convertCmd = &cobra.Command{
+	Use:   "convert",
+	Short: "Convert Topology",
+	Long: `Convert a containerlab, GNS3 or NetworkX node-link topology into the
+native YAML format accepted by apply.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filepath, _ := cmd.Flags().GetString("from")
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+		if filepath == "" {
+			return errors.New("no topology file given, use -f FILE")
+		}
+		topo, err := importer.Load(filepath, format)
+		if err != nil {
+			return err
+		}
+
+		var w io.Writer = cmd.OutOrStdout()
+		if output != "" && output != "-" {
+			f, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %w", output, err)
+			}
+			defer f.Close()
+			w = f
+		}
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err = enc.Encode(topo); err != nil {
+			return err
+		}
+		return enc.Close()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(convertCmd)
+	convertCmd.Flags().StringP("from", "f", "", "Path to the topology file to convert")
+	convertCmd.Flags().String("format", "", "Source format: containerlab, gns3 or networkx (guessed from the file name if empty)")
+	convertCmd.Flags().StringP("output", "o", "", "Output file, stdout if empty")
+}
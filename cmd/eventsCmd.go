@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"encoding/json"
+	"github.com/spf13/cobra"
+)
+
+var eventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "Show Topology Events",
+	Long: `Print the recent node and link changes as JSON lines with timestamp,
+actor, operation, node or link, old and new properties, duration and error.
+When a change fails, every step undone by the rollback is printed marked
+as rollback, followed by a rollback event.
+--follow streams every following event until Ctrl-C, --log appends all
+following events to a file and --stop-log stops writing to it.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireCalculator(); err != nil {
+			return err
+		}
+		follow, _ := cmd.Flags().GetBool("follow")
+		logFile, _ := cmd.Flags().GetString("log")
+		stopLog, _ := cmd.Flags().GetString("stop-log")
+		bus := Calculator.Events()
+
+		switch {
+		case stopLog != "":
+			return bus.CloseFile(stopLog)
+		case logFile != "":
+			return bus.OpenFile(logFile)
+		}
+
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		if !follow {
+			for _, e := range bus.History() {
+				if err := enc.Encode(e); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		events, cancel := bus.Subscribe(256)
+		defer cancel()
+		for {
+			select {
+			case <-cmd.Context().Done():
+				return nil
+			case e := <-events:
+				if err := enc.Encode(e); err != nil {
+					return err
+				}
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(eventsCmd)
+	eventsCmd.Flags().BoolP("follow", "f", false, "Stream events until Ctrl-C")
+	eventsCmd.Flags().String("log", "", "Append all following events to this file")
+	eventsCmd.Flags().String("stop-log", "", "Stop appending events to this file")
+}
@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"Netlink/api"
+	"Netlink/pkg"
+	"Netlink/pkg/node"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/moby/term"
+	"github.com/spf13/cobra"
+	"io"
+	"strings"
+	"sync"
+)
+
+// defaultShell starts bash where the node has it, sh otherwise
+var defaultShell = []string{"/bin/sh", "-c", "if command -v bash >/dev/null; then exec bash; else exec sh; fi"}
+
+// ExitError is returned when a command run in nodes exits non-zero,
+// the process exits with Code
+type ExitError struct {
+	Nodes []string
+	Code  int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("command terminated with exit code %d in %s", e.Code, strings.Join(e.Nodes, ", "))
+}
+
+// ExitCode returns the status the process exits with after err: the
+// code of the command for an ExitError, 1 for other errors
+func ExitCode(err error) int {
+	var exitErr *ExitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr):
+		return exitErr.Code
+	}
+	return 1
+}
+
+var execCmd = &cobra.Command{
+	Use:   "exec NODE [--] COMMAND [ARG...]",
+	Short: "Run a Command in Nodes",
+	Long: `Run a command in a node: with docker exec in container nodes, by entering
+the namespace of netns, nat and host nodes. The exit code of the command is
+the one of net exec.
+
+With --all or --nodes a,b,c the command runs in several nodes in parallel,
+without input, and the output of every node is printed after the node name
+and exit code. The first non-zero exit code in node order is returned.`,
+	Example: `  net exec node1 -- ping -c 3 10.0.0.2
+  net exec -it node1 -- vtysh
+  net exec --nodes node1,node2 -- ip route`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		all, _ := cmd.Flags().GetBool("all")
+		names, _ := cmd.Flags().GetStringSlice("nodes")
+		tty, _ := cmd.Flags().GetBool("tty")
+		interactive, _ := cmd.Flags().GetBool("interactive")
+		parallelism, _ := cmd.Flags().GetInt("parallelism")
+
+		ctx := cmd.Context()
+		if !all && len(names) == 0 {
+			argv := commandArgs(args[1:])
+			if len(argv) == 0 {
+				return errors.New("no command given")
+			}
+			opts := node.ExecOptions{Cmd: argv, TTY: tty, Stdout: cmd.OutOrStdout(), Stderr: cmd.ErrOrStderr()}
+			if interactive {
+				opts.Stdin = cmd.InOrStdin()
+			}
+			return execNode(ctx, args[0], opts)
+		}
+
+		if all && len(names) > 0 {
+			return errors.New("--all and --nodes are exclusive")
+		}
+		if tty || interactive {
+			return errors.New("--tty and --interactive need a single node")
+		}
+		if all {
+			if err := requireCalculator(); err != nil {
+				return err
+			}
+			for _, n := range Calculator.Nodes() {
+				names = append(names, n.Name)
+			}
+		}
+		argv := commandArgs(args)
+		if len(argv) == 0 {
+			return errors.New("no command given")
+		}
+		return execNodes(ctx, cmd.OutOrStdout(), names, argv, parallelism)
+	},
+}
+
+var shellCmd = &cobra.Command{
+	Use:   "shell NODE",
+	Short: "Open a Shell in a Node",
+	Long: `Open an interactive shell in a node, bash if the node has it and sh
+otherwise. It gets a terminal when net runs in one. Leave it with exit.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		shell, _ := cmd.Flags().GetString("shell")
+		argv := defaultShell
+		if shell != "" {
+			argv = []string{shell}
+		}
+		_, tty := term.GetFdInfo(cmd.InOrStdin())
+		return execNode(cmd.Context(), args[0], node.ExecOptions{
+			Cmd:    argv,
+			TTY:    tty,
+			Stdin:  cmd.InOrStdin(),
+			Stdout: cmd.OutOrStdout(),
+			Stderr: cmd.ErrOrStderr(),
+		})
+	},
+}
+
+// commandArgs drops the -- separating the command from the node, it is
+// kept in args as flags stop at the node name
+func commandArgs(args []string) []string {
+	if len(args) > 0 && args[0] == "--" {
+		return args[1:]
+	}
+	return args
+}
+
+// execNode runs the command in the node and turns a non-zero exit code
+// into an ExitError
+func execNode(ctx context.Context, name string, opts node.ExecOptions) error {
+	n, err := findNode(ctx, name)
+	if err != nil {
+		return err
+	}
+	code, err := node.Exec(ctx, n, opts)
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return &ExitError{Nodes: []string{name}, Code: code}
+	}
+	return nil
+}
+
+// execResult is the output, stdout and stderr merged, and the exit code
+// of the command in one node
+type execResult struct {
+	out  bytes.Buffer
+	code int
+	err  error
+}
+
+// execNodes runs the command in the nodes, at most parallelism at once,
+// and writes the output grouped by node in the order of names
+func execNodes(ctx context.Context, w io.Writer, names, argv []string, parallelism int) error {
+	if parallelism <= 0 {
+		parallelism = pkg.DefaultParallelism
+	}
+	results := make([]execResult, len(names))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			r := &results[i]
+			var n api.Node
+			if n, r.err = findNode(ctx, name); r.err != nil {
+				return
+			}
+			r.code, r.err = node.Exec(ctx, n, node.ExecOptions{Cmd: argv, Stdout: &r.out})
+		}()
+	}
+	wg.Wait()
+
+	var exitErr *ExitError
+	var errs []error
+	for i, name := range names {
+		r := &results[i]
+		if r.err != nil {
+			fmt.Fprintf(w, "=== %s (error: %v)\n", name, r.err)
+			errs = append(errs, fmt.Errorf("%s: %w", name, r.err))
+			continue
+		}
+		fmt.Fprintf(w, "=== %s (exit %d)\n", name, r.code)
+		out := r.out.Bytes()
+		w.Write(out)
+		if len(out) > 0 && out[len(out)-1] != '\n' {
+			fmt.Fprintln(w)
+		}
+		if r.code == 0 {
+			continue
+		}
+		if exitErr == nil {
+			exitErr = &ExitError{Code: r.code}
+		}
+		exitErr.Nodes = append(exitErr.Nodes, name)
+	}
+	if exitErr != nil {
+		errs = append(errs, exitErr)
+	}
+	return errors.Join(errs...)
+}
+
+func init() {
+	rootCmd.AddCommand(execCmd)
+	rootCmd.AddCommand(shellCmd)
+	// flags after the node name belong to the command
+	execCmd.Flags().SetInterspersed(false)
+	execCmd.Flags().BoolP("tty", "t", false, "Give the command a terminal")
+	execCmd.Flags().BoolP("interactive", "i", false, "Pass standard input to the command")
+	execCmd.Flags().Bool("all", false, "Run the command in every node of the topology")
+	execCmd.Flags().StringSlice("nodes", nil, "Run the command in these nodes (a,b,c)")
+	execCmd.Flags().Int("parallelism", pkg.DefaultParallelism, "Nodes the command runs in at once with --all or --nodes")
+	shellCmd.Flags().String("shell", "", "Shell to start instead of bash or sh")
+}
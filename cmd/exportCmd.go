@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"Netlink/pkg/export"
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export Topology",
+	Long: `Export the applied topology as Graphviz DOT, GraphML, Mermaid or
+NetworkX node-link JSON, including the configured link properties.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireCalculator(); err != nil {
+			return err
+		}
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+
+		g := export.NewGraph(Calculator.Nodes(), Calculator.Links())
+		if output == "" || output == "-" {
+			return export.Write(cmd.OutOrStdout(), format, g)
+		}
+		f, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", output, err)
+		}
+		if err = export.Write(f, format, g); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().String("format", export.FormatDOT, "Export format: dot, graphml, mermaid or json")
+	exportCmd.Flags().StringP("output", "o", "", "Output file, stdout if empty")
+}
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"Netlink/api"
+	"Netlink/pkg/generator"
+	"Netlink/pkg/importer"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"strings"
+)
+
+var generateCmd = &cobra.Command{
+	Use:   "generate [TYPE]",
+	Short: "Generate Topology",
+	Long: `Generate nodes and links for a common topology shape and print them as YAML
+accepted by apply. TYPE is one of ` + strings.Join(generator.Types, ", ") + `.
+With -f the generators section of an existing topology file is expanded instead.`,
+	Example: `  net generate fattree --k 4 --rate 1000 --tier-rate core=10000
+  net generate leafspine --spines 2 --leaves 4 --hosts-per-leaf 2
+  net generate torus --dims 4,4 --latency-dist uniform:1:10
+  net generate barabasi-albert --nodes 100 --m 2 --subnet 10.0.0.0/16 -o ba.yaml`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		from, _ := flags.GetString("from")
+		output, _ := flags.GetString("output")
+
+		var topo api.TopoConfig
+		var err error
+		switch {
+		case from != "" && len(args) == 0:
+			if topo, err = importer.Load(from, ""); err != nil {
+				return err
+			}
+		case from == "" && len(args) == 1:
+			g := api.Generator{Type: args[0]}
+			g.Prefix, _ = flags.GetString("prefix")
+			g.Image, _ = flags.GetString("image")
+			g.Subnet, _ = flags.GetString("subnet")
+			g.K, _ = flags.GetInt("k")
+			g.Nodes, _ = flags.GetInt("nodes")
+			g.Spines, _ = flags.GetInt("spines")
+			g.Leaves, _ = flags.GetInt("leaves")
+			g.HostsPerLeaf, _ = flags.GetInt("hosts-per-leaf")
+			g.Dims, _ = flags.GetIntSlice("dims")
+			g.P, _ = flags.GetFloat64("p")
+			g.M, _ = flags.GetInt("m")
+			g.Seed, _ = flags.GetInt64("seed")
+			g.Properties.Rate, _ = flags.GetUint64("rate")
+			g.Properties.Latency, _ = flags.GetUint32("latency")
+			g.Properties.Loss, _ = flags.GetFloat32("loss")
+
+			tierRates, _ := flags.GetStringToString("tier-rate")
+			if len(tierRates) > 0 {
+				g.Tiers = make(map[string]api.LinkProperties, len(tierRates))
+				for tier, rate := range tierRates {
+					var r uint64
+					if _, err := fmt.Sscan(rate, &r); err != nil {
+						return fmt.Errorf("invalid rate %q for tier %s", rate, tier)
+					}
+					g.Tiers[tier] = api.LinkProperties{Rate: r}
+				}
+			}
+			dist, _ := flags.GetString("latency-dist")
+			if dist != "" {
+				if g.LatencyDistribution, err = parseDistribution(dist); err != nil {
+					return err
+				}
+			}
+			topo.Generators = []api.Generator{g}
+		default:
+			return errors.New("give either a generator TYPE or -f FILE")
+		}
+
+		if topo, err = generator.Expand(topo); err != nil {
+			return err
+		}
+
+		var w io.Writer = cmd.OutOrStdout()
+		if output != "" && output != "-" {
+			f, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %w", output, err)
+			}
+			defer f.Close()
+			w = f
+		}
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err = enc.Encode(topo); err != nil {
+			return err
+		}
+		return enc.Close()
+	},
+}
+
+// parseDistribution parses constant:MEAN, uniform:MIN:MAX or normal:MEAN:STDDEV
+func parseDistribution(s string) (*api.Distribution, error) {
+	parts := strings.Split(s, ":")
+	d := &api.Distribution{Type: parts[0]}
+	var a, b float64
+	var err error
+	switch {
+	case d.Type == "constant" && len(parts) == 2:
+		_, err = fmt.Sscan(parts[1], &d.Mean)
+	case d.Type == "uniform" && len(parts) == 3:
+		_, err = fmt.Sscan(parts[1]+" "+parts[2], &a, &b)
+		d.Min, d.Max = a, b
+	case d.Type == "normal" && len(parts) == 3:
+		_, err = fmt.Sscan(parts[1]+" "+parts[2], &a, &b)
+		d.Mean, d.Stddev = a, b
+	default:
+		return nil, fmt.Errorf("invalid latency distribution %q, expected constant:MEAN, uniform:MIN:MAX or normal:MEAN:STDDEV", s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid latency distribution %q: %w", s, err)
+	}
+	return d, nil
+}
+
+func init() {
+	rootCmd.AddCommand(generateCmd)
+	flags := generateCmd.Flags()
+	flags.StringP("from", "f", "", "Expand the generators section of this topology file")
+	flags.StringP("output", "o", "", "Output file, stdout if empty")
+	flags.String("prefix", "", "Prefix of the generated node names")
+	flags.String("image", "", "Image of the generated nodes")
+	flags.String("subnet", "", "CIDR to number the nodes from, automatic addresses if empty")
+	flags.Int("k", 4, "fattree: arity")
+	flags.Int("nodes", 0, "ring, star, mesh, erdos-renyi, barabasi-albert: number of nodes")
+	flags.Int("spines", 2, "leafspine: number of spines")
+	flags.Int("leaves", 4, "leafspine: number of leaves")
+	flags.Int("hosts-per-leaf", 0, "leafspine: hosts per leaf")
+	flags.IntSlice("dims", nil, "grid, torus: size of each dimension, e.g. 4,4 or 3,3,3")
+	flags.Float64("p", 0.1, "erdos-renyi: edge probability")
+	flags.Int("m", 1, "barabasi-albert: edges per new node")
+	flags.Int64("seed", 0, "Seed of the random graphs and latency distribution")
+	flags.Uint64("rate", 0, "Rate of every link in Mbps")
+	flags.Uint32("latency", 0, "Latency of every link in ms")
+	flags.Float32("loss", 0, "Loss of every link in percentage")
+	flags.StringToString("tier-rate", nil, "Rate per tier in Mbps, e.g. core=10000,aggregation=1000")
+	flags.String("latency-dist", "", "Latency distribution per link: constant:MEAN, uniform:MIN:MAX or normal:MEAN:STDDEV")
+}
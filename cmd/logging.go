@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// logHandler forwards to the handler selected by --log-level and
+// --log-format, loggers created before the flags are parsed follow them
+type logHandler struct {
+	derive []func(slog.Handler) slog.Handler // WithAttrs and WithGroup in order
+}
+
+var logState = struct {
+	sync.RWMutex
+	handler slog.Handler
+	// defaults of the interactive session, given when starting it
+	level, format string
+}{
+	handler: slog.NewTextHandler(os.Stderr, nil),
+	level:   "info",
+	format:  "text",
+}
+
+func init() {
+	slog.SetDefault(slog.New(&logHandler{}))
+}
+
+func (h *logHandler) current() slog.Handler {
+	logState.RLock()
+	base := logState.handler
+	logState.RUnlock()
+	for _, d := range h.derive {
+		base = d(base)
+	}
+	return base
+}
+
+func (h *logHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.current().Enabled(ctx, level)
+}
+
+func (h *logHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.current().Handle(ctx, r)
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(base slog.Handler) slog.Handler { return base.WithAttrs(attrs) })
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(base slog.Handler) slog.Handler { return base.WithGroup(name) })
+}
+
+func (h *logHandler) with(d func(slog.Handler) slog.Handler) slog.Handler {
+	derive := append(append([]func(slog.Handler) slog.Handler{}, h.derive...), d)
+	return &logHandler{derive: derive}
+}
+
+// configureLogging selects the level (debug, info, warn, error) and
+// format (text, json) of all log output, written to w
+func configureLogging(w io.Writer, level, format string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q, expected debug, info, warn or error", level)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("invalid log format %q, expected text or json", format)
+	}
+	logState.Lock()
+	logState.handler = handler
+	logState.Unlock()
+	return nil
+}
+
+// Interactive reports whether args only hold global logging flags and
+// session settings, these start the interactive session with the given
+// defaults, other arguments run a single command
+func Interactive(args []string) (bool, error) {
+	level, format := logState.level, logState.format
+	cfg := session
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		switch name {
+		case "--log-level", "--log-format", "--registry", "--parallelism":
+		default:
+			return false, nil
+		}
+		if !hasValue {
+			if i+1 == len(args) {
+				return false, nil
+			}
+			i++
+			value = args[i]
+		}
+		switch name {
+		case "--log-level":
+			level = value
+		case "--log-format":
+			format = value
+		case "--registry":
+			cfg.Registry = value
+		case "--parallelism":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return false, fmt.Errorf("invalid parallelism %q, expected a positive number", value)
+			}
+			cfg.Parallelism = n
+		}
+	}
+	if err := configureLogging(os.Stderr, level, format); err != nil {
+		return false, err
+	}
+	logState.Lock()
+	logState.level, logState.format = level, format
+	logState.Unlock()
+	session = cfg
+	return true, nil
+}
+
+// setupLogging applies the global flags of cmd, flags that are not
+// given fall back to the defaults of the session
+func setupLogging(cmd *cobra.Command) error {
+	logState.RLock()
+	level, format := logState.level, logState.format
+	logState.RUnlock()
+	if f := cmd.Flags().Lookup("log-level"); f != nil && f.Changed {
+		level = f.Value.String()
+	}
+	if f := cmd.Flags().Lookup("log-format"); f != nil && f.Changed {
+		format = f.Value.String()
+	}
+	return configureLogging(cmd.ErrOrStderr(), level, format)
+}
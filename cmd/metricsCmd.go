@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"Netlink/pkg/metrics"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"net"
+	"net/http"
+	"time"
+)
+
+// metricsServer serves /metrics while the interactive session runs
+var metricsServer *http.Server
+
+var metricsCmd = &cobra.Command{
+	Use:   "metrics",
+	Short: "Serve Metrics",
+	Long: `Expose the counters of every HTB class and netem qdisc (bytes, packets,
+drops, overlimits, backlog) and of the OVS ports and groups in the Prometheus
+text format, labelled by src, dst and the configured rate, latency and loss.
+--listen serves /metrics in the background of the interactive session and
+--stop stops it, without flags the metrics are printed once.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireCalculator(); err != nil {
+			return err
+		}
+		listen, _ := cmd.Flags().GetString("listen")
+		stop, _ := cmd.Flags().GetBool("stop")
+
+		switch {
+		case stop:
+			if metricsServer == nil {
+				return errors.New("metrics are not being served")
+			}
+			ctx, cancel := context.WithTimeout(cmd.Context(), 5*time.Second)
+			defer cancel()
+			err := metricsServer.Shutdown(ctx)
+			metricsServer = nil
+			return err
+		case listen != "":
+			if metricsServer != nil {
+				return fmt.Errorf("metrics are already served on %s", metricsServer.Addr)
+			}
+			ln, err := net.Listen("tcp", listen)
+			if err != nil {
+				return fmt.Errorf("failed to listen on %s: %w", listen, err)
+			}
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", metrics.Handler(Calculator.Stats))
+			metricsServer = &http.Server{Addr: ln.Addr().String(), Handler: mux}
+			go func(srv *http.Server) {
+				if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					fmt.Fprintln(cmd.ErrOrStderr(), "metrics server:", err)
+				}
+			}(metricsServer)
+			fmt.Fprintf(cmd.OutOrStdout(), "serving metrics on http://%s/metrics\n", metricsServer.Addr)
+			return nil
+		default:
+			s, err := Calculator.Stats(cmd.Context())
+			if err != nil {
+				return err
+			}
+			return metrics.Write(cmd.OutOrStdout(), s)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(metricsCmd)
+	metricsCmd.Flags().String("listen", "", "Serve /metrics on this address in the background, e.g. :9273")
+	metricsCmd.Flags().Bool("stop", false, "Stop serving metrics")
+}
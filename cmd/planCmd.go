@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"Netlink/api"
+	"Netlink/pkg"
+	"Netlink/pkg/validate"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+)
+
+var planCmd = &cobra.Command{
+	Use:   "plan [FILE]",
+	Short: "Show what apply would do",
+	Long: `Print the operations apply would execute for a topology file, in order:
+nodes to delete and create with their addresses, OVS ports, groups and their
+buckets, HTB classes with their classids and netem parameters, routes and FRR
+daemons. apply runs against in-memory backends holding a copy of the state.
+Inside the interactive session the plan is computed against the running
+topology, otherwise against an empty one. Nothing is changed.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filepath, _ := cmd.Flags().GetString("from")
+		if len(args) == 1 {
+			filepath = args[0]
+		}
+		if filepath == "" {
+			return errors.New("no topology file given, use -f FILE")
+		}
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+
+		var opts validate.Options
+		if Calculator != nil {
+			opts = Calculator.ValidateOptions()
+		}
+		topo, report, err := validate.File(filepath, format, opts)
+		if err != nil {
+			return err
+		}
+		for _, issue := range report.Warnings() {
+			fmt.Fprintln(cmd.ErrOrStderr(), issue.String())
+		}
+		if err = report.Err(); err != nil {
+			return err
+		}
+		return printPlan(cmd, topo, output)
+	},
+}
+
+// printPlan prints the operations applying topo would execute
+func printPlan(cmd *cobra.Command, topo api.TopoConfig, output string) error {
+	var plan *pkg.Plan
+	var err error
+	if Calculator != nil {
+		plan, err = Calculator.Plan(topo)
+	} else {
+		plan, err = pkg.PlanTopo(pkg.Config{}, topo)
+	}
+	if err != nil {
+		return err
+	}
+	return plan.Write(cmd.OutOrStdout(), output)
+}
+
+func init() {
+	rootCmd.AddCommand(planCmd)
+	planCmd.Flags().StringP("from", "f", "", "Path to the topology configuration file")
+	planCmd.Flags().String("format", "", "Topology format: native, containerlab, gns3 or networkx (guessed from the file name if empty)")
+	planCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+}
@@ -1,32 +1,125 @@
 package cmd
 
 import (
+	"Netlink/api"
 	"Netlink/pkg"
+	"Netlink/pkg/event"
+	"Netlink/pkg/node"
+	"context"
+	"errors"
+	"fmt"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 )
 
 var Calculator *pkg.Calculator
+
+// session holds the manager settings given when starting the
+// interactive session, see Interactive
+var session pkg.Config
+
+// SessionConfig returns the settings the session manager is created with
+func SessionConfig() pkg.Config {
+	return session
+}
+
 var rootCmd = &cobra.Command{
 	Use:   "net",
 	Short: "net Management CLI",
-	Long:  "A command-line tool for managing network topologies.",
+	Long: `A command-line tool for managing network topologies.
+
+Started without a command it runs the interactive session, which accepts
+--log-level, --log-format, --registry HOST[:PORT], the registry images
+without one are pulled from (docker hub by default), and --parallelism N,
+the number of nodes or links apply provisions at once (default 8).`,
+	SilenceUsage: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return setupLogging(cmd)
+	},
 }
 
+// errNoTopology is returned by commands that need a running topology
+// when invoked outside the interactive session
+var errNoTopology = errors.New("no running topology, run this command inside the interactive session")
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// Ctrl-C cancels the context of the command so it can clean up.
 func Execute(c *pkg.Calculator) error {
 	Calculator = c
-	err := rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err := rootCmd.ExecuteContext(withActor(ctx, os.Args[1:]))
 	return err
 }
 
+// ExecuteArgs runs one command line of the interactive session,
+// flags are reset to their defaults before each run and ctx is
+// cancelled to interrupt the command
+func ExecuteArgs(ctx context.Context, c *pkg.Calculator, args []string) error {
+	Calculator = c
+	resetFlags(rootCmd)
+	rootCmd.SetArgs(args)
+	return rootCmd.ExecuteContext(withActor(ctx, args))
+}
+
+// withActor records the user and command line in the events of the command
+func withActor(ctx context.Context, args []string) context.Context {
+	return event.WithActor(ctx, event.Actor(ctx)+": net "+strings.Join(args, " "))
+}
+
+// requireCalculator fails for commands that need the running topology
+func requireCalculator() error {
+	if Calculator == nil {
+		return errNoTopology
+	}
+	return nil
+}
+
+// findNode returns the node from the running topology, or looks up
+// its namespace or container outside the interactive session
+func findNode(ctx context.Context, name string) (api.Node, error) {
+	if Calculator == nil {
+		return node.Lookup(ctx, name)
+	}
+	n, ok := Calculator.Node(name)
+	if !ok {
+		return n, fmt.Errorf("node %s not found", name)
+	}
+	return n, nil
+}
+
+func resetFlags(c *cobra.Command) {
+	reset := func(f *pflag.Flag) {
+		if !f.Changed {
+			return
+		}
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			_ = sv.Replace(nil)
+		} else {
+			_ = f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	}
+	c.Flags().VisitAll(reset)
+	c.PersistentFlags().VisitAll(reset)
+	for _, sub := range c.Commands() {
+		resetFlags(sub)
+	}
+}
+
 func init() {
 	// Here you will define your flags and configuration settings.
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
-	rootCmd.AddCommand(applyCmd)
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	rootCmd.PersistentFlags().String("log-level", "info", "Log level: debug, info, warn or error")
+	rootCmd.PersistentFlags().String("log-format", "text", "Log format: text or json")
 }
@@ -1,27 +1,101 @@
 package cmd
 
 import (
+	"Netlink/api"
+	"Netlink/pkg/view"
+	"fmt"
 	"github.com/spf13/cobra"
 )
 
 var showCmd = &cobra.Command{
-	Use:   "show",
+	Use:   "show [nodes | links | routes | node NAME | link SRC DST | frr NAME]",
 	Short: "Show Resources",
-	Long:  `Show the resources of the topology.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		class := cmd.Flag("class").Value.String()
-		if class == "nodes" {
-			Calculator.ShowNodes()
-		} else if class == "links" {
-			Calculator.ShowLinks()
-		} else {
-			print("Invalid class")
-			return
+	Long: `Show the resources of the topology.
+Without arguments the whole topology is shown, -o yaml prints a configuration
+that can be applied again. routes lists the routes of the static routing mode,
+their cost is in ms or hops by the metric. frr prints the frr.conf written to
+a node.`,
+	Args: cobra.MaximumNArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireCalculator(); err != nil {
+			return err
+		}
+		output, _ := cmd.Flags().GetString("output")
+		names, _ := cmd.Flags().GetStringSlice("name")
+		selector, _ := cmd.Flags().GetString("selector")
+		labels, err := view.ParseSelector(selector)
+		if err != nil {
+			return err
+		}
+		filter := view.Filter{Names: names, Labels: labels}
+
+		if len(args) == 0 && cmd.Flags().Changed("class") {
+			class, _ := cmd.Flags().GetString("class")
+			args = []string{class}
+		}
+		nodes := view.FilterNodes(Calculator.Nodes(), filter)
+		links := view.FilterLinks(Calculator.Links(), nodes)
+		w := cmd.OutOrStdout()
+
+		if len(args) == 0 {
+			return view.WriteTopology(w, output, nodes, links, Calculator.IPPool())
+		}
+		switch args[0] {
+		case "nodes":
+			return view.WriteNodes(w, output, nodes, Calculator.IPPool())
+		case "links":
+			return view.WriteLinks(w, output, links)
+		case "routes":
+			return view.WriteRoutes(w, output, nodes)
+		case "node":
+			if len(args) != 2 {
+				return fmt.Errorf("usage: show node NAME")
+			}
+			for _, n := range nodes {
+				if n.Name == args[1] {
+					return view.WriteNodes(w, output, []api.Node{n}, Calculator.IPPool())
+				}
+			}
+			return fmt.Errorf("node %s not found", args[1])
+		case "link":
+			if len(args) != 3 {
+				return fmt.Errorf("usage: show link SRC DST")
+			}
+			var found []api.Link
+			for _, l := range links {
+				if (l.SrcNode == args[1] && l.DstNode == args[2]) || (l.SrcNode == args[2] && l.DstNode == args[1]) {
+					found = append(found, l)
+				}
+			}
+			if len(found) == 0 {
+				return fmt.Errorf("link %s-%s not found", args[1], args[2])
+			}
+			return view.WriteLinks(w, output, found)
+		case "frr":
+			if len(args) != 2 {
+				return fmt.Errorf("usage: show frr NAME")
+			}
+			for _, n := range nodes {
+				if n.Name == args[1] {
+					if n.FrrConf == "" {
+						return fmt.Errorf("node %s runs no FRR", args[1])
+					}
+					_, err := fmt.Fprint(w, n.FrrConf)
+					return err
+				}
+			}
+			return fmt.Errorf("node %s not found", args[1])
+		default:
+			return fmt.Errorf("invalid resource %q, expected nodes, links, routes, node, link or frr", args[0])
 		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(showCmd)
+	showCmd.Flags().StringP("output", "o", view.FormatTable, "Output format: table, wide, json or yaml")
+	showCmd.Flags().StringSlice("name", nil, "Only show nodes whose name matches one of the globs")
+	showCmd.Flags().StringP("selector", "l", "", "Only show nodes with these labels (k1=v1,k2=v2)")
 	showCmd.Flags().String("class", "nodes", "Class of the element to show")
+	_ = showCmd.Flags().MarkDeprecated("class", "use the positional argument instead, e.g. show links")
 }
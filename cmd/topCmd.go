@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"Netlink/pkg"
+	"Netlink/pkg/view"
+	"fmt"
+	"github.com/spf13/cobra"
+	"sort"
+	"time"
+)
+
+var topCmd = &cobra.Command{
+	Use:   "top",
+	Short: "Show Link Activity",
+	Long: `Show the throughput, utilization, drop rate and queue backlog of every
+link direction together with its configured rate, latency and loss, refreshed
+periodically from the HTB class and netem counters in each node namespace.
+Links running at their configured rate are marked with '*'. Press Ctrl-C to
+return to the prompt.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireCalculator(); err != nil {
+			return err
+		}
+		interval, _ := cmd.Flags().GetDuration("interval")
+		sortBy, _ := cmd.Flags().GetString("sort")
+		iterations, _ := cmd.Flags().GetInt("iterations")
+		noColor, _ := cmd.Flags().GetBool("no-color")
+		if interval <= 0 {
+			return fmt.Errorf("invalid interval %s", interval)
+		}
+		if err := view.SortTopRows(nil, sortBy); err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+		w := cmd.OutOrStdout()
+		var prev *pkg.Stats
+		for i := 0; iterations <= 0 || i < iterations; {
+			cur, err := Calculator.Stats(ctx)
+			if err != nil {
+				return err
+			}
+			// rates need two snapshots
+			if prev != nil {
+				rows := view.TopRows(prev, cur)
+				_ = view.SortTopRows(rows, sortBy)
+				if !noColor {
+					fmt.Fprint(w, "\033[H\033[2J")
+				}
+				fmt.Fprintf(w, "%s  %d link(s)  every %s\n\n", cur.Time.Format(time.TimeOnly), len(rows), interval)
+				if err = view.WriteTop(w, rows, !noColor); err != nil {
+					return err
+				}
+				failed := make([]string, 0, len(cur.Errors))
+				for name := range cur.Errors {
+					failed = append(failed, name)
+				}
+				sort.Strings(failed)
+				for _, name := range failed {
+					fmt.Fprintf(w, "%s: %v\n", name, cur.Errors[name])
+				}
+				i++
+			}
+			prev = cur
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(interval):
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(topCmd)
+	topCmd.Flags().Duration("interval", time.Second, "Refresh interval")
+	topCmd.Flags().String("sort", view.SortUtilization, "Sort by util, throughput, drops, backlog or name")
+	topCmd.Flags().IntP("iterations", "n", 0, "Exit after this many refreshes, 0 runs until interrupted")
+	topCmd.Flags().Bool("no-color", false, "Do not clear the screen or highlight links at their cap")
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"Netlink/pkg/validate"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate [FILE]",
+	Short: "Validate Topology",
+	Long: `Validate a topology file without creating anything: unknown fields,
+duplicate nodes and links, unknown link endpoints, address conflicts and
+link property ranges. Inside the interactive session the running topology
+is taken into account. Exits with a non-zero code if the file is invalid.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filepath, _ := cmd.Flags().GetString("from")
+		if len(args) == 1 {
+			filepath = args[0]
+		}
+		if filepath == "" {
+			return errors.New("no topology file given, use -f FILE")
+		}
+		format, _ := cmd.Flags().GetString("format")
+
+		var opts validate.Options
+		if Calculator != nil {
+			opts = Calculator.ValidateOptions()
+		}
+		if pool, _ := cmd.Flags().GetString("ip-pool"); pool != "" {
+			opts.IPPool = pool
+		}
+		_, report, err := validate.File(filepath, format, opts)
+		if err != nil {
+			return err
+		}
+		for _, issue := range report.Issues {
+			fmt.Fprintln(cmd.ErrOrStderr(), issue.String())
+		}
+		if err = report.Err(); err != nil {
+			return fmt.Errorf("%s is invalid", filepath)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "%s is valid\n", filepath)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+	validateCmd.Flags().StringP("from", "f", "", "Path to the topology configuration file")
+	validateCmd.Flags().String("format", "", "Topology format: native, containerlab, gns3 or networkx (guessed from the file name if empty)")
+	validateCmd.Flags().String("ip-pool", "", "Range reserved for automatic addresses (default 192.168.10.0/24)")
+}
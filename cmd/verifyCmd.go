@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"Netlink/pkg"
+	"fmt"
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify Topology",
+	Long: `Compare the applied topology with the configuration actually present:
+the qdiscs, HTB classes, netem qdiscs and u32 filters in every node namespace
+and the groups and flows on the OVS bridge. Missing or wrong entries and
+stale classes and filters are reported, --repair reinstalls them from the
+topology. Exits with a non-zero code if drift remains.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireCalculator(); err != nil {
+			return err
+		}
+		output, _ := cmd.Flags().GetString("output")
+		repair, _ := cmd.Flags().GetBool("repair")
+
+		drifts, err := Calculator.Verify(cmd.Context())
+		if err != nil {
+			return err
+		}
+		if err = pkg.WriteDrifts(cmd.OutOrStdout(), output, drifts); err != nil {
+			return err
+		}
+		if len(drifts) == 0 {
+			return nil
+		}
+		if !repair {
+			return fmt.Errorf("%d mismatch(es) found", len(drifts))
+		}
+
+		repairErr := Calculator.Repair(cmd.Context(), drifts)
+		remaining, err := Calculator.Verify(cmd.Context())
+		if err != nil {
+			return err
+		}
+		if len(remaining) == 0 {
+			fmt.Fprintf(cmd.ErrOrStderr(), "repaired %d mismatch(es)\n", len(drifts))
+			return nil
+		}
+		fmt.Fprintln(cmd.ErrOrStderr(), "after repair:")
+		if err = pkg.WriteDrifts(cmd.OutOrStdout(), output, remaining); err != nil {
+			return err
+		}
+		if repairErr != nil {
+			return fmt.Errorf("%d mismatch(es) remain: %w", len(remaining), repairErr)
+		}
+		return fmt.Errorf("%d mismatch(es) remain", len(remaining))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+	verifyCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+	verifyCmd.Flags().Bool("repair", false, "Reinstall missing or wrong entries and remove stale ones")
+}
@@ -0,0 +1,142 @@
+// Package emulator exposes the network emulator as a Go library.
+//
+// Unlike the CLI it never exits the process: every operation takes a
+// context and reports failures as wrapped errors, so it can be driven
+// from `go test` integration tests:
+//
+//	emu, err := emulator.New(ctx, emulator.WithBridge("test-br0"))
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer emu.Close(ctx)
+//	err = emu.ApplyFile(ctx, "example/topo.yaml")
+//
+// An Emulator is not safe for concurrent use.
+package emulator
+
+import (
+	"Netlink/api"
+	"Netlink/pkg"
+	"Netlink/pkg/event"
+	"context"
+	"log/slog"
+)
+
+// ErrNodeNotFound is returned when a link or lookup refers to an unknown node
+var ErrNodeNotFound = pkg.ErrNodeNotFound
+
+// Option configures an Emulator
+type Option func(*pkg.Config)
+
+// WithBridge sets the name of the OVS bridge the nodes are attached to
+func WithBridge(name string) Option {
+	return func(c *pkg.Config) {
+		c.Bridge = name
+	}
+}
+
+// WithImage sets the image used by nodes that do not specify one
+func WithImage(image string) Option {
+	return func(c *pkg.Config) {
+		c.Image = image
+	}
+}
+
+// WithRegistry sets the registry images that name none are pulled from,
+// e.g. "registry.example.com:5000"
+func WithRegistry(registry string) Option {
+	return func(c *pkg.Config) {
+		c.Registry = registry
+	}
+}
+
+// WithIPPool sets the IPv4 CIDR from which node addresses are assigned
+// when a node has no valid address of its own
+func WithIPPool(cidr string) Option {
+	return func(c *pkg.Config) {
+		c.IPPool = cidr
+	}
+}
+
+// WithParallelism sets the number of nodes or links Apply provisions at once,
+// pkg.DefaultParallelism by default
+func WithParallelism(n int) Option {
+	return func(c *pkg.Config) {
+		c.Parallelism = n
+	}
+}
+
+// WithLogger sets the structured logger, slog.Default() by default
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *pkg.Config) {
+		c.Logger = logger
+	}
+}
+
+// Emulator owns an OVS bridge and the nodes and links attached to it
+type Emulator struct {
+	m *pkg.Manager
+}
+
+// New creates the bridge and connects to the docker daemon
+func New(ctx context.Context, opts ...Option) (*Emulator, error) {
+	var cfg pkg.Config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	m, err := pkg.NewManager(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Emulator{m: m}, nil
+}
+
+// Apply adds the nodes and then the links of topo
+func (e *Emulator) Apply(ctx context.Context, topo api.TopoConfig) error {
+	return e.m.Apply(ctx, topo)
+}
+
+// ApplyFile loads a topology YAML file and applies it
+func (e *Emulator) ApplyFile(ctx context.Context, path string) error {
+	topo, err := pkg.LoadTopoConfig(path)
+	if err != nil {
+		return err
+	}
+	return e.m.Apply(ctx, topo)
+}
+
+// AddNode creates a node, replacing an existing node with the same name
+func (e *Emulator) AddNode(ctx context.Context, n api.Node) error {
+	return e.m.AddNode(ctx, n)
+}
+
+// AddLink creates or updates a link between two existing nodes
+func (e *Emulator) AddLink(ctx context.Context, l api.Link) error {
+	return e.m.AddLink(ctx, l)
+}
+
+// Node returns the node with the given name
+func (e *Emulator) Node(name string) (api.Node, bool) {
+	return e.m.Node(name)
+}
+
+// Nodes returns all nodes ordered by Uid
+func (e *Emulator) Nodes() []api.Node {
+	return e.m.NodeList()
+}
+
+// Links returns one unidirectional link per configured direction
+func (e *Emulator) Links() []api.Link {
+	return e.m.LinkList()
+}
+
+// Events returns the bus every node and link change is emitted on,
+// subscribe to align measurements with the time links changed
+func (e *Emulator) Events() *event.Bus {
+	return e.m.Events()
+}
+
+// Close removes all nodes and the bridge
+func (e *Emulator) Close(ctx context.Context) error {
+	return e.m.Destroy(ctx)
+}
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"Netlink/cmd"
 	"Netlink/pkg"
+	"bufio"
+	"context"
 	"fmt"
+	"log"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 )
 
@@ -16,61 +22,86 @@ import (
 var c *pkg.Calculator
 
 func main() {
-	c = pkg.NewCalculator()
+	// with arguments run a single command that needs no running topology (e.g. net show --help)
+	// only --log-level, --log-format, --registry and --parallelism start the session with these settings
+	interactive, err := cmd.Interactive(os.Args[1:])
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	if !interactive {
+		if err := cmd.Execute(nil); err != nil {
+			os.Exit(cmd.ExitCode(err))
+		}
+		return
+	}
 
-	defer c.Destroy()
+	c, err = pkg.NewCalculator(cmd.SessionConfig())
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	defer func() {
+		if err := c.Destroy(); err != nil {
+			fmt.Println("Error destroying topology:", err)
+		}
+	}()
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 
+	// Ctrl-C interrupts the running command (e.g. top or a long apply),
+	// at the prompt it ends the session
+	var mu sync.Mutex
+	var cancelCmd context.CancelFunc
+
 	go func() {
-		// 循环接收并执行命令
+		// 循环接收并执行命令, e.g. "apply -f example/topo.yaml", "show links -o json"
+		scanner := bufio.NewScanner(os.Stdin)
 		for {
-			var input string
 			fmt.Print("Enter command: ")
-			_, err := fmt.Scanln(&input)
-			if err != nil {
-				fmt.Println("Error reading input:", err)
+			if !scanner.Scan() {
+				if err := scanner.Err(); err != nil {
+					fmt.Println("Error reading input:", err)
+				}
+				stop <- syscall.SIGTERM
+				return
+			}
+			args := strings.Fields(scanner.Text())
+			if len(args) == 0 {
 				continue
 			}
 
-			// 根据输入的命令执行相应的操作
-			switch input {
-			case "apply":
-				_, err := fmt.Scanln(&input)
-				if err != nil {
-					fmt.Println("Error reading input:", err)
-					return
-				}
-				err = c.ApplyTopoConfig(input)
-				if err != nil {
-					stop <- syscall.SIGTERM
-					fmt.Println("Error applying configuration:", err)
-				} else {
-					fmt.Println("Configuration applied successfully.")
-				}
-			case "exit":
+			if args[0] == "exit" {
 				fmt.Println("Exiting...")
 				stop <- syscall.SIGTERM
 				return
-			case "show":
-				_, err := fmt.Scanln(&input)
-				if err != nil {
-					fmt.Println("Error reading input:", err)
-					return
-				}
-				switch input {
-				case "nodes":
-					c.ShowNodes()
-				case "links":
-					c.ShowLinks()
-				}
-			default:
-				continue
 			}
+			ctx, cancel := context.WithCancel(context.Background())
+			mu.Lock()
+			cancelCmd = cancel
+			mu.Unlock()
+			// cobra has already printed the error, a failed apply has been
+			// rolled back and the previous topology keeps running
+			_ = cmd.ExecuteArgs(ctx, c, args)
+			mu.Lock()
+			cancelCmd = nil
+			mu.Unlock()
+			cancel()
 		}
 	}()
 
+	for sig := range stop {
+		mu.Lock()
+		cancel := cancelCmd
+		mu.Unlock()
+		if sig == syscall.SIGINT && cancel != nil {
+			fmt.Println()
+			cancel()
+			continue
+		}
+		break
+	}
+
 	//err := c.ApplyTopoConfig("example/topo.yaml")
 	//if err != nil {
 	//	c.Destroy()
@@ -78,7 +109,6 @@ func main() {
 	//	return
 	//}
 	// wait, before shutting down , clear up the resources
-	<-stop
 	//c.Destroy()
 
 }
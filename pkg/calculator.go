@@ -2,64 +2,102 @@ package pkg
 
 import (
 	"Netlink/api"
-	"fmt"
-	"gopkg.in/yaml.v3"
-	"io/ioutil"
+	"Netlink/pkg/event"
+	"Netlink/pkg/importer"
+	"Netlink/pkg/validate"
+	"context"
 )
 
 type Calculator struct {
 	m *Manager
 }
 
-func NewCalculator() *Calculator {
-	return &Calculator{
-		m: NewManager(),
+// NewCalculator creates the manager of the interactive session
+func NewCalculator(cfg Config) (*Calculator, error) {
+	m, err := NewManager(context.Background(), cfg)
+	if err != nil {
+		return nil, err
 	}
+	return &Calculator{
+		m: m,
+	}, nil
+}
+
+// LoadTopoConfig reads a topology file, the format (native YAML,
+// containerlab, GNS3 or NetworkX JSON) is detected from the file name
+func LoadTopoConfig(filepath string) (api.TopoConfig, error) {
+	return importer.Load(filepath, "")
 }
 
 func (c *Calculator) ApplyTopoConfig(filepath string) error {
-	data, err := ioutil.ReadFile(filepath)
+	topoCfg, err := LoadTopoConfig(filepath)
 	if err != nil {
-		return fmt.Errorf("error reading YAML file: %v", err)
+		return err
 	}
+	return c.ApplyTopo(context.Background(), topoCfg)
+}
 
-	// Unmarshal the YAML file into api.TopoConfig
-	var topoCfg api.TopoConfig
-	if err = yaml.Unmarshal(data, &topoCfg); err != nil {
-		return fmt.Errorf("error unmarshaling YAML file: %v", err)
-	}
+// ApplyTopo adds the nodes and then the links of topoCfg
+func (c *Calculator) ApplyTopo(ctx context.Context, topoCfg api.TopoConfig) error {
+	return c.m.Apply(ctx, topoCfg)
+}
 
-	// Add nodes
-	for _, node := range topoCfg.Nodes {
-		if err = c.m.AddNode(node); err != nil {
-			return err
-		}
-	}
+// Plan returns the operations ApplyTopo would execute for topoCfg
+func (c *Calculator) Plan(topoCfg api.TopoConfig) (*Plan, error) {
+	return c.m.Plan(topoCfg)
+}
 
-	// Add links
-	for _, link := range topoCfg.Links {
-		if err = c.m.AddLink(link); err != nil {
-			return err
-		}
-	}
+// Verify compares the applied configuration with the kernel and OVS
+func (c *Calculator) Verify(ctx context.Context) ([]Drift, error) {
+	return c.m.Verify(ctx)
+}
 
-	return nil
+// Repair fixes the drift found by Verify
+func (c *Calculator) Repair(ctx context.Context, drifts []Drift) error {
+	return c.m.Repair(ctx, drifts)
 }
 
-func (c *Calculator) Destroy() {
-	c.m.Destroy()
+// Stats reads the tc and OVS counters of all nodes and links
+func (c *Calculator) Stats(ctx context.Context) (*Stats, error) {
+	return c.m.Stats(ctx)
 }
 
-func (c *Calculator) ShowNodes() {
-	for _, node := range c.m.Nodes {
-		fmt.Printf("Node: %s, Uid: %d, Interface: %s, IPv4: %s\n", node.Name, node.Uid, node.Interface.Name, node.Interface.Ipv4)
-	}
+// ValidateOptions describes the running topology for validation
+func (c *Calculator) ValidateOptions() validate.Options {
+	return c.m.ValidateOptions()
 }
 
-func (c *Calculator) ShowLinks() {
-	for _, node := range c.m.Nodes {
-		for dstNode, link := range node.Rules {
-			fmt.Printf("Link: Src: %s, Dst: %s, Bw: %dMbps, Delay: %dms, Loss: %.2f\n", node.Name, dstNode, link.Rate, link.Latency, link.Loss)
-		}
-	}
+func (c *Calculator) Destroy() error {
+	return c.m.Destroy(context.Background())
+}
+
+// Node returns the node with the given name
+func (c *Calculator) Node(name string) (api.Node, bool) {
+	return c.m.Node(name)
+}
+
+// Events returns the bus topology changes are emitted on
+func (c *Calculator) Events() *event.Bus {
+	return c.m.Events()
+}
+
+// Bridge returns the name of the OVS bridge
+func (c *Calculator) Bridge() string {
+	return c.m.sw.Bridge()
+}
+
+// IPPool returns the range automatic addresses are assigned from,
+// empty for util.DefaultIPPool
+func (c *Calculator) IPPool() string {
+	return c.m.cfg.IPPool
+}
+
+// Nodes returns the nodes currently managed, ordered by Uid
+func (c *Calculator) Nodes() []api.Node {
+	return c.m.NodeList()
+}
+
+// Links returns one unidirectional link per configured direction
+func (c *Calculator) Links() []api.Link {
+	return c.m.LinkList()
 }
@@ -0,0 +1,42 @@
+package capture
+
+import (
+	"fmt"
+	"golang.org/x/sys/unix"
+	"net"
+)
+
+// classic BPF opcodes
+const (
+	bpfLdH  = unix.BPF_LD | unix.BPF_H | unix.BPF_ABS
+	bpfLdW  = unix.BPF_LD | unix.BPF_W | unix.BPF_ABS
+	bpfJeq  = unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K
+	bpfRetK = unix.BPF_RET | unix.BPF_K
+)
+
+// HostFilter compiles "ip host IP or arp host IP" for Ethernet frames,
+// accepted packets are cut to snaplen
+func HostFilter(ip string, snaplen int) ([]unix.SockFilter, error) {
+	ip4 := net.ParseIP(ip).To4()
+	if ip4 == nil {
+		return nil, fmt.Errorf("invalid ipv4 address %q", ip)
+	}
+	k := uint32(ip4[0])<<24 | uint32(ip4[1])<<16 | uint32(ip4[2])<<8 | uint32(ip4[3])
+
+	// jump offsets are relative to the next instruction, 11 accepts and 12 drops
+	return []unix.SockFilter{
+		{Code: bpfLdH, K: 12},                           // 0: ethertype
+		{Code: bpfJeq, K: unix.ETH_P_IP, Jt: 0, Jf: 4},  // 1: ipv4, else 6
+		{Code: bpfLdW, K: 26},                           // 2: ip src
+		{Code: bpfJeq, K: k, Jt: 7, Jf: 0},              // 3
+		{Code: bpfLdW, K: 30},                           // 4: ip dst
+		{Code: bpfJeq, K: k, Jt: 5, Jf: 6},              // 5
+		{Code: bpfJeq, K: unix.ETH_P_ARP, Jt: 0, Jf: 5}, // 6: arp
+		{Code: bpfLdW, K: 28},                           // 7: sender address
+		{Code: bpfJeq, K: k, Jt: 2, Jf: 0},              // 8
+		{Code: bpfLdW, K: 38},                           // 9: target address
+		{Code: bpfJeq, K: k, Jt: 0, Jf: 1},              // 10
+		{Code: bpfRetK, K: uint32(snaplen)},             // 11
+		{Code: bpfRetK, K: 0},                           // 12
+	}, nil
+}
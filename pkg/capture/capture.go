@@ -0,0 +1,151 @@
+// Package capture records the packets of an interface, in a node namespace
+// or on the host, with an AF_PACKET socket and writes them as pcapng.
+package capture
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	ns "github.com/containernetworking/plugins/pkg/ns"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+	"io"
+	"time"
+)
+
+// DefaultSnaplen is the default number of bytes kept of every packet
+const DefaultSnaplen = 262144
+
+// Options selects what is captured
+type Options struct {
+	Netns     string // namespace of Interface, the host namespace if empty
+	Interface string
+	Host      string // only packets from or to this ipv4 address if set
+	Snaplen   int    // DefaultSnaplen if 0
+	Count     int    // stop after this many packets, 0 captures until ctx is done
+}
+
+// Run captures on the interface and streams pcapng to w until ctx is done
+// or Count packets were written, it returns the number of packets written
+func Run(ctx context.Context, opts Options, w io.Writer) (int, error) {
+	if opts.Snaplen <= 0 {
+		opts.Snaplen = DefaultSnaplen
+	}
+	fd, err := open(opts)
+	if err != nil {
+		return 0, err
+	}
+	defer unix.Close(fd)
+
+	pw, err := NewWriter(w, opts.Interface, opts.Snaplen)
+	if err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, opts.Snaplen)
+	oob := make([]byte, unix.CmsgSpace(16))
+	count := 0
+	for ctx.Err() == nil && (opts.Count <= 0 || count < opts.Count) {
+		// MSG_TRUNC returns the length on the wire
+		n, oobn, _, from, err := unix.Recvmsg(fd, buf, oob, unix.MSG_TRUNC)
+		if err != nil {
+			if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+				continue // receive timeout, check ctx
+			}
+			return count, fmt.Errorf("failed to read from %s: %w", opts.Interface, err)
+		}
+		dir := DirectionInbound
+		if ll, ok := from.(*unix.SockaddrLinklayer); ok && ll.Pkttype == unix.PACKET_OUTGOING {
+			dir = DirectionOutbound
+		}
+		if err = pw.WritePacket(timestamp(oob[:oobn]), buf[:min(n, len(buf))], n, dir); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// open creates the packet socket in the namespace of the interface,
+// it keeps receiving from that namespace after returning
+func open(opts Options) (int, error) {
+	var filter []unix.SockFilter
+	if opts.Host != "" {
+		var err error
+		if filter, err = HostFilter(opts.Host, opts.Snaplen); err != nil {
+			return -1, err
+		}
+	}
+
+	fd := -1
+	create := func() error {
+		link, err := netlink.LinkByName(opts.Interface)
+		if err != nil {
+			return fmt.Errorf("failed to get link by name: %v", err)
+		}
+		// protocol 0 receives nothing until bind, so no packet passes unfiltered
+		fd, err = unix.Socket(unix.AF_PACKET, unix.SOCK_RAW|unix.SOCK_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("failed to open packet socket: %w", err)
+		}
+		if filter != nil {
+			prog := &unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+			if err = unix.SetsockoptSockFprog(fd, unix.SOL_SOCKET, unix.SO_ATTACH_FILTER, prog); err != nil {
+				return fmt.Errorf("failed to attach filter: %w", err)
+			}
+		}
+		if err = unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_TIMESTAMPNS, 1); err != nil {
+			return fmt.Errorf("failed to enable timestamps: %w", err)
+		}
+		tv := unix.NsecToTimeval((200 * time.Millisecond).Nanoseconds())
+		if err = unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+			return fmt.Errorf("failed to set receive timeout: %w", err)
+		}
+		sa := &unix.SockaddrLinklayer{Protocol: htons(unix.ETH_P_ALL), Ifindex: link.Attrs().Index}
+		if err = unix.Bind(fd, sa); err != nil {
+			return fmt.Errorf("failed to bind to %s: %w", opts.Interface, err)
+		}
+		return nil
+	}
+
+	var err error
+	if opts.Netns == "" {
+		err = create()
+	} else {
+		var netns ns.NetNS
+		if netns, err = ns.GetNS(opts.Netns); err != nil {
+			return -1, fmt.Errorf("failed to get namespace %s: %v", opts.Netns, err)
+		}
+		err = netns.Do(func(_ ns.NetNS) error { return create() })
+		netns.Close()
+	}
+	if err != nil {
+		if fd >= 0 {
+			unix.Close(fd)
+		}
+		return -1, err
+	}
+	return fd, nil
+}
+
+// timestamp returns the kernel receive time from the control messages,
+// or now if there is none
+func timestamp(oob []byte) time.Time {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return time.Now()
+	}
+	for _, m := range msgs {
+		if m.Header.Level == unix.SOL_SOCKET && m.Header.Type == unix.SCM_TIMESTAMPNS && len(m.Data) >= 16 {
+			sec := int64(binary.NativeEndian.Uint64(m.Data[0:8]))
+			nsec := int64(binary.NativeEndian.Uint64(m.Data[8:16]))
+			return time.Unix(sec, nsec)
+		}
+	}
+	return time.Now()
+}
+
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
@@ -0,0 +1,125 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// pcapng block types and options, see
+// https://www.ietf.org/archive/id/draft-ietf-opsawg-pcapng-01.html
+const (
+	blockSHB = 0x0A0D0D0A
+	blockIDB = 0x00000001
+	blockEPB = 0x00000006
+
+	byteOrderMagic = 0x1A2B3C4D
+	linkTypeEther  = 1
+
+	optEnd        = 0
+	optUserAppl   = 4 // shb_userappl
+	optIfName     = 2 // if_name
+	optIfTsresol  = 9 // if_tsresol
+	optEpbFlags   = 2 // epb_flags
+	flagInbound   = 1
+	flagOutbound  = 2
+	tsResolutionN = 9 // timestamps in ns
+)
+
+// Direction of a captured packet as seen by the capturing interface
+type Direction int
+
+const (
+	DirectionUnknown Direction = iota
+	DirectionInbound
+	DirectionOutbound
+)
+
+// Writer writes a pcapng stream with one Ethernet interface,
+// every packet is written through to the underlying writer
+type Writer struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+// NewWriter writes the section header and the interface description
+func NewWriter(w io.Writer, ifName string, snaplen int) (*Writer, error) {
+	pw := &Writer{w: w}
+
+	var opts bytes.Buffer
+	writeOption(&opts, optUserAppl, []byte("Netlink"))
+	writeOption(&opts, optEnd, nil)
+	body := make([]byte, 16)
+	binary.LittleEndian.PutUint32(body[0:], byteOrderMagic)
+	binary.LittleEndian.PutUint16(body[4:], 1) // major version
+	binary.LittleEndian.PutUint16(body[6:], 0) // minor version
+	binary.LittleEndian.PutUint64(body[8:], ^uint64(0))
+	if err := pw.block(blockSHB, append(body, opts.Bytes()...)); err != nil {
+		return nil, err
+	}
+
+	opts.Reset()
+	writeOption(&opts, optIfName, []byte(ifName))
+	writeOption(&opts, optIfTsresol, []byte{tsResolutionN})
+	writeOption(&opts, optEnd, nil)
+	body = make([]byte, 8)
+	binary.LittleEndian.PutUint16(body[0:], linkTypeEther)
+	binary.LittleEndian.PutUint32(body[4:], uint32(snaplen))
+	if err := pw.block(blockIDB, append(body, opts.Bytes()...)); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+// WritePacket writes one packet, data may be truncated to the snaplen
+// and origLen is the length on the wire
+func (pw *Writer) WritePacket(ts time.Time, data []byte, origLen int, dir Direction) error {
+	ns := uint64(ts.UnixNano())
+	body := make([]byte, 20, 20+len(data)+16)
+	binary.LittleEndian.PutUint32(body[0:], 0) // interface id
+	binary.LittleEndian.PutUint32(body[4:], uint32(ns>>32))
+	binary.LittleEndian.PutUint32(body[8:], uint32(ns))
+	binary.LittleEndian.PutUint32(body[12:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(body[16:], uint32(origLen))
+	body = append(body, data...)
+	body = append(body, make([]byte, pad(len(data)))...)
+
+	if dir != DirectionUnknown {
+		var opts bytes.Buffer
+		flags := make([]byte, 4)
+		if dir == DirectionInbound {
+			binary.LittleEndian.PutUint32(flags, flagInbound)
+		} else {
+			binary.LittleEndian.PutUint32(flags, flagOutbound)
+		}
+		writeOption(&opts, optEpbFlags, flags)
+		writeOption(&opts, optEnd, nil)
+		body = append(body, opts.Bytes()...)
+	}
+	return pw.block(blockEPB, body)
+}
+
+// block frames body with the block type and the total length before and after
+func (pw *Writer) block(typ uint32, body []byte) error {
+	total := uint32(12 + len(body))
+	pw.buf.Reset()
+	_ = binary.Write(&pw.buf, binary.LittleEndian, typ)
+	_ = binary.Write(&pw.buf, binary.LittleEndian, total)
+	pw.buf.Write(body)
+	_ = binary.Write(&pw.buf, binary.LittleEndian, total)
+	_, err := pw.w.Write(pw.buf.Bytes())
+	return err
+}
+
+func writeOption(b *bytes.Buffer, code uint16, value []byte) {
+	_ = binary.Write(b, binary.LittleEndian, code)
+	_ = binary.Write(b, binary.LittleEndian, uint16(len(value)))
+	b.Write(value)
+	b.Write(make([]byte, pad(len(value))))
+}
+
+// pad returns the bytes needed to align n to 32 bits
+func pad(n int) int {
+	return (4 - n%4) % 4
+}
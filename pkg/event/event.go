@@ -0,0 +1,204 @@
+// Package event records every change of the topology as a structured
+// event, persisted as JSON lines and available to live subscribers.
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+)
+
+// operations
+const (
+	OpApply       = "apply"
+	OpNodeAdd     = "node.add"
+	OpNodeReplace = "node.replace"
+	OpNodeDelete  = "node.delete"
+	OpNodeRestart = "node.restart"
+	OpLinkAdd     = "link.add"
+	OpLinkUpdate  = "link.update"
+	OpLinkDelete  = "link.delete"
+	OpUndo        = "undo" // rolled back change of a group, routes or FRR
+	OpRollback    = "rollback"
+	OpRepair      = "repair"
+	OpDestroy     = "destroy"
+)
+
+// Properties are the configured properties of one link direction
+type Properties struct {
+	Rate    uint64  `json:"rate"`    // Mbps
+	Latency uint32  `json:"latency"` // ms
+	Loss    float32 `json:"loss"`    // percentage
+}
+
+// Link is a link direction
+type Link struct {
+	Src string `json:"src"`
+	Dst string `json:"dst"`
+}
+
+// Event is one change of the topology
+type Event struct {
+	Time     time.Time   `json:"time"`
+	Actor    string      `json:"actor"`
+	Op       string      `json:"op"`
+	Node     string      `json:"node,omitempty"`
+	Link     *Link       `json:"link,omitempty"`
+	Old      *Properties `json:"old,omitempty"`
+	New      *Properties `json:"new,omitempty"`
+	Duration float64     `json:"durationMs"`
+	Error    string      `json:"error,omitempty"`
+	Rollback bool        `json:"rollback,omitempty"` // undoes a change of a failed transaction
+}
+
+type actorKey struct{}
+
+// WithActor names who causes the events emitted with ctx
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// Actor returns the actor of ctx, the user running the process by default
+func Actor(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return "unknown"
+}
+
+// historySize is the number of recent events kept for History
+const historySize = 1000
+
+// Bus delivers events to the sinks and subscribers, a subscriber that
+// does not keep up misses events instead of blocking the emulator
+type Bus struct {
+	mu      sync.Mutex
+	sinks   map[string]io.WriteCloser
+	subs    map[chan Event]struct{}
+	history []Event
+}
+
+// NewBus creates a Bus without files or subscribers
+func NewBus() *Bus {
+	return &Bus{
+		sinks: make(map[string]io.WriteCloser),
+		subs:  make(map[chan Event]struct{}),
+	}
+}
+
+// Emit stamps e with the time and actor and publishes it
+func (b *Bus) Emit(ctx context.Context, e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.Actor == "" {
+		e.Actor = Actor(ctx)
+	}
+	line, _ := json.Marshal(e)
+	line = append(line, '\n')
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.history = append(b.history, e)
+	if len(b.history) > historySize {
+		b.history = b.history[len(b.history)-historySize:]
+	}
+	for _, w := range b.sinks {
+		_, _ = w.Write(line)
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Since returns the time elapsed since start in ms, for Event.Duration
+func Since(start time.Time) float64 {
+	return float64(time.Since(start).Microseconds()) / 1000
+}
+
+// History returns the most recent events, oldest first
+func (b *Bus) History() []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Event{}, b.history...)
+}
+
+// Subscribe returns a channel receiving every following event
+// until cancel is called
+func (b *Bus) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// OpenFile appends every following event to path as JSON lines
+func (b *Bus) OpenFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if old, ok := b.sinks[path]; ok {
+		_ = old.Close()
+	}
+	b.sinks[path] = f
+	return nil
+}
+
+// CloseFile stops writing to path
+func (b *Bus) CloseFile(path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	f, ok := b.sinks[path]
+	if !ok {
+		return os.ErrNotExist
+	}
+	delete(b.sinks, path)
+	return f.Close()
+}
+
+// Files returns the paths events are written to
+func (b *Bus) Files() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	paths := make([]string, 0, len(b.sinks))
+	for path := range b.sinks {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// Close closes all files, subscribers keep their channels
+func (b *Bus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var first error
+	for path, f := range b.sinks {
+		if err := f.Close(); err != nil && first == nil {
+			first = err
+		}
+		delete(b.sinks, path)
+	}
+	return first
+}
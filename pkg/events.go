@@ -0,0 +1,46 @@
+package pkg
+
+import (
+	"Netlink/api"
+	"Netlink/pkg/event"
+	"context"
+	"log/slog"
+)
+
+// Events returns the bus every change of the topology is emitted on
+func (m *Manager) Events() *event.Bus {
+	return m.events
+}
+
+// emit publishes and logs e, err is recorded as the outcome of the operation
+func (m *Manager) emit(ctx context.Context, e event.Event, err error) {
+	attrs := []slog.Attr{slog.String("op", e.Op), slog.Float64("durationMs", e.Duration)}
+	if e.Node != "" {
+		attrs = append(attrs, slog.String("node", e.Node))
+		if n, ok := m.lookupNode(e.Node); ok && n.NetNs != "" {
+			attrs = append(attrs, slog.String("netns", n.NetNs))
+		}
+	}
+	if e.Link != nil {
+		attrs = append(attrs, slog.String("link", e.Link.Src+"->"+e.Link.Dst))
+	}
+	if e.New != nil {
+		attrs = append(attrs, slog.Uint64("rate", e.New.Rate), slog.Any("latency", e.New.Latency), slog.Any("loss", e.New.Loss))
+	}
+	if e.Rollback {
+		attrs = append(attrs, slog.Bool("rollback", true))
+	}
+
+	level, msg := slog.LevelInfo, e.Op
+	if err != nil {
+		e.Error = err.Error()
+		level, msg = slog.LevelError, e.Op+" failed"
+		attrs = append(attrs, slog.String("err", e.Error))
+	}
+	m.log.LogAttrs(ctx, level, msg, attrs...)
+	m.events.Emit(ctx, e)
+}
+
+func eventProperties(p api.LinkProperties) *event.Properties {
+	return &event.Properties{Rate: p.Rate, Latency: p.Latency, Loss: p.Loss}
+}
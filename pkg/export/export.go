@@ -0,0 +1,331 @@
+// Package export writes the applied topology as Graphviz DOT, GraphML,
+// Mermaid or NetworkX node-link JSON.
+package export
+
+import (
+	"Netlink/api"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	FormatDOT     = "dot"
+	FormatGraphML = "graphml"
+	FormatMermaid = "mermaid"
+	FormatJSON    = "json"
+)
+
+// Edge is a link between two nodes, Bidirectional is set when
+// both directions exist with equal properties
+type Edge struct {
+	Src           string
+	Dst           string
+	Properties    api.LinkProperties
+	Bidirectional bool
+}
+
+// Graph is the exported view of a topology
+type Graph struct {
+	Nodes    []api.Node
+	Edges    []Edge
+	Directed bool // at least one edge is not bidirectional
+}
+
+// NewGraph merges the per-direction links of nodes into edges
+func NewGraph(nodes []api.Node, links []api.Link) Graph {
+	g := Graph{Nodes: nodes}
+	props := make(map[[2]string]api.LinkProperties, len(links))
+	for _, l := range links {
+		props[[2]string{l.SrcNode, l.DstNode}] = l.Properties
+	}
+	done := make(map[[2]string]bool, len(links))
+	for _, l := range links {
+		key := [2]string{l.SrcNode, l.DstNode}
+		if done[key] {
+			continue
+		}
+		done[key] = true
+		e := Edge{Src: l.SrcNode, Dst: l.DstNode, Properties: l.Properties}
+		reverse := [2]string{l.DstNode, l.SrcNode}
+		if p, ok := props[reverse]; ok && !done[reverse] && sameProperties(p, l.Properties) {
+			done[reverse] = true
+			e.Bidirectional = true
+		} else {
+			g.Directed = true
+		}
+		g.Edges = append(g.Edges, e)
+	}
+	return g
+}
+
+// Write renders g in format
+func Write(w io.Writer, format string, g Graph) error {
+	switch format {
+	case FormatDOT:
+		return writeDOT(w, g)
+	case FormatGraphML:
+		return writeGraphML(w, g)
+	case FormatMermaid:
+		return writeMermaid(w, g)
+	case FormatJSON:
+		return writeJSON(w, g)
+	default:
+		return fmt.Errorf("unknown export format %q, expected dot, graphml, mermaid or json", format)
+	}
+}
+
+func sameProperties(a, b api.LinkProperties) bool {
+	return a.Rate == b.Rate && a.Latency == b.Latency && a.Loss == b.Loss
+}
+
+// directedEdges expands bidirectional edges into one edge per direction
+func directedEdges(edges []Edge) []Edge {
+	var res []Edge
+	for _, e := range edges {
+		res = append(res, Edge{Src: e.Src, Dst: e.Dst, Properties: e.Properties})
+		if e.Bidirectional {
+			res = append(res, Edge{Src: e.Dst, Dst: e.Src, Properties: e.Properties})
+		}
+	}
+	return res
+}
+
+// edgeLabel summarizes the configured properties, e.g. "100Mbps 5ms 1%"
+func edgeLabel(p api.LinkProperties) string {
+	var parts []string
+	if p.Rate > 0 {
+		parts = append(parts, fmt.Sprintf("%dMbps", p.Rate))
+	}
+	if p.Latency > 0 {
+		parts = append(parts, fmt.Sprintf("%dms", p.Latency))
+	}
+	if p.Loss > 0 {
+		parts = append(parts, strconv.FormatFloat(float64(p.Loss), 'f', -1, 32)+"%")
+	}
+	return strings.Join(parts, " ")
+}
+
+func writeDOT(w io.Writer, g Graph) error {
+	kind, op := "graph", "--"
+	if g.Directed {
+		kind, op = "digraph", "->"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s topology {\n", kind)
+	b.WriteString("  node [shape=box];\n")
+	for _, n := range g.Nodes {
+		label := n.Name
+		if n.Interface.Ipv4 != "" {
+			label += "\n" + n.Interface.Ipv4
+		}
+		fmt.Fprintf(&b, "  %q [label=%q, ip=%q, image=%q];\n", n.Name, label, n.Interface.Ipv4, n.Image)
+	}
+	for _, e := range g.Edges {
+		attrs := []string{
+			fmt.Sprintf("label=%q", edgeLabel(e.Properties)),
+			fmt.Sprintf("rate=%d", e.Properties.Rate),
+			fmt.Sprintf("latency=%d", e.Properties.Latency),
+			fmt.Sprintf("loss=%g", e.Properties.Loss),
+		}
+		if g.Directed && e.Bidirectional {
+			attrs = append(attrs, "dir=both")
+		}
+		fmt.Fprintf(&b, "  %q %s %q [%s];\n", e.Src, op, e.Dst, strings.Join(attrs, ", "))
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeMermaid(w io.Writer, g Graph) error {
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	ids := make(map[string]string, len(g.Nodes))
+	for i, n := range g.Nodes {
+		ids[n.Name] = fmt.Sprintf("n%d", i)
+		label := n.Name
+		if n.Interface.Ipv4 != "" {
+			label += "<br/>" + n.Interface.Ipv4
+		}
+		fmt.Fprintf(&b, "  %s[\"%s\"]\n", ids[n.Name], label)
+	}
+	for _, e := range g.Edges {
+		arrow := "---"
+		if g.Directed {
+			arrow = "-->"
+			if e.Bidirectional {
+				arrow = "<-->"
+			}
+		}
+		if label := edgeLabel(e.Properties); label != "" {
+			fmt.Fprintf(&b, "  %s %s|\"%s\"| %s\n", mermaidID(ids, e.Src), arrow, label, mermaidID(ids, e.Dst))
+		} else {
+			fmt.Fprintf(&b, "  %s %s %s\n", mermaidID(ids, e.Src), arrow, mermaidID(ids, e.Dst))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// mermaidID falls back to the name for edges whose node is not exported
+func mermaidID(ids map[string]string, name string) string {
+	if id, ok := ids[name]; ok {
+		return id
+	}
+	return name
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// writeGraphML emits one edge per direction when the graph is directed,
+// as NetworkX does not accept mixed edge directions
+func writeGraphML(w io.Writer, g Graph) error {
+	doc := graphML{
+		Xmlns: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "ip", For: "node", AttrName: "ip", AttrType: "string"},
+			{ID: "image", For: "node", AttrName: "image", AttrType: "string"},
+			{ID: "uid", For: "node", AttrName: "uid", AttrType: "int"},
+			{ID: "rate", For: "edge", AttrName: "rate", AttrType: "long"},
+			{ID: "latency", For: "edge", AttrName: "latency", AttrType: "int"},
+			{ID: "loss", For: "edge", AttrName: "loss", AttrType: "double"},
+		},
+		Graph: graphMLGraph{ID: "topology", EdgeDefault: "undirected"},
+	}
+	for _, n := range g.Nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{
+			ID: n.Name,
+			Data: []graphMLData{
+				{Key: "ip", Value: n.Interface.Ipv4},
+				{Key: "image", Value: n.Image},
+				{Key: "uid", Value: strconv.Itoa(n.Uid)},
+			},
+		})
+	}
+	edges := g.Edges
+	if g.Directed {
+		doc.Graph.EdgeDefault = "directed"
+		edges = directedEdges(edges)
+	}
+	for _, e := range edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			Source: e.Src,
+			Target: e.Dst,
+			Data: []graphMLData{
+				{Key: "rate", Value: strconv.FormatUint(e.Properties.Rate, 10)},
+				{Key: "latency", Value: strconv.FormatUint(uint64(e.Properties.Latency), 10)},
+				{Key: "loss", Value: strconv.FormatFloat(float64(e.Properties.Loss), 'f', -1, 32)},
+			},
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// NodeLinkGraph is the NetworkX node-link JSON format
+// (networkx.node_link_graph / node_link_data with edges="links")
+type NodeLinkGraph struct {
+	Directed   bool                   `json:"directed"`
+	Multigraph bool                   `json:"multigraph"`
+	Graph      map[string]interface{} `json:"graph"`
+	Nodes      []NodeLinkNode         `json:"nodes"`
+	Links      []NodeLinkEdge         `json:"links"`
+}
+
+type NodeLinkNode struct {
+	ID     string            `json:"id"`
+	IP     string            `json:"ip,omitempty"`
+	Image  string            `json:"image,omitempty"`
+	Uid    int               `json:"uid,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type NodeLinkEdge struct {
+	Source  string  `json:"source"`
+	Target  string  `json:"target"`
+	Rate    uint64  `json:"rate,omitempty"`    // in mbps
+	Latency uint32  `json:"latency,omitempty"` // in ms
+	Loss    float32 `json:"loss,omitempty"`    // in percentage
+}
+
+func writeJSON(w io.Writer, g Graph) error {
+	doc := NodeLinkGraph{
+		Directed: g.Directed,
+		Graph:    map[string]interface{}{},
+		Nodes:    []NodeLinkNode{},
+		Links:    []NodeLinkEdge{},
+	}
+	for _, n := range g.Nodes {
+		doc.Nodes = append(doc.Nodes, NodeLinkNode{
+			ID:     n.Name,
+			IP:     n.Interface.Ipv4,
+			Image:  n.Image,
+			Uid:    n.Uid,
+			Labels: n.Labels,
+		})
+	}
+	edges := g.Edges
+	if g.Directed {
+		edges = directedEdges(edges)
+	}
+	for _, e := range edges {
+		doc.Links = append(doc.Links, NodeLinkEdge{
+			Source:  e.Src,
+			Target:  e.Dst,
+			Rate:    e.Properties.Rate,
+			Latency: e.Properties.Latency,
+			Loss:    e.Properties.Loss,
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,115 @@
+package export_test
+
+import (
+	"Netlink/api"
+	"Netlink/pkg/export"
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+var nodes = []api.Node{
+	{Name: "node1", Uid: 1, Image: "frr:v4", Labels: map[string]string{"role": "spine"}, Interface: api.NodeInterface{Ipv4: "192.168.10.1/24"}},
+	{Name: "node2", Uid: 2, Image: "frr:v4", Interface: api.NodeInterface{Ipv4: "192.168.10.2/24"}},
+	{Name: "node3", Uid: 3, Image: "frr:v4", Interface: api.NodeInterface{Ipv4: "192.168.10.3/24"}},
+}
+
+// link returns the direction src -> dst as Manager.LinkList does
+func link(src, dst string, rate uint64, latency uint32, loss float32) api.Link {
+	return api.Link{SrcNode: src, DstNode: dst, Properties: api.LinkProperties{Rate: rate, Latency: latency, Loss: loss, HTBClassid: 0x10003}}
+}
+
+func TestNewGraph(t *testing.T) {
+	tests := []struct {
+		name     string
+		links    []api.Link
+		edges    []export.Edge
+		directed bool
+	}{
+		{
+			name:  "equal directions merge",
+			links: []api.Link{link("node1", "node2", 100, 5, 0), link("node2", "node1", 100, 5, 0)},
+			edges: []export.Edge{{Src: "node1", Dst: "node2", Bidirectional: true, Properties: link("node1", "node2", 100, 5, 0).Properties}},
+		},
+		{
+			name:  "different directions stay apart",
+			links: []api.Link{link("node1", "node2", 100, 5, 0), link("node2", "node1", 100, 5, 1)},
+			edges: []export.Edge{
+				{Src: "node1", Dst: "node2", Properties: link("node1", "node2", 100, 5, 0).Properties},
+				{Src: "node2", Dst: "node1", Properties: link("node2", "node1", 100, 5, 1).Properties},
+			},
+			directed: true,
+		},
+		{
+			name:     "single direction",
+			links:    []api.Link{link("node1", "node2", 0, 0, 0)},
+			edges:    []export.Edge{{Src: "node1", Dst: "node2", Properties: link("node1", "node2", 0, 0, 0).Properties}},
+			directed: true,
+		},
+		{
+			// runtime fields such as the classid do not prevent a merge
+			name: "runtime fields ignored",
+			links: []api.Link{link("node1", "node2", 10, 0, 0),
+				{SrcNode: "node2", DstNode: "node1", Properties: api.LinkProperties{Rate: 10, HTBClassid: 0x10004}}},
+			edges: []export.Edge{{Src: "node1", Dst: "node2", Bidirectional: true, Properties: link("node1", "node2", 10, 0, 0).Properties}},
+		},
+	}
+	for _, tt := range tests {
+		g := export.NewGraph(nodes, tt.links)
+		if !reflect.DeepEqual(g.Edges, tt.edges) || g.Directed != tt.directed {
+			t.Errorf("%s: edges %+v directed %v, want %+v %v", tt.name, g.Edges, g.Directed, tt.edges, tt.directed)
+		}
+	}
+}
+
+func TestWriteGolden(t *testing.T) {
+	graphs := map[string][]api.Link{
+		// every link has two equal directions
+		"undirected": {
+			link("node1", "node2", 100, 5, 0), link("node2", "node1", 100, 5, 0),
+			link("node2", "node3", 0, 10, 0.5), link("node3", "node2", 0, 10, 0.5),
+		},
+		// node2 -> node3 differs and node3 -> node1 has no reverse
+		"directed": {
+			link("node1", "node2", 100, 5, 0), link("node2", "node1", 100, 5, 0),
+			link("node2", "node3", 1000, 0, 0), link("node3", "node2", 10, 0, 0),
+			link("node3", "node1", 0, 1, 0),
+		},
+	}
+	ext := map[string]string{
+		export.FormatDOT:     ".dot",
+		export.FormatGraphML: ".graphml",
+		export.FormatMermaid: ".mmd",
+		export.FormatJSON:    ".json",
+	}
+	for name, links := range graphs {
+		for format, suffix := range ext {
+			var out bytes.Buffer
+			if err := export.Write(&out, format, export.NewGraph(nodes, links)); err != nil {
+				t.Fatalf("%s %s: %v", name, format, err)
+			}
+			golden := filepath.Join("testdata", name+suffix)
+			if *update {
+				if err := os.WriteFile(golden, out.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				continue
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out.Bytes(), want) {
+				t.Errorf("%s differs, run go test -update to rewrite it:\n%s", golden, out.String())
+			}
+		}
+	}
+	if err := export.Write(&bytes.Buffer{}, "png", export.Graph{}); err == nil {
+		t.Error("unknown format written")
+	}
+}
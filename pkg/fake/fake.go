@@ -0,0 +1,119 @@
+// Package fake provides in-memory implementations of the node runtime,
+// traffic control and switch of pkg.Manager. They keep the state the
+// kernel, OVS and docker would hold and record every operation, so the
+// orchestration can be tested without root and Manager.Plan can run
+// Apply without changing anything:
+//
+//	f := fake.New()
+//	m, err := pkg.NewManager(ctx, pkg.Config{
+//		Switch:         f.Switch,
+//		Runtime:        f.Runtime,
+//		TrafficControl: f.TrafficControl,
+//	})
+package fake
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Op is one recorded operation, Detail holds its arguments
+type Op struct {
+	Method string
+	Node   string
+	Detail string
+}
+
+func (o Op) String() string {
+	s := o.Method + " " + o.Node
+	if o.Detail != "" {
+		s += " " + o.Detail
+	}
+	return s
+}
+
+// Ops is the log of operations shared by the fakes of one Fakes, it also
+// holds the errors injected with Fail
+type Ops struct {
+	mu   sync.Mutex
+	ops  []Op
+	fail map[string]error
+}
+
+// record appends the operation and returns the error injected for it
+func (o *Ops) record(method, node, format string, args ...interface{}) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.ops = append(o.ops, Op{Method: method, Node: node, Detail: fmt.Sprintf(format, args...)})
+	if err, ok := o.fail[method+" "+node]; ok {
+		return err
+	}
+	return o.fail[method]
+}
+
+// Fail makes method fail with err, for node only if node is not empty,
+// a nil err removes the failure
+func (o *Ops) Fail(method, node string, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	key := strings.TrimSpace(method + " " + node)
+	if err == nil {
+		delete(o.fail, key)
+		return
+	}
+	o.fail[key] = err
+}
+
+// All returns the recorded operations in order
+func (o *Ops) All() []Op {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]Op{}, o.ops...)
+}
+
+// Method returns the recorded operations of method in order
+func (o *Ops) Method(method string) []Op {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var ops []Op
+	for _, op := range o.ops {
+		if op.Method == method {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
+// Reset forgets the recorded operations, injected failures are kept
+func (o *Ops) Reset() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.ops = nil
+}
+
+// Fakes is a switch, runtime and traffic control recording to one Ops
+type Fakes struct {
+	Ops            *Ops
+	Switch         *Switch
+	Runtime        *Runtime
+	TrafficControl *TrafficControl
+}
+
+// New creates fakes for an empty topology
+func New() *Fakes {
+	return NewBridge("fake-br0", "")
+}
+
+// NewBridge creates fakes for an empty topology on bridge, addresses
+// are assigned from ipPool as by NewRuntime
+func NewBridge(bridge, ipPool string) *Fakes {
+	ops := &Ops{fail: make(map[string]error)}
+	sw := NewSwitch(bridge, ops)
+	return &Fakes{
+		Ops:            ops,
+		Switch:         sw,
+		Runtime:        NewRuntime(sw, ipPool, ops),
+		TrafficControl: NewTrafficControl(ops),
+	}
+}
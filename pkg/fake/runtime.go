@@ -0,0 +1,278 @@
+package fake
+
+import (
+	"Netlink/api"
+	"Netlink/pkg/node"
+	"Netlink/pkg/ovs"
+	"Netlink/pkg/util"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Runtime creates nodes as entries of a map, attached to a Switch
+// like node.ContainerManager attaches containers to OVS
+type Runtime struct {
+	mu     sync.Mutex
+	ops    *Ops
+	sw     *Switch
+	seq    int
+	ipPool string
+	nodes  map[string]api.Node
+	// restarted are the nodes whose container was restarted with Restart
+	// and not re-plumbed yet
+	restarted map[string]bool
+	restarts  chan string
+}
+
+// NewRuntime creates a runtime without nodes, an empty ipPool
+// falls back to util.DefaultIPPool
+func NewRuntime(sw *Switch, ipPool string, ops *Ops) *Runtime {
+	if ipPool == "" {
+		ipPool = util.DefaultIPPool
+	}
+	return &Runtime{
+		ops:    ops,
+		sw:     sw,
+		seq:    1,
+		ipPool: ipPool,
+		nodes:  make(map[string]api.Node),
+
+		restarted: make(map[string]bool),
+		restarts:  make(chan string),
+	}
+}
+
+func (r *Runtime) AddNode(ctx context.Context, n *api.Node) error {
+	if n.Uid == 0 {
+		n.Uid = r.ReserveUid()
+	}
+	ip, err := node.Address(n.Interface.Ipv4, r.ipPool, n.Uid)
+	if err != nil {
+		return err
+	}
+	n.Interface.Ipv4 = ip
+	if err := r.ops.record("AddNode", n.Name, "uid=%d ipv4=%s", n.Uid, ip); err != nil {
+		return err
+	}
+	return r.create(n)
+}
+
+func (r *Runtime) RestoreNode(ctx context.Context, n *api.Node) error {
+	r.mu.Lock()
+	if n.Uid >= r.seq {
+		r.seq = n.Uid + 1
+	}
+	r.mu.Unlock()
+	if err := r.ops.record("RestoreNode", n.Name, "uid=%d ipv4=%s", n.Uid, n.Interface.Ipv4); err != nil {
+		return err
+	}
+	return r.create(n)
+}
+
+// create stores n and attaches it, like node.ContainerManager a failure
+// after the node was stored deletes it again
+func (r *Runtime) create(n *api.Node) (err error) {
+	r.mu.Lock()
+	if _, ok := r.nodes[n.Name]; ok {
+		r.mu.Unlock()
+		return fmt.Errorf("node %s already exists", n.Name)
+	}
+	n.NetNs = "/fake/netns/" + n.Name
+	n.Interface.Name = n.Name + node.NodeVethSuffix
+	n.Interface.NodeName = n.Name
+	n.Interface.Mac = node.Mac(n.Uid)
+	r.nodes[n.Name] = *n
+	r.mu.Unlock()
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, r.DeleteNode(context.Background(), n))
+		}
+	}()
+
+	vethOvs := n.Name + ovs.VethOvsSideSuffix
+	if err = r.sw.AddPort(vethOvs); err != nil {
+		return err
+	}
+	if err = r.sw.AddGroupTable(vethOvs, n.Uid); err != nil {
+		return err
+	}
+	port, err := r.sw.PortId(vethOvs)
+	n.Interface.OvsPort = port
+	return err
+}
+
+func (r *Runtime) DeleteNode(ctx context.Context, n *api.Node) error {
+	if err := r.ops.record("DeleteNode", n.Name, "uid=%d", n.Uid); err != nil {
+		return err
+	}
+	vethOvs := n.Name + ovs.VethOvsSideSuffix
+	if n.Uid > 0 {
+		port, _ := r.sw.PortId(vethOvs)
+		if err := r.sw.DeleteGroupTable(port, n.Uid); err != nil {
+			return err
+		}
+	}
+	if err := r.sw.DeletePort(vethOvs); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.nodes, n.Name)
+	return nil
+}
+
+// Restart restarts the container of the running node name: it loses its
+// port and group until it is re-plumbed, and reports it to WatchRestarts
+func (r *Runtime) Restart(ctx context.Context, name string) error {
+	r.mu.Lock()
+	n, ok := r.nodes[name]
+	if ok {
+		r.restarted[name] = true
+	}
+	r.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("node %s is not running", name)
+	}
+	vethOvs := name + ovs.VethOvsSideSuffix
+	port, _ := r.sw.PortId(vethOvs)
+	if err := r.sw.DeleteGroupTable(port, n.Uid); err != nil {
+		return err
+	}
+	if err := r.sw.DeletePort(vethOvs); err != nil {
+		return err
+	}
+	select {
+	case r.restarts <- name:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WatchRestarts returns the names of the nodes restarted with Restart
+// until ctx is done
+func (r *Runtime) WatchRestarts(ctx context.Context) <-chan string {
+	out := make(chan string)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case name := <-r.restarts:
+				select {
+				case out <- name:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Replumb attaches a node restarted with Restart to the switch again
+func (r *Runtime) Replumb(ctx context.Context, n *api.Node) (bool, error) {
+	r.mu.Lock()
+	restarted := r.restarted[n.Name]
+	delete(r.restarted, n.Name)
+	r.mu.Unlock()
+	if !restarted {
+		return false, nil
+	}
+	if err := r.ops.record("Replumb", n.Name, "uid=%d ipv4=%s", n.Uid, n.Interface.Ipv4); err != nil {
+		return true, err
+	}
+	vethOvs := n.Name + ovs.VethOvsSideSuffix
+	if err := r.sw.AddPort(vethOvs); err != nil {
+		return true, err
+	}
+	if err := r.sw.AddGroupTable(vethOvs, n.Uid); err != nil {
+		return true, err
+	}
+	port, err := r.sw.PortId(vethOvs)
+	n.Interface.OvsPort = port
+	return true, err
+}
+
+func (r *Runtime) SetDefaultRoute(n api.Node, gw string) error {
+	return r.ops.record("SetDefaultRoute", n.Name, "via=%s", gw)
+}
+
+// SetRoutes records the routes, formatted as dst>via
+func (r *Runtime) SetRoutes(n api.Node, routes []api.Route) error {
+	return r.ops.record("SetRoutes", n.Name, "%s", describeRoutes(routes))
+}
+
+func describeRoutes(routes []api.Route) string {
+	parts := make([]string, len(routes))
+	for i, route := range routes {
+		parts[i] = route.Dst + ">" + route.Via
+	}
+	return strings.Join(parts, ",")
+}
+
+// SetFrr records the daemons enabled by daemons, the configuration is
+// the FrrConf of the node
+func (r *Runtime) SetFrr(ctx context.Context, n api.Node, conf, daemons string) error {
+	var enabled []string
+	for _, line := range strings.Split(daemons, "\n") {
+		// settings such as vtysh_enable have an underscore, daemons not
+		if name, ok := strings.CutSuffix(line, "=yes"); ok && !strings.Contains(name, "_") {
+			enabled = append(enabled, name)
+		}
+	}
+	return r.ops.record("SetFrr", n.Name, "%s", strings.Join(enabled, ","))
+}
+
+// EnsureImages records the image of every container node, a failure
+// injected for a node fails its image
+func (r *Runtime) EnsureImages(ctx context.Context, nodes []api.Node) error {
+	var errs []error
+	for _, n := range nodes {
+		if n.Kind != "" && n.Kind != api.KindContainer {
+			continue
+		}
+		if err := r.ops.record("EnsureImages", n.Name, "image=%s policy=%s", n.Image, n.ImagePullPolicy); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Runtime) ReserveUid() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	uid := r.seq
+	r.seq++
+	return uid
+}
+
+func (r *Runtime) NextUid() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.seq
+}
+
+// SetNextUid makes uid the next Uid ReserveUid returns, as in a runtime
+// that already reserved the Uids below it
+func (r *Runtime) SetNextUid(uid int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq = uid
+}
+
+func (r *Runtime) Close() error {
+	return nil
+}
+
+// Node returns the running node with the given name
+func (r *Runtime) Node(name string) (api.Node, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n, ok := r.nodes[name]
+	return n, ok
+}
@@ -0,0 +1,205 @@
+package fake
+
+import (
+	"Netlink/api"
+	"Netlink/pkg/ovs"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Switch is an in-memory OVS bridge with one group and flow per node
+type Switch struct {
+	mu     sync.Mutex
+	ops    *Ops
+	bridge string
+	ports  map[string]int   // port name -> OpenFlow port
+	groups map[int][]string // group -> output ports of the buckets
+	flows  map[int]int      // in_port -> group
+	next   int
+}
+
+// NewSwitch creates an empty bridge recording to ops
+func NewSwitch(bridge string, ops *Ops) *Switch {
+	return &Switch{
+		ops:    ops,
+		bridge: bridge,
+		ports:  make(map[string]int),
+		groups: make(map[int][]string),
+		flows:  make(map[int]int),
+		next:   1,
+	}
+}
+
+func (s *Switch) Bridge() string {
+	return s.bridge
+}
+
+// AddPort attaches port, as the runtime does with the host side of the veth
+func (s *Switch) AddPort(port string) error {
+	if err := s.ops.record("AddPort", nodeOf(port), "port=%s", port); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.ports[port]; ok {
+		return fmt.Errorf("port %s already exists on %s", port, s.bridge)
+	}
+	s.ports[port] = s.next
+	s.next++
+	return nil
+}
+
+// DeletePort detaches port, a missing port is not an error
+func (s *Switch) DeletePort(port string) error {
+	if err := s.ops.record("DeletePort", nodeOf(port), "port=%s", port); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.ports, port)
+	return nil
+}
+
+func (s *Switch) PortId(port string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.ports[port]
+	if !ok {
+		return -1, fmt.Errorf("port %s not found on %s", port, s.bridge)
+	}
+	return id, nil
+}
+
+func (s *Switch) AddFlowsByLink(src api.Node, output string) error {
+	if err := s.ops.record("AddFlowsByLink", src.Name, "group=%d%s", src.Uid, output); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.groups[src.Uid]; !ok {
+		return fmt.Errorf("group %d not found on %s", src.Uid, s.bridge)
+	}
+	ports := []string{}
+	for _, bucket := range strings.Split(output, ",bucket=output:") {
+		if bucket = strings.Trim(bucket, "\""); bucket != "" {
+			ports = append(ports, bucket)
+		}
+	}
+	s.groups[src.Uid] = ports
+	return nil
+}
+
+func (s *Switch) AddGroupTable(port string, group int) error {
+	if err := s.ops.record("AddGroupTable", nodeOf(port), "group=%d port=%s", group, port); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.groups[group]; ok {
+		return fmt.Errorf("group %d already exists on %s", group, s.bridge)
+	}
+	inPort, ok := s.ports[port]
+	if !ok {
+		return fmt.Errorf("port %s not found on %s", port, s.bridge)
+	}
+	s.groups[group] = []string{}
+	s.flows[inPort] = group
+	return nil
+}
+
+func (s *Switch) DeleteGroupTable(inPort int, group int) error {
+	s.mu.Lock()
+	name := ""
+	for port, id := range s.ports {
+		if id == inPort {
+			name = nodeOf(port)
+		}
+	}
+	s.mu.Unlock()
+	if err := s.ops.record("DeleteGroupTable", name, "group=%d in_port=%d", group, inPort); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if inPort > 0 {
+		delete(s.flows, inPort)
+	}
+	delete(s.groups, group)
+	return nil
+}
+
+func (s *Switch) DumpGroups() (map[int][]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	groups := make(map[int][]string, len(s.groups))
+	for id, ports := range s.groups {
+		groups[id] = append([]string{}, ports...)
+	}
+	return groups, nil
+}
+
+func (s *Switch) DumpFlows() (map[string]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	flows := make(map[string]int, len(s.flows))
+	for port, id := range s.ports {
+		if group, ok := s.flows[id]; ok {
+			flows[port] = group
+		}
+	}
+	return flows, nil
+}
+
+// DumpPortStats returns zero counters for every port
+func (s *Switch) DumpPortStats() (map[string]ovs.PortStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := make(map[string]ovs.PortStats, len(s.ports))
+	for port := range s.ports {
+		stats[port] = ovs.PortStats{}
+	}
+	return stats, nil
+}
+
+// DumpGroupStats returns zero counters for every group
+func (s *Switch) DumpGroupStats() (map[int]ovs.GroupStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := make(map[int]ovs.GroupStats, len(s.groups))
+	for id := range s.groups {
+		stats[id] = ovs.GroupStats{}
+	}
+	return stats, nil
+}
+
+func (s *Switch) DeleteBridge() error {
+	if err := s.ops.record("DeleteBridge", "", "bridge=%s", s.bridge); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ports = make(map[string]int)
+	s.groups = make(map[int][]string)
+	s.flows = make(map[int]int)
+	return nil
+}
+
+// Buckets returns the output ports of the group of a node, sorted
+func (s *Switch) Buckets(group int) ([]string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ports, ok := s.groups[group]
+	if !ok {
+		return nil, false
+	}
+	ports = append([]string{}, ports...)
+	sort.Strings(ports)
+	return ports, true
+}
+
+// nodeOf returns the node of the host side of a veth
+func nodeOf(port string) string {
+	return strings.TrimSuffix(port, ovs.VethOvsSideSuffix)
+}
@@ -0,0 +1,150 @@
+package fake
+
+import (
+	"Netlink/api"
+	"Netlink/pkg/link"
+	"fmt"
+	"sync"
+)
+
+// TrafficControl keeps the root qdisc and classes of every node
+type TrafficControl struct {
+	mu      sync.Mutex
+	ops     *Ops
+	root    map[string]bool
+	classes map[string]map[uint32]api.LinkProperties // node -> classid -> properties
+}
+
+// NewTrafficControl creates a traffic control without qdiscs
+func NewTrafficControl(ops *Ops) *TrafficControl {
+	return &TrafficControl{
+		ops:     ops,
+		root:    make(map[string]bool),
+		classes: make(map[string]map[uint32]api.LinkProperties),
+	}
+}
+
+func (t *TrafficControl) CreateRootQdisc(n api.Node) error {
+	if err := t.ops.record("CreateRootQdisc", n.Name, ""); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// a recreated node starts with an empty veth
+	t.root[n.Name] = true
+	t.classes[n.Name] = make(map[uint32]api.LinkProperties)
+	return nil
+}
+
+func (t *TrafficControl) AddHtbClass(n api.Node, props api.LinkProperties) error {
+	if err := t.ops.record("AddHtbClass", n.Name, "%s", describe(props)); err != nil {
+		return err
+	}
+	if _, err := link.MacKeys(props.DstMac); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.root[n.Name] {
+		return fmt.Errorf("no root qdisc on %s", n.Name)
+	}
+	if _, ok := t.classes[n.Name][props.HTBClassid]; ok {
+		return fmt.Errorf("class %x already exists on %s", props.HTBClassid, n.Name)
+	}
+	t.classes[n.Name][props.HTBClassid] = props
+	return nil
+}
+
+func (t *TrafficControl) ReplaceHtbClass(n api.Node, old, props api.LinkProperties) error {
+	if err := t.ops.record("ReplaceHtbClass", n.Name, "%s", describe(props)); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.classes[n.Name][props.HTBClassid]; !ok {
+		return fmt.Errorf("class %x not found on %s", props.HTBClassid, n.Name)
+	}
+	t.classes[n.Name][props.HTBClassid] = props
+	return nil
+}
+
+func (t *TrafficControl) DeleteHtbClass(n api.Node, props api.LinkProperties) error {
+	if props.HTBClassid == 0 {
+		return nil
+	}
+	if err := t.ops.record("DeleteHtbClass", n.Name, "class=%x", props.HTBClassid); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.classes[n.Name], props.HTBClassid)
+	return nil
+}
+
+func (t *TrafficControl) ReadTc(n api.Node) (*link.TcState, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state := &link.TcState{
+		RootHtb: t.root[n.Name],
+		Classes: make(map[uint32]uint64),
+		Netems:  make(map[uint32]link.TcNetem),
+	}
+	for classid, props := range t.classes[n.Name] {
+		state.Classes[classid] = link.ClassRate(props)
+		if props.Latency > 0 || props.Loss > 0 {
+			state.Netems[classid] = link.TcNetem{Handle: props.NetemHandleId, Latency: props.Latency * 1000, Loss: props.Loss}
+		}
+		state.Filters = append(state.Filters, link.TcFilter{ClassId: classid, DstMac: props.DstMac})
+	}
+	return state, nil
+}
+
+// Classify returns the class the packets of node name to the next hop
+// with the MAC address dst are sent to, unmatched packets go to the
+// default class 1:1
+func (t *TrafficControl) Classify(name, dst string) uint32 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for classid, props := range t.classes[name] {
+		if props.DstMac == dst {
+			return classid
+		}
+	}
+	return 1<<16 | 1
+}
+
+// Forget only records the call, nothing is cached
+func (t *TrafficControl) Forget(n api.Node) {
+	_ = t.ops.record("Forget", n.Name, "")
+}
+
+func (t *TrafficControl) Close() error {
+	return nil
+}
+
+// ReadStats returns zero counters for every class
+func (t *TrafficControl) ReadStats(n api.Node) (map[uint32]link.ClassStats, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := make(map[uint32]link.ClassStats)
+	for classid, props := range t.classes[n.Name] {
+		stats[classid] = link.ClassStats{HasNetem: props.Latency > 0 || props.Loss > 0}
+	}
+	return stats, nil
+}
+
+// Classes returns the installed classes of a node by classid
+func (t *TrafficControl) Classes(name string) map[uint32]api.LinkProperties {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	classes := make(map[uint32]api.LinkProperties, len(t.classes[name]))
+	for classid, props := range t.classes[name] {
+		classes[classid] = props
+	}
+	return classes
+}
+
+func describe(props api.LinkProperties) string {
+	return fmt.Sprintf("class=%x netem=%x rate=%d latency=%d loss=%g dst=%s",
+		props.HTBClassid, props.NetemHandleId, props.Rate, props.Latency, props.Loss, props.DstIP)
+}
@@ -0,0 +1,88 @@
+package pkg
+
+import (
+	"Netlink/api"
+	"Netlink/pkg/event"
+	"Netlink/pkg/frr"
+	"context"
+	"fmt"
+	"sort"
+)
+
+// frrChanges returns copies of the container nodes running FRR whose
+// rendered frr.conf differs from the written one, holding the new one,
+// ordered by name. Other kinds are rejected by validation and skipped.
+func (m *Manager) frrChanges() ([]api.Node, error) {
+	names := make([]string, 0, len(m.Nodes))
+	for name := range m.Nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var changed []api.Node
+	for _, name := range names {
+		n := m.Nodes[name]
+		if n.Frr == nil || (n.Kind != "" && n.Kind != api.KindContainer) {
+			continue
+		}
+		conf, err := frr.Render(n, m.Nodes)
+		if err != nil {
+			return nil, err
+		}
+		if conf == n.FrrConf {
+			continue
+		}
+		n = copyNode(n)
+		n.FrrConf = conf
+		changed = append(changed, n)
+	}
+	return changed, nil
+}
+
+// updateFrr writes the changed FRR configurations one node after the
+// other, Apply does it in parallel
+func (m *Manager) updateFrr(ctx context.Context, j *journal) error {
+	changed, err := m.frrChanges()
+	if err != nil {
+		return err
+	}
+	for _, n := range changed {
+		if err := m.setFrr(ctx, j, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setFrr writes the FRR configuration of n, on rollback the restored
+// configuration of the node is written again. A node that ran no FRR
+// gets an empty configuration with every protocol daemon stopped.
+func (m *Manager) setFrr(ctx context.Context, j *journal, n api.Node) error {
+	j.record("set frr of "+n.Name, event.Event{Op: event.OpUndo, Node: n.Name}, func(ctx context.Context) error {
+		// nodes created by the transaction are deleted instead
+		old, ok := m.Nodes[n.Name]
+		if !ok {
+			return nil
+		}
+		if old.FrrConf == "" {
+			if err := m.rt.SetFrr(ctx, old, "", frr.Daemons(nil)); err != nil {
+				return fmt.Errorf("failed to reset frr of %s: %w", old.Name, err)
+			}
+			return nil
+		}
+		return m.installFrr(ctx, old)
+	})
+	if err := m.installFrr(ctx, n); err != nil {
+		return err
+	}
+	m.storeNode(n)
+	return nil
+}
+
+// installFrr writes the FrrConf of n and the daemons of its protocols
+func (m *Manager) installFrr(ctx context.Context, n api.Node) error {
+	if err := m.rt.SetFrr(ctx, n, n.FrrConf, frr.Daemons(n.Frr)); err != nil {
+		return fmt.Errorf("failed to set frr of %s: %w", n.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+// Package frr renders the FRR configuration of the routing protocols of a
+// container node. Router IDs derive from the Uid of the node and the BGP
+// neighbours from its links, OSPF and IS-IS find theirs with hellos, which
+// the group of the node only delivers to the linked nodes whose direction
+// is not down, so a link losing every packet brings the adjacency down.
+// Unicast traffic is shaped by the link to its next hop, the multicast
+// hellos of OSPF and IS-IS are not.
+package frr
+
+import (
+	"Netlink/api"
+	"Netlink/pkg/node"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// protocol defaults, as documented in api.Frr
+const (
+	DefaultOspfArea = "0.0.0.0"
+	DefaultIsisArea = "49.0001"
+	isisTag         = "netlink"
+)
+
+// RouterID returns the router ID of n, its Uid as an IPv4 address unless
+// one is configured
+func RouterID(n api.Node) string {
+	if n.Frr != nil && n.Frr.RouterID != "" {
+		return n.Frr.RouterID
+	}
+	uid := uint32(n.Uid)
+	return net.IPv4(byte(uid>>24), byte(uid>>16), byte(uid>>8), byte(uid)).String()
+}
+
+// Net returns the IS-IS network entity title of n, the system ID is the Uid
+func Net(n api.Node) string {
+	area := DefaultIsisArea
+	if n.Frr != nil && n.Frr.Isis != nil && n.Frr.Isis.Area != "" {
+		area = n.Frr.Isis.Area
+	}
+	uid := uint32(n.Uid)
+	return fmt.Sprintf("%s.0000.%04x.%04x.00", area, uid>>16, uid&0xffff)
+}
+
+// Daemons returns the daemons file starting the daemons of the protocols
+// of cfg, zebra and staticd always run
+func Daemons(cfg *api.Frr) string {
+	var b strings.Builder
+	enabled := func(name string, on bool) {
+		value := "no"
+		if on {
+			value = "yes"
+		}
+		fmt.Fprintf(&b, "%s=%s\n", name, value)
+	}
+	enabled("bgpd", cfg != nil && cfg.Bgp != nil)
+	enabled("ospfd", cfg != nil && cfg.Ospf != nil)
+	enabled("isisd", cfg != nil && cfg.Isis != nil)
+	b.WriteString("vtysh_enable=yes\n")
+	for _, d := range []string{"zebra", "bgpd", "ospfd", "isisd", "staticd"} {
+		fmt.Fprintf(&b, "%s_options=\"-A 127.0.0.1\"\n", d)
+	}
+	return b.String()
+}
+
+// Render returns the frr.conf of n, nodes are the nodes of the topology by
+// name and give the BGP neighbours their address and ASN
+func Render(n api.Node, nodes map[string]api.Node) (string, error) {
+	cfg := n.Frr
+	if cfg == nil {
+		return "", nil
+	}
+	var b strings.Builder
+	b.WriteString("frr defaults traditional\n")
+	fmt.Fprintf(&b, "hostname %s\n", n.Name)
+	b.WriteString("service integrated-vtysh-config\n!\n")
+
+	fmt.Fprintf(&b, "interface %s%s\n", n.Name, node.NodeVethSuffix)
+	if o := cfg.Ospf; o != nil {
+		area := o.Area
+		if area == "" {
+			area = DefaultOspfArea
+		}
+		fmt.Fprintf(&b, " ip ospf area %s\n", area)
+		// the bridge is one segment where every node sees only its
+		// neighbours, a designated router would not reach all of them
+		b.WriteString(" ip ospf network point-to-multipoint\n")
+		if o.Cost != 0 {
+			fmt.Fprintf(&b, " ip ospf cost %d\n", o.Cost)
+		}
+		if o.HelloInterval != 0 {
+			fmt.Fprintf(&b, " ip ospf hello-interval %d\n", o.HelloInterval)
+		}
+		if dead := o.DeadInterval; dead != 0 || o.HelloInterval != 0 {
+			if dead == 0 {
+				dead = 4 * o.HelloInterval
+			}
+			fmt.Fprintf(&b, " ip ospf dead-interval %d\n", dead)
+		}
+	}
+	if i := cfg.Isis; i != nil {
+		fmt.Fprintf(&b, " ip router isis %s\n", isisTag)
+		if i.Metric != 0 {
+			fmt.Fprintf(&b, " isis metric %d\n", i.Metric)
+		}
+		if i.HelloInterval != 0 {
+			fmt.Fprintf(&b, " isis hello-interval %d\n", i.HelloInterval)
+		}
+	}
+	b.WriteString("!\n")
+
+	if cfg.Ospf != nil {
+		b.WriteString("router ospf\n")
+		fmt.Fprintf(&b, " ospf router-id %s\n", RouterID(n))
+		b.WriteString("!\n")
+	}
+	if cfg.Bgp != nil {
+		if err := renderBgp(&b, n, nodes); err != nil {
+			return "", err
+		}
+	}
+	if cfg.Isis != nil {
+		fmt.Fprintf(&b, "router isis %s\n", isisTag)
+		fmt.Fprintf(&b, " net %s\n", Net(n))
+		b.WriteString(" is-type level-2-only\n")
+		b.WriteString("!\n")
+	}
+	b.WriteString("line vty\n!\n")
+	return b.String(), nil
+}
+
+// renderBgp writes the bgp router of n. Every neighbour announces itself
+// as the next hop, the third party next hop of a node on the shared
+// subnet would not be reachable.
+func renderBgp(b *strings.Builder, n api.Node, nodes map[string]api.Node) error {
+	bgp := n.Frr.Bgp
+	peers, err := Neighbors(n, nodes)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(b, "router bgp %d\n", bgp.Asn)
+	fmt.Fprintf(b, " bgp router-id %s\n", RouterID(n))
+	b.WriteString(" no bgp ebgp-requires-policy\n")
+	// the networks are the node addresses, which are not in the RIB as /32
+	b.WriteString(" no bgp network import-check\n")
+	if bgp.Keepalive != 0 || bgp.HoldTime != 0 {
+		keepalive, hold := bgp.Keepalive, bgp.HoldTime
+		if keepalive == 0 {
+			keepalive = hold / 3
+		}
+		if hold == 0 {
+			hold = 3 * keepalive
+		}
+		fmt.Fprintf(b, " timers bgp %d %d\n", keepalive, hold)
+	}
+	for _, peer := range peers {
+		ip := address(peer)
+		fmt.Fprintf(b, " neighbor %s remote-as %d\n", ip, peer.Frr.Bgp.Asn)
+		fmt.Fprintf(b, " neighbor %s description %s\n", ip, peer.Name)
+		if peer.Frr.Bgp.Asn != bgp.Asn && !linked(n, peer) {
+			fmt.Fprintf(b, " neighbor %s ebgp-multihop 255\n", ip)
+		}
+	}
+	b.WriteString(" !\n address-family ipv4 unicast\n")
+	networks := bgp.Networks
+	if len(networks) == 0 {
+		networks = []string{address(n) + "/32"}
+	}
+	for _, network := range networks {
+		fmt.Fprintf(b, "  network %s\n", network)
+	}
+	for _, peer := range peers {
+		fmt.Fprintf(b, "  neighbor %s next-hop-self\n", address(peer))
+	}
+	b.WriteString(" exit-address-family\n!\n")
+	return nil
+}
+
+// Neighbors returns the BGP neighbours of n ordered by name: the
+// configured ones, or the nodes running BGP it has a link to
+func Neighbors(n api.Node, nodes map[string]api.Node) ([]api.Node, error) {
+	var peers []api.Node
+	if names := n.Frr.Bgp.Neighbors; len(names) > 0 {
+		for _, name := range names {
+			peer, ok := nodes[name]
+			if !ok {
+				return nil, fmt.Errorf("bgp neighbor %s of %s is not a node", name, n.Name)
+			}
+			if peer.Frr == nil || peer.Frr.Bgp == nil {
+				return nil, fmt.Errorf("bgp neighbor %s of %s does not run bgp", name, n.Name)
+			}
+			peers = append(peers, peer)
+		}
+	} else {
+		for _, peer := range nodes {
+			if peer.Name != n.Name && peer.Frr != nil && peer.Frr.Bgp != nil && linked(n, peer) {
+				peers = append(peers, peer)
+			}
+		}
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Name < peers[j].Name })
+	return peers, nil
+}
+
+// linked reports whether a link connects a and b in either direction
+func linked(a, b api.Node) bool {
+	_, ab := a.Rules[b.Name]
+	_, ba := b.Rules[a.Name]
+	return ab || ba
+}
+
+func address(n api.Node) string {
+	return strings.Split(n.Interface.Ipv4, "/")[0]
+}
@@ -0,0 +1,356 @@
+// Package generator expands parametric topology descriptions
+// (fat-tree, leaf-spine, ring, grid, torus, star, mesh and random graphs)
+// into plain nodes and links.
+package generator
+
+import (
+	"Netlink/api"
+	"Netlink/pkg/util"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+)
+
+const (
+	TypeFatTree        = "fattree"
+	TypeLeafSpine      = "leafspine"
+	TypeRing           = "ring"
+	TypeGrid           = "grid"
+	TypeTorus          = "torus"
+	TypeStar           = "star"
+	TypeMesh           = "mesh"
+	TypeErdosRenyi     = "erdos-renyi"
+	TypeBarabasiAlbert = "barabasi-albert"
+)
+
+// Types lists the supported generator types
+var Types = []string{TypeFatTree, TypeLeafSpine, TypeRing, TypeGrid, TypeTorus, TypeStar, TypeMesh, TypeErdosRenyi, TypeBarabasiAlbert}
+
+// Expand appends the nodes and links of every generator to topo
+// and returns it without generators
+func Expand(topo api.TopoConfig) (api.TopoConfig, error) {
+	if len(topo.Generators) == 0 {
+		return topo, nil
+	}
+	res := api.TopoConfig{
+		Nodes:   append([]api.Node(nil), topo.Nodes...),
+		Links:   append([]api.Link(nil), topo.Links...),
+		Routing: topo.Routing,
+	}
+	for i, g := range topo.Generators {
+		gen, err := Generate(g)
+		if err != nil {
+			return topo, fmt.Errorf("generator %d (%s): %w", i, g.Type, err)
+		}
+		res.Nodes = append(res.Nodes, gen.Nodes...)
+		res.Links = append(res.Links, gen.Links...)
+	}
+	return res, nil
+}
+
+// Generate builds the topology described by g
+func Generate(g api.Generator) (api.TopoConfig, error) {
+	seed := g.Seed
+	if seed == 0 {
+		seed = 1 // keep the output reproducible by default
+	}
+	b := &builder{g: g, rnd: rand.New(rand.NewSource(seed))}
+
+	var err error
+	switch strings.ToLower(g.Type) {
+	case TypeFatTree:
+		err = b.fatTree()
+	case TypeLeafSpine:
+		err = b.leafSpine()
+	case TypeRing:
+		err = b.ring()
+	case TypeGrid:
+		err = b.grid(false)
+	case TypeTorus:
+		err = b.grid(true)
+	case TypeStar:
+		err = b.star()
+	case TypeMesh:
+		err = b.mesh()
+	case TypeErdosRenyi:
+		err = b.erdosRenyi()
+	case TypeBarabasiAlbert:
+		err = b.barabasiAlbert()
+	default:
+		err = fmt.Errorf("unknown generator type %q, expected one of %s", g.Type, strings.Join(Types, ", "))
+	}
+	if err != nil {
+		return api.TopoConfig{}, err
+	}
+	return b.topo, b.err
+}
+
+type builder struct {
+	g    api.Generator
+	rnd  *rand.Rand
+	topo api.TopoConfig
+	err  error // first addressing error
+}
+
+// node adds a node and returns its full name
+func (b *builder) node(name string) string {
+	n := api.Node{Name: b.g.Prefix + name, Image: b.g.Image, Frr: b.g.Frr}
+	if b.g.Subnet != "" {
+		ip, err := util.AllocateIpv4(b.g.Subnet, len(b.topo.Nodes)+1)
+		if err != nil && b.err == nil {
+			b.err = err
+		}
+		n.Interface.Ipv4 = ip
+	}
+	b.topo.Nodes = append(b.topo.Nodes, n)
+	return n.Name
+}
+
+// link connects two nodes with the properties of tier
+func (b *builder) link(src, dst, tier string) {
+	props := b.g.Properties
+	if t, ok := b.g.Tiers[tier]; ok {
+		if t.Rate > 0 {
+			props.Rate = t.Rate
+		}
+		if t.Latency > 0 {
+			props.Latency = t.Latency
+		}
+		if t.Loss > 0 {
+			props.Loss = t.Loss
+		}
+	}
+	if d := b.g.LatencyDistribution; d != nil {
+		props.Latency = b.sample(d)
+	}
+	b.topo.Links = append(b.topo.Links, api.Link{SrcNode: src, DstNode: dst, Properties: props})
+}
+
+// sample draws a latency in ms, negative draws are clamped to 0
+func (b *builder) sample(d *api.Distribution) uint32 {
+	var v float64
+	switch d.Type {
+	case "uniform":
+		v = d.Min + b.rnd.Float64()*(d.Max-d.Min)
+	case "normal":
+		v = d.Mean + b.rnd.NormFloat64()*d.Stddev
+	default: // constant
+		v = d.Mean
+	}
+	if v < 0 {
+		v = 0
+	}
+	return uint32(math.Round(v))
+}
+
+// fatTree builds a k-ary fat-tree: (k/2)^2 core switches, k pods of k/2
+// aggregation and k/2 edge switches, k/2 hosts per edge switch.
+// Tiers: core (core-aggregation), aggregation (aggregation-edge), edge (edge-host)
+func (b *builder) fatTree() error {
+	k := b.g.K
+	if k < 2 || k%2 != 0 {
+		return fmt.Errorf("fattree needs an even k >= 2, got %d", k)
+	}
+	half := k / 2
+	cores := make([]string, half*half)
+	for i := range cores {
+		cores[i] = b.node(fmt.Sprintf("c%d", i+1))
+	}
+	for pod := 1; pod <= k; pod++ {
+		aggs := make([]string, half)
+		for i := range aggs {
+			aggs[i] = b.node(fmt.Sprintf("a%d-%d", pod, i+1))
+			// aggregation switch i connects to core group i
+			for j := 0; j < half; j++ {
+				b.link(cores[i*half+j], aggs[i], "core")
+			}
+		}
+		for e := 1; e <= half; e++ {
+			edge := b.node(fmt.Sprintf("e%d-%d", pod, e))
+			for _, agg := range aggs {
+				b.link(agg, edge, "aggregation")
+			}
+			for h := 1; h <= half; h++ {
+				b.link(edge, b.node(fmt.Sprintf("h%d-%d-%d", pod, e, h)), "edge")
+			}
+		}
+	}
+	return nil
+}
+
+// leafSpine connects every leaf to every spine and hostsPerLeaf hosts to each leaf.
+// Tiers: spine (spine-leaf), leaf (leaf-host)
+func (b *builder) leafSpine() error {
+	if b.g.Spines < 1 || b.g.Leaves < 1 {
+		return fmt.Errorf("leafspine needs spines >= 1 and leaves >= 1")
+	}
+	spines := make([]string, b.g.Spines)
+	for i := range spines {
+		spines[i] = b.node(fmt.Sprintf("sp%d", i+1))
+	}
+	for l := 1; l <= b.g.Leaves; l++ {
+		leaf := b.node(fmt.Sprintf("lf%d", l))
+		for _, spine := range spines {
+			b.link(spine, leaf, "spine")
+		}
+		for h := 1; h <= b.g.HostsPerLeaf; h++ {
+			b.link(leaf, b.node(fmt.Sprintf("h%d-%d", l, h)), "leaf")
+		}
+	}
+	return nil
+}
+
+func (b *builder) nodes(prefix string, min int) ([]string, error) {
+	if b.g.Nodes < min {
+		return nil, fmt.Errorf("%s needs nodes >= %d, got %d", b.g.Type, min, b.g.Nodes)
+	}
+	names := make([]string, b.g.Nodes)
+	for i := range names {
+		names[i] = b.node(fmt.Sprintf("%s%d", prefix, i+1))
+	}
+	return names, nil
+}
+
+func (b *builder) ring() error {
+	names, err := b.nodes("r", 3)
+	if err != nil {
+		return err
+	}
+	for i := range names {
+		b.link(names[i], names[(i+1)%len(names)], "")
+	}
+	return nil
+}
+
+// star connects nodes leaves to one hub
+func (b *builder) star() error {
+	hub := b.node("s0")
+	leaves, err := b.nodes("s", 1)
+	if err != nil {
+		return err
+	}
+	for _, leaf := range leaves {
+		b.link(hub, leaf, "")
+	}
+	return nil
+}
+
+func (b *builder) mesh() error {
+	names, err := b.nodes("m", 2)
+	if err != nil {
+		return err
+	}
+	for i := range names {
+		for j := i + 1; j < len(names); j++ {
+			b.link(names[i], names[j], "")
+		}
+	}
+	return nil
+}
+
+// grid builds a 2D or 3D grid, wrap closes every dimension into a torus
+func (b *builder) grid(wrap bool) error {
+	dims := append([]int(nil), b.g.Dims...)
+	if len(dims) != 2 && len(dims) != 3 {
+		return fmt.Errorf("%s needs 2 or 3 dims, got %v", b.g.Type, b.g.Dims)
+	}
+	if len(dims) == 2 {
+		dims = append(dims, 1)
+	}
+	for _, d := range dims {
+		if d < 1 {
+			return fmt.Errorf("%s dims must be positive, got %v", b.g.Type, b.g.Dims)
+		}
+	}
+	name := func(x, y, z int) string {
+		if len(b.g.Dims) == 2 {
+			return fmt.Sprintf("g%d-%d", x, y)
+		}
+		return fmt.Sprintf("g%d-%d-%d", x, y, z)
+	}
+	names := make(map[[3]int]string)
+	for x := 0; x < dims[0]; x++ {
+		for y := 0; y < dims[1]; y++ {
+			for z := 0; z < dims[2]; z++ {
+				names[[3]int{x, y, z}] = b.node(name(x, y, z))
+			}
+		}
+	}
+	for x := 0; x < dims[0]; x++ {
+		for y := 0; y < dims[1]; y++ {
+			for z := 0; z < dims[2]; z++ {
+				pos := [3]int{x, y, z}
+				for axis := 0; axis < 3; axis++ {
+					next := pos
+					next[axis]++
+					if next[axis] == dims[axis] {
+						// wrapping a dimension of size <= 2 would duplicate a link
+						if !wrap || dims[axis] <= 2 {
+							continue
+						}
+						next[axis] = 0
+					}
+					b.link(names[pos], names[next], "")
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// erdosRenyi links every pair of nodes with probability p
+func (b *builder) erdosRenyi() error {
+	if b.g.P < 0 || b.g.P > 1 {
+		return fmt.Errorf("erdos-renyi needs 0 <= p <= 1, got %g", b.g.P)
+	}
+	names, err := b.nodes("n", 1)
+	if err != nil {
+		return err
+	}
+	for i := range names {
+		for j := i + 1; j < len(names); j++ {
+			if b.rnd.Float64() < b.g.P {
+				b.link(names[i], names[j], "")
+			}
+		}
+	}
+	return nil
+}
+
+// barabasiAlbert starts from m+1 fully connected nodes and attaches every
+// new node to m distinct nodes chosen proportionally to their degree
+func (b *builder) barabasiAlbert() error {
+	m := b.g.M
+	if m < 1 || b.g.Nodes <= m {
+		return fmt.Errorf("barabasi-albert needs m >= 1 and nodes > m, got m=%d nodes=%d", m, b.g.Nodes)
+	}
+	names, err := b.nodes("n", m+1)
+	if err != nil {
+		return err
+	}
+	// every node appears once per incident link
+	var targets []int
+	for i := 0; i <= m; i++ {
+		for j := i + 1; j <= m; j++ {
+			b.link(names[i], names[j], "")
+			targets = append(targets, i, j)
+		}
+	}
+	for i := m + 1; i < len(names); i++ {
+		chosen := make(map[int]bool, m)
+		var order []int
+		for len(chosen) < m {
+			t := targets[b.rnd.Intn(len(targets))]
+			if !chosen[t] {
+				chosen[t] = true
+				order = append(order, t)
+			}
+		}
+		for _, t := range order {
+			b.link(names[i], names[t], "")
+			targets = append(targets, i, t)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package generator_test
+
+import (
+	"Netlink/api"
+	"Netlink/pkg/generator"
+	"reflect"
+	"testing"
+)
+
+func TestGenerateCounts(t *testing.T) {
+	tests := []struct {
+		g            api.Generator
+		nodes, links int
+	}{
+		{api.Generator{Type: "fattree", K: 4}, 36, 48},
+		{api.Generator{Type: "fattree", K: 2}, 7, 6},
+		{api.Generator{Type: "leafspine", Spines: 2, Leaves: 3, HostsPerLeaf: 2}, 11, 12},
+		{api.Generator{Type: "ring", Nodes: 5}, 5, 5},
+		{api.Generator{Type: "star", Nodes: 4}, 5, 4},
+		{api.Generator{Type: "mesh", Nodes: 4}, 4, 6},
+		{api.Generator{Type: "grid", Dims: []int{3, 4}}, 12, 17},
+		{api.Generator{Type: "grid", Dims: []int{2, 2, 2}}, 8, 12},
+		{api.Generator{Type: "torus", Dims: []int{3, 4}}, 12, 24},
+		// a dimension of 2 is not wrapped
+		{api.Generator{Type: "torus", Dims: []int{2, 3}}, 6, 9},
+		{api.Generator{Type: "erdos-renyi", Nodes: 5, P: 1}, 5, 10},
+		{api.Generator{Type: "erdos-renyi", Nodes: 5, P: 0}, 5, 0},
+		{api.Generator{Type: "barabasi-albert", Nodes: 10, M: 2}, 10, 17},
+	}
+	for _, tt := range tests {
+		topo, err := generator.Generate(tt.g)
+		if err != nil {
+			t.Errorf("%+v: %v", tt.g, err)
+			continue
+		}
+		if len(topo.Nodes) != tt.nodes || len(topo.Links) != tt.links {
+			t.Errorf("%+v: %d nodes %d links, want %d and %d", tt.g, len(topo.Nodes), len(topo.Links), tt.nodes, tt.links)
+		}
+		names := make(map[string]bool)
+		for _, n := range topo.Nodes {
+			if names[n.Name] {
+				t.Errorf("%+v: duplicate node %s", tt.g, n.Name)
+			}
+			names[n.Name] = true
+		}
+		pairs := make(map[[2]string]bool)
+		for _, l := range topo.Links {
+			pair := [2]string{l.SrcNode, l.DstNode}
+			if l.SrcNode > l.DstNode {
+				pair = [2]string{l.DstNode, l.SrcNode}
+			}
+			if !names[l.SrcNode] || !names[l.DstNode] || l.SrcNode == l.DstNode || pairs[pair] {
+				t.Errorf("%+v: invalid or duplicate link %s-%s", tt.g, l.SrcNode, l.DstNode)
+			}
+			pairs[pair] = true
+		}
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	for _, g := range []api.Generator{
+		{Type: "hypercube"},
+		{Type: "fattree", K: 3},
+		{Type: "fattree"},
+		{Type: "leafspine", Spines: 1},
+		{Type: "ring", Nodes: 2},
+		{Type: "star"},
+		{Type: "mesh", Nodes: 1},
+		{Type: "grid", Dims: []int{3}},
+		{Type: "torus", Dims: []int{3, 0}},
+		{Type: "erdos-renyi", Nodes: 5, P: 1.5},
+		{Type: "barabasi-albert", Nodes: 2, M: 2},
+		{Type: "ring", Nodes: 300, Subnet: "10.0.0.0/24"},
+	} {
+		if topo, err := generator.Generate(g); err == nil {
+			t.Errorf("%+v: %d nodes, want an error", g, len(topo.Nodes))
+		}
+	}
+}
+
+func TestGenerateSeed(t *testing.T) {
+	random := api.Generator{Type: "erdos-renyi", Nodes: 20, P: 0.3,
+		LatencyDistribution: &api.Distribution{Type: "uniform", Min: 1, Max: 50}}
+	generate := func(seed int64) api.TopoConfig {
+		g := random
+		g.Seed = seed
+		topo, err := generator.Generate(g)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return topo
+	}
+	if a, b := generate(7), generate(7); !reflect.DeepEqual(a, b) {
+		t.Error("seed 7 generated two different topologies")
+	}
+	if a, b := generate(7), generate(8); reflect.DeepEqual(a, b) {
+		t.Error("seeds 7 and 8 generated the same topology")
+	}
+	// seed 0 is seed 1 so that the default is reproducible
+	if a, b := generate(0), generate(1); !reflect.DeepEqual(a, b) {
+		t.Error("seed 0 differs from seed 1")
+	}
+
+	ba := api.Generator{Type: "barabasi-albert", Nodes: 30, M: 2, Seed: 3}
+	a, _ := generator.Generate(ba)
+	b, _ := generator.Generate(ba)
+	if !reflect.DeepEqual(a, b) {
+		t.Error("barabasi-albert is not deterministic")
+	}
+}
+
+func TestGenerateProperties(t *testing.T) {
+	topo, err := generator.Generate(api.Generator{
+		Type: "leafspine", Spines: 1, Leaves: 1, HostsPerLeaf: 1,
+		Prefix: "dc1-", Image: "frr:v4", Subnet: "10.1.0.0/24",
+		Properties: api.LinkProperties{Rate: 100, Latency: 1},
+		Tiers:      map[string]api.LinkProperties{"leaf": {Latency: 5}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := api.TopoConfig{
+		Nodes: []api.Node{
+			{Name: "dc1-sp1", Image: "frr:v4", Interface: api.NodeInterface{Ipv4: "10.1.0.1/24"}},
+			{Name: "dc1-lf1", Image: "frr:v4", Interface: api.NodeInterface{Ipv4: "10.1.0.2/24"}},
+			{Name: "dc1-h1-1", Image: "frr:v4", Interface: api.NodeInterface{Ipv4: "10.1.0.3/24"}},
+		},
+		Links: []api.Link{
+			{SrcNode: "dc1-sp1", DstNode: "dc1-lf1", Properties: api.LinkProperties{Rate: 100, Latency: 1}},
+			{SrcNode: "dc1-lf1", DstNode: "dc1-h1-1", Properties: api.LinkProperties{Rate: 100, Latency: 5}},
+		},
+	}
+	if !reflect.DeepEqual(topo, want) {
+		t.Errorf("got %+v\nwant %+v", topo, want)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	topo := api.TopoConfig{
+		Nodes:      []api.Node{{Name: "node1"}},
+		Links:      []api.Link{{SrcNode: "node1", DstNode: "r1"}},
+		Generators: []api.Generator{{Type: "ring", Nodes: 3}},
+		Routing:    &api.Routing{Mode: api.RoutingStatic},
+	}
+	res, err := generator.Expand(topo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Nodes) != 4 || len(res.Links) != 4 || res.Generators != nil || res.Routing != topo.Routing {
+		t.Errorf("expanded %+v", res)
+	}
+	if _, err = generator.Expand(api.TopoConfig{Generators: []api.Generator{{Type: "ring"}}}); err == nil {
+		t.Error("invalid generator expanded")
+	}
+}
@@ -0,0 +1,124 @@
+package importer
+
+import (
+	"Netlink/api"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"sort"
+	"strings"
+)
+
+type clabTopology struct {
+	Name     string `yaml:"name"`
+	Topology struct {
+		Defaults clabNode            `yaml:"defaults"`
+		Kinds    map[string]clabNode `yaml:"kinds"`
+		Nodes    map[string]clabNode `yaml:"nodes"`
+		Links    []clabLink          `yaml:"links"`
+	} `yaml:"topology"`
+}
+
+type clabNode struct {
+	Kind     string            `yaml:"kind"`
+	Image    string            `yaml:"image"`
+	MgmtIPv4 string            `yaml:"mgmt-ipv4"`
+	Labels   map[string]string `yaml:"labels"`
+}
+
+// clabLink covers the brief form (endpoints: ["n1:eth1", "n2:eth1"]) and the
+// extended form (endpoints: [{node: n1, interface: eth1}, ...]), netem style
+// annotations are read from vars and labels
+type clabLink struct {
+	Endpoints []yaml.Node            `yaml:"endpoints"`
+	Vars      map[string]interface{} `yaml:"vars"`
+	Labels    map[string]interface{} `yaml:"labels"`
+}
+
+// ImportContainerlab translates a containerlab .clab.yml topology,
+// node images fall back to kind and then default images, mgmt-ipv4
+// becomes the node address
+func ImportContainerlab(data []byte) (api.TopoConfig, error) {
+	var topo api.TopoConfig
+	var clab clabTopology
+	if err := yaml.Unmarshal(data, &clab); err != nil {
+		return topo, fmt.Errorf("error unmarshaling containerlab file: %w", err)
+	}
+
+	names := make([]string, 0, len(clab.Topology.Nodes))
+	for name := range clab.Topology.Nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cn := clab.Topology.Nodes[name]
+		kind := cn.Kind
+		if kind == "" {
+			kind = clab.Topology.Defaults.Kind
+		}
+		image := cn.Image
+		if image == "" {
+			image = clab.Topology.Kinds[kind].Image
+		}
+		if image == "" {
+			image = clab.Topology.Defaults.Image
+		}
+		topo.Nodes = append(topo.Nodes, api.Node{
+			Name:      name,
+			Image:     image,
+			Labels:    cn.Labels,
+			Interface: api.NodeInterface{Ipv4: withPrefix(cn.MgmtIPv4)},
+		})
+	}
+
+	for i, cl := range clab.Topology.Links {
+		if len(cl.Endpoints) != 2 {
+			return topo, fmt.Errorf("link %d: expected 2 endpoints, got %d", i, len(cl.Endpoints))
+		}
+		src, err := clabEndpointNode(&cl.Endpoints[0])
+		if err != nil {
+			return topo, fmt.Errorf("link %d: %w", i, err)
+		}
+		dst, err := clabEndpointNode(&cl.Endpoints[1])
+		if err != nil {
+			return topo, fmt.Errorf("link %d: %w", i, err)
+		}
+		attrs := make(map[string]interface{}, len(cl.Vars)+len(cl.Labels))
+		for k, v := range cl.Labels {
+			attrs[k] = v
+		}
+		for k, v := range cl.Vars {
+			attrs[k] = v
+		}
+		props, err := properties(attrs)
+		if err != nil {
+			return topo, fmt.Errorf("link %s-%s: %w", src, dst, err)
+		}
+		topo.Links = append(topo.Links, api.Link{SrcNode: src, DstNode: dst, Properties: props})
+	}
+	return topo, nil
+}
+
+// clabEndpointNode returns the node name of an endpoint
+func clabEndpointNode(ep *yaml.Node) (string, error) {
+	switch ep.Kind {
+	case yaml.ScalarNode:
+		node, _, _ := strings.Cut(ep.Value, ":")
+		if node == "" {
+			return "", fmt.Errorf("invalid endpoint %q", ep.Value)
+		}
+		return node, nil
+	case yaml.MappingNode:
+		var ext struct {
+			Node string `yaml:"node"`
+		}
+		if err := ep.Decode(&ext); err != nil {
+			return "", err
+		}
+		if ext.Node == "" {
+			return "", fmt.Errorf("endpoint at line %d has no node", ep.Line)
+		}
+		return ext.Node, nil
+	default:
+		return "", fmt.Errorf("invalid endpoint at line %d", ep.Line)
+	}
+}
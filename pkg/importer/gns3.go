@@ -0,0 +1,71 @@
+package importer
+
+import (
+	"Netlink/api"
+	"encoding/json"
+	"fmt"
+)
+
+type gns3Project struct {
+	Topology struct {
+		Nodes []struct {
+			NodeID     string                 `json:"node_id"`
+			Name       string                 `json:"name"`
+			NodeType   string                 `json:"node_type"`
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"nodes"`
+		Links []struct {
+			Nodes []struct {
+				NodeID string `json:"node_id"`
+			} `json:"nodes"`
+			Filters map[string][]interface{} `json:"filters"`
+		} `json:"links"`
+	} `json:"topology"`
+}
+
+// ImportGNS3 translates a GNS3 .gns3 project, the delay and packet_loss
+// link filters become latency and loss, docker node images are kept
+func ImportGNS3(data []byte) (api.TopoConfig, error) {
+	var topo api.TopoConfig
+	var project gns3Project
+	if err := json.Unmarshal(data, &project); err != nil {
+		return topo, fmt.Errorf("error unmarshaling GNS3 project: %w", err)
+	}
+
+	names := make(map[string]string, len(project.Topology.Nodes))
+	for _, gn := range project.Topology.Nodes {
+		names[gn.NodeID] = gn.Name
+		n := api.Node{Name: gn.Name}
+		if image, ok := gn.Properties["image"].(string); ok && gn.NodeType == "docker" {
+			n.Image = image
+		}
+		topo.Nodes = append(topo.Nodes, n)
+	}
+
+	for i, gl := range project.Topology.Links {
+		if len(gl.Nodes) != 2 {
+			return topo, fmt.Errorf("link %d: expected 2 nodes, got %d", i, len(gl.Nodes))
+		}
+		src, ok := names[gl.Nodes[0].NodeID]
+		if !ok {
+			return topo, fmt.Errorf("link %d: unknown node id %s", i, gl.Nodes[0].NodeID)
+		}
+		dst, ok := names[gl.Nodes[1].NodeID]
+		if !ok {
+			return topo, fmt.Errorf("link %d: unknown node id %s", i, gl.Nodes[1].NodeID)
+		}
+		// filters are lists of parameters, the first one is the value we need
+		attrs := make(map[string]interface{}, len(gl.Filters))
+		for name, params := range gl.Filters {
+			if len(params) > 0 {
+				attrs[name] = params[0]
+			}
+		}
+		props, err := properties(attrs)
+		if err != nil {
+			return topo, fmt.Errorf("link %s-%s: %w", src, dst, err)
+		}
+		topo.Links = append(topo.Links, api.Link{SrcNode: src, DstNode: dst, Properties: props})
+	}
+	return topo, nil
+}
@@ -0,0 +1,181 @@
+// Package importer translates topologies written for other tools
+// (containerlab, GNS3, NetworkX node-link JSON) into api.TopoConfig.
+package importer
+
+import (
+	"Netlink/api"
+	"bytes"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	FormatNative       = "native"
+	FormatContainerlab = "containerlab"
+	FormatGNS3         = "gns3"
+	FormatNetworkX     = "networkx"
+)
+
+// DetectFormat guesses the format from the file name
+func DetectFormat(path string) string {
+	lower := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(lower, ".clab.yml"), strings.HasSuffix(lower, ".clab.yaml"):
+		return FormatContainerlab
+	case strings.HasSuffix(lower, ".gns3"):
+		return FormatGNS3
+	case strings.HasSuffix(lower, ".json"):
+		return FormatNetworkX
+	default:
+		return FormatNative
+	}
+}
+
+// Load reads path in format, an empty format is detected from the file name
+func Load(path, format string) (api.TopoConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return api.TopoConfig{}, fmt.Errorf("error reading topology file: %w", err)
+	}
+	if format == "" {
+		format = DetectFormat(path)
+	}
+	topo, err := Import(data, format)
+	if err != nil {
+		return topo, fmt.Errorf("%s: %w", path, err)
+	}
+	return topo, nil
+}
+
+// Import translates data in format into a topology
+func Import(data []byte, format string) (api.TopoConfig, error) {
+	switch format {
+	case FormatNative, "yaml":
+		// unknown fields are errors, a typo would otherwise be silently ignored
+		var topo api.TopoConfig
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&topo); err != nil && err != io.EOF {
+			return topo, fmt.Errorf("error unmarshaling YAML file: %w", err)
+		}
+		return topo, nil
+	case FormatContainerlab, "clab":
+		return ImportContainerlab(data)
+	case FormatGNS3:
+		return ImportGNS3(data)
+	case FormatNetworkX, "json":
+		return ImportNetworkX(data)
+	default:
+		return api.TopoConfig{}, fmt.Errorf("unknown topology format %q, expected native, containerlab, gns3 or networkx", format)
+	}
+}
+
+// properties reads link annotations from attrs, accepted keys are
+// rate/bandwidth/bw, latency/delay and loss, values may carry units
+// ("100Mbps", "1Gbit", "10ms", "0.5%")
+func properties(attrs map[string]interface{}) (api.LinkProperties, error) {
+	var p api.LinkProperties
+	for key, v := range attrs {
+		var err error
+		switch strings.ToLower(key) {
+		case "rate", "bandwidth", "bw":
+			p.Rate, err = parseRate(v)
+		case "latency", "delay":
+			p.Latency, err = parseLatency(v)
+		case "loss", "packet_loss":
+			p.Loss, err = parseLoss(v)
+		}
+		if err != nil {
+			return p, fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+	return p, nil
+}
+
+// splitUnit splits "100Mbps" into 100 and "mbps"
+func splitUnit(v interface{}) (float64, string, error) {
+	switch val := v.(type) {
+	case int:
+		return float64(val), "", nil
+	case int64:
+		return float64(val), "", nil
+	case uint64:
+		return float64(val), "", nil
+	case float64:
+		return val, "", nil
+	case string:
+		s := strings.TrimSpace(strings.ToLower(val))
+		i := 0
+		for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+			i++
+		}
+		num, err := strconv.ParseFloat(s[:i], 64)
+		if err != nil {
+			return 0, "", fmt.Errorf("%q is not a number", val)
+		}
+		return num, strings.TrimSpace(s[i:]), nil
+	default:
+		return 0, "", fmt.Errorf("unsupported value %v", v)
+	}
+}
+
+// parseRate returns the rate in mbps, plain numbers are mbps
+func parseRate(v interface{}) (uint64, error) {
+	num, unit, err := splitUnit(v)
+	if err != nil {
+		return 0, err
+	}
+	switch strings.TrimSuffix(strings.TrimSuffix(unit, "ps"), "it") {
+	case "", "m", "mb", "mbit":
+	case "k", "kb", "kbit":
+		num /= 1000
+	case "g", "gb", "gbit":
+		num *= 1000
+	default:
+		return 0, fmt.Errorf("unknown rate unit %q", unit)
+	}
+	return uint64(math.Ceil(num)), nil
+}
+
+// parseLatency returns the latency in ms, plain numbers are ms
+func parseLatency(v interface{}) (uint32, error) {
+	num, unit, err := splitUnit(v)
+	if err != nil {
+		return 0, err
+	}
+	switch unit {
+	case "", "ms":
+	case "us":
+		num /= 1000
+	case "s":
+		num *= 1000
+	default:
+		return 0, fmt.Errorf("unknown latency unit %q", unit)
+	}
+	return uint32(math.Round(num)), nil
+}
+
+// parseLoss returns the loss in percentage
+func parseLoss(v interface{}) (float32, error) {
+	num, unit, err := splitUnit(v)
+	if err != nil {
+		return 0, err
+	}
+	if unit != "" && unit != "%" {
+		return 0, fmt.Errorf("unknown loss unit %q", unit)
+	}
+	return float32(num), nil
+}
+
+// withPrefix appends /24 to a bare address
+func withPrefix(ip string) string {
+	if ip == "" || strings.Contains(ip, "/") {
+		return ip
+	}
+	return ip + "/24"
+}
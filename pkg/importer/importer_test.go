@@ -0,0 +1,119 @@
+package importer_test
+
+import (
+	"Netlink/api"
+	"Netlink/pkg/importer"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		file string
+		want api.TopoConfig
+	}{
+		{
+			file: "testdata/lab.clab.yml",
+			want: api.TopoConfig{
+				Nodes: []api.Node{
+					{Name: "h1", Image: "alpine:3", Interface: api.NodeInterface{Ipv4: "172.20.20.3/24"}},
+					{Name: "h2", Image: "alpine:3"},
+					{Name: "r1", Image: "frrouting/frr:v8.4.1", Labels: map[string]string{"role": "router"},
+						Interface: api.NodeInterface{Ipv4: "172.20.20.2/24"}},
+				},
+				Links: []api.Link{
+					{SrcNode: "r1", DstNode: "h1", Properties: api.LinkProperties{Latency: 10, Rate: 1000}},
+					{SrcNode: "r1", DstNode: "h2", Properties: api.LinkProperties{Loss: 0.5, Rate: 1}},
+				},
+			},
+		},
+		{
+			file: "testdata/project.gns3",
+			want: api.TopoConfig{
+				Nodes: []api.Node{{Name: "PC1"}, {Name: "router", Image: "frr:latest"}},
+				Links: []api.Link{{SrcNode: "PC1", DstNode: "router", Properties: api.LinkProperties{Latency: 25, Loss: 2}}},
+			},
+		},
+		{
+			file: "testdata/graph.json",
+			want: api.TopoConfig{
+				Nodes: []api.Node{
+					{Name: "1", Image: "frr:v4", Interface: api.NodeInterface{Ipv4: "10.0.0.1/24"}},
+					{Name: "b", Labels: map[string]string{"rack": "3"}, Interface: api.NodeInterface{Ipv4: "10.0.0.2/16"}},
+				},
+				Links: []api.Link{{SrcNode: "1", DstNode: "b", UniDirectional: true,
+					Properties: api.LinkProperties{Latency: 2000, Rate: 100, Loss: 1}}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		got, err := importer.Load(tt.file, "")
+		if err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\n%+v\nwant\n%+v", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	tests := []struct {
+		format, data, want string
+	}{
+		{importer.FormatNative, "nodes:\n  - name: node1\n    imgae: frr\n", "field imgae not found"},
+		{importer.FormatContainerlab, "topology: [", "error unmarshaling containerlab file"},
+		{importer.FormatContainerlab, "topology:\n  links:\n    - endpoints: [\"r1:eth1\"]\n", "link 0: expected 2 endpoints, got 1"},
+		{importer.FormatContainerlab, "topology:\n  links:\n    - endpoints: [\":eth1\", \"h1:eth1\"]\n", `link 0: invalid endpoint ":eth1"`},
+		{importer.FormatContainerlab, "topology:\n  links:\n    - endpoints: [{interface: eth1}, \"h1:eth1\"]\n", "link 0: endpoint at line 3 has no node"},
+		{importer.FormatContainerlab, "topology:\n  links:\n    - endpoints: [\"r1:eth1\", \"h1:eth1\"]\n      vars: {delay: 10 parsecs}\n",
+			`link r1-h1: invalid delay: unknown latency unit "parsecs"`},
+		{importer.FormatGNS3, "{", "error unmarshaling GNS3 project"},
+		{importer.FormatGNS3, `{"topology": {"links": [{"nodes": [{"node_id": "a"}]}]}}`, "link 0: expected 2 nodes, got 1"},
+		{importer.FormatGNS3, `{"topology": {"nodes": [{"node_id": "a", "name": "PC1"}], "links": [{"nodes": [{"node_id": "a"}, {"node_id": "z"}]}]}}`,
+			"link 0: unknown node id z"},
+		{importer.FormatGNS3, `{"topology": {"nodes": [{"node_id": "a", "name": "PC1"}, {"node_id": "b", "name": "PC2"}],
+			"links": [{"nodes": [{"node_id": "a"}, {"node_id": "b"}], "filters": {"packet_loss": ["lots"]}}]}}`,
+			`link PC1-PC2: invalid packet_loss: "lots" is not a number`},
+		{importer.FormatNetworkX, "[]", "error unmarshaling node-link JSON"},
+		{importer.FormatNetworkX, `{"nodes": [{"ip": "10.0.0.1"}]}`, "node 0 has no id"},
+		{importer.FormatNetworkX, `{"nodes": [{"id": 1}], "links": [{"source": 1}]}`, "edge 0 needs source and target"},
+		{importer.FormatNetworkX, `{"links": [{"source": 1, "target": 2, "rate": "10 furlongs"}]}`, `edge 1-2: invalid rate: unknown rate unit "furlongs"`},
+		{"pcap", "", `unknown topology format "pcap"`},
+	}
+	for _, tt := range tests {
+		_, err := importer.Import([]byte(tt.data), tt.format)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Import(%s, %q) = %v, want %q", tt.format, tt.data, err, tt.want)
+		}
+	}
+}
+
+func TestNetworkXEdges(t *testing.T) {
+	// networkx >= 3.4 writes edges instead of links
+	topo, err := importer.Import([]byte(`{"nodes": [{"id": "a"}, {"id": "b"}], "edges": [{"source": "a", "target": "b", "delay": "500us"}]}`), importer.FormatNetworkX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []api.Link{{SrcNode: "a", DstNode: "b", Properties: api.LinkProperties{Latency: 1}}}
+	if !reflect.DeepEqual(topo.Links, want) {
+		t.Errorf("links %+v, want %+v", topo.Links, want)
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	for path, want := range map[string]string{
+		"lab.clab.yml":  importer.FormatContainerlab,
+		"LAB.CLAB.YAML": importer.FormatContainerlab,
+		"project.gns3":  importer.FormatGNS3,
+		"graph.json":    importer.FormatNetworkX,
+		"topo.yaml":     importer.FormatNative,
+		"topo":          importer.FormatNative,
+	} {
+		if got := importer.DetectFormat(path); got != want {
+			t.Errorf("DetectFormat(%s) = %s, want %s", path, got, want)
+		}
+	}
+}
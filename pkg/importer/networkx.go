@@ -0,0 +1,71 @@
+package importer
+
+import (
+	"Netlink/api"
+	"encoding/json"
+	"fmt"
+)
+
+type nodeLinkGraph struct {
+	Directed bool                     `json:"directed"`
+	Nodes    []map[string]interface{} `json:"nodes"`
+	Links    []map[string]interface{} `json:"links"`
+	Edges    []map[string]interface{} `json:"edges"` // networkx >= 3.4 with edges="edges"
+}
+
+// ImportNetworkX translates NetworkX node-link JSON (networkx.node_link_data),
+// nodes may carry ip/ipv4, image and labels, edges carry link properties.
+// Edges of a directed graph become unidirectional links
+func ImportNetworkX(data []byte) (api.TopoConfig, error) {
+	var topo api.TopoConfig
+	var g nodeLinkGraph
+	if err := json.Unmarshal(data, &g); err != nil {
+		return topo, fmt.Errorf("error unmarshaling node-link JSON: %w", err)
+	}
+
+	for i, attrs := range g.Nodes {
+		id, ok := attrs["id"]
+		if !ok {
+			return topo, fmt.Errorf("node %d has no id", i)
+		}
+		n := api.Node{Name: fmt.Sprint(id)}
+		if ip, ok := attrs["ipv4"].(string); ok {
+			n.Interface.Ipv4 = withPrefix(ip)
+		} else if ip, ok := attrs["ip"].(string); ok {
+			n.Interface.Ipv4 = withPrefix(ip)
+		}
+		if image, ok := attrs["image"].(string); ok {
+			n.Image = image
+		}
+		if labels, ok := attrs["labels"].(map[string]interface{}); ok {
+			n.Labels = make(map[string]string, len(labels))
+			for k, v := range labels {
+				n.Labels[k] = fmt.Sprint(v)
+			}
+		}
+		topo.Nodes = append(topo.Nodes, n)
+	}
+
+	edges := g.Links
+	if len(edges) == 0 {
+		edges = g.Edges
+	}
+	for i, attrs := range edges {
+		src, okSrc := attrs["source"]
+		dst, okDst := attrs["target"]
+		if !okSrc || !okDst {
+			return topo, fmt.Errorf("edge %d needs source and target", i)
+		}
+		props, err := properties(attrs)
+		if err != nil {
+			return topo, fmt.Errorf("edge %v-%v: %w", src, dst, err)
+		}
+		topo.Links = append(topo.Links, api.Link{
+			SrcNode:        fmt.Sprint(src),
+			DstNode:        fmt.Sprint(dst),
+			Properties:     props,
+			UniDirectional: g.Directed,
+		})
+	}
+	return topo, nil
+}
@@ -0,0 +1,91 @@
+package pkg
+
+import (
+	"Netlink/api"
+	"Netlink/pkg/event"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// journal records how to undo every operation of one transaction,
+// a failed transaction is rolled back in reverse order. The workers of
+// Apply record concurrently, the steps of one node stay in order.
+type journal struct {
+	mu    sync.Mutex
+	steps []undoStep
+}
+
+// undoStep reverts one operation, event describes the change the undo makes
+type undoStep struct {
+	desc  string
+	event event.Event
+	undo  func(ctx context.Context) error
+}
+
+func (j *journal) record(desc string, e event.Event, undo func(ctx context.Context) error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.steps = append(j.steps, undoStep{desc: desc, event: e, undo: undo})
+}
+
+// rollback runs all undo steps and emits their events, it keeps going
+// on failure
+func (j *journal) rollback(ctx context.Context, emit func(ctx context.Context, e event.Event, err error)) error {
+	var errs []error
+	for i := len(j.steps) - 1; i >= 0; i-- {
+		step := j.steps[i]
+		start := time.Now()
+		err := step.undo(ctx)
+		e := step.event
+		e.Rollback = true
+		e.Duration = event.Since(start)
+		emit(ctx, e, err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("undo %s: %w", step.desc, err))
+		}
+	}
+	j.steps = nil
+	return errors.Join(errs...)
+}
+
+// transaction runs fn, on error Nodes is restored and the operations
+// recorded in the journal are undone, the rollback is not cut short by ctx
+func (m *Manager) transaction(ctx context.Context, fn func(j *journal) error) error {
+	snapshot := copyNodes(m.Nodes)
+	j := &journal{}
+	err := fn(j)
+	if err == nil {
+		return nil
+	}
+	// undo steps that recreate nodes update the restored state
+	m.Nodes = snapshot
+	start := time.Now()
+	rbErr := j.rollback(context.WithoutCancel(ctx), m.emit)
+	if rbErr != nil {
+		err = fmt.Errorf("%w (rollback incomplete: %v)", err, rbErr)
+	}
+	m.emit(ctx, event.Event{Op: event.OpRollback, Duration: event.Since(start)}, err)
+	return err
+}
+
+// copyNodes deep copies the nodes and their rules
+func copyNodes(nodes map[string]api.Node) map[string]api.Node {
+	res := make(map[string]api.Node, len(nodes))
+	for name, n := range nodes {
+		res[name] = copyNode(n)
+	}
+	return res
+}
+
+func copyNode(n api.Node) api.Node {
+	rules := make(map[string]api.LinkProperties, len(n.Rules))
+	for dst, p := range n.Rules {
+		rules[dst] = p
+	}
+	n.Rules = rules
+	n.Routes = append([]api.Route(nil), n.Routes...)
+	return n
+}
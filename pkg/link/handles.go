@@ -0,0 +1,131 @@
+package link
+
+import (
+	"Netlink/api"
+	"Netlink/pkg/node"
+	"errors"
+	"fmt"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+	"sync"
+)
+
+// nsHandle is an open namespace of a node with a netlink socket in it and
+// the index of the node veth, so a tc change is a single netlink message
+// instead of entering the namespace and looking the veth up again
+type nsHandle struct {
+	mu    sync.Mutex // one request at a time on the socket
+	path  string     // NetNs the handle was opened for
+	id    nsId       // namespace found at path when opened
+	ns    netns.NsHandle
+	h     *netlink.Handle
+	index int
+}
+
+// veth returns the node veth for the tc requests, only its index is used
+func (nh *nsHandle) veth() netlink.Link {
+	return &netlink.Device{LinkAttrs: netlink.LinkAttrs{Index: nh.index}}
+}
+
+// nsId identifies a namespace by the inode of its nsfs file
+type nsId struct {
+	dev uint64
+	ino uint64
+}
+
+func statNs(path string) (nsId, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return nsId{}, fmt.Errorf("failed to get namespace for container: %w", err)
+	}
+	return nsId{dev: st.Dev, ino: st.Ino}, nil
+}
+
+func (nh *nsHandle) close() {
+	nh.h.Close()
+	nh.ns.Close()
+}
+
+// withHandle runs fn with the cached handle of n, opening it on first use or
+// when the namespace of n changed, also when it was recreated at the same
+// path. A request failing because the veth is gone is retried once with a
+// new handle.
+func (lm *LinkManager) withHandle(n api.Node, fn func(nh *nsHandle) error) error {
+	for retry := false; ; retry = true {
+		nh, err := lm.handle(n)
+		if err != nil {
+			return err
+		}
+		nh.mu.Lock()
+		err = fn(nh)
+		nh.mu.Unlock()
+		if retry || !errors.Is(err, unix.ENODEV) {
+			return err
+		}
+		lm.log.Debug("stale netlink handle", "node", n.Name, "netns", n.NetNs, "err", err)
+		lm.Forget(n)
+	}
+}
+
+func (lm *LinkManager) handle(n api.Node) (*nsHandle, error) {
+	// a stat is much cheaper than entering the namespace
+	id, err := statNs(n.NetNs)
+	if err != nil {
+		return nil, err
+	}
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	if nh, ok := lm.handles[n.Name]; ok {
+		if nh.path == n.NetNs && nh.id == id {
+			return nh, nil
+		}
+		nh.mu.Lock()
+		nh.close()
+		nh.mu.Unlock()
+		delete(lm.handles, n.Name)
+	}
+
+	nsFd, err := netns.GetFromPath(n.NetNs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get namespace for container: %w", err)
+	}
+	h, err := netlink.NewHandleAt(nsFd, unix.NETLINK_ROUTE)
+	if err != nil {
+		nsFd.Close()
+		return nil, fmt.Errorf("failed to open netlink socket in %s: %w", n.NetNs, err)
+	}
+	link, err := h.LinkByName(n.Name + node.NodeVethSuffix)
+	if err != nil {
+		h.Close()
+		nsFd.Close()
+		return nil, fmt.Errorf("failed to get link by name: %w", err)
+	}
+	nh := &nsHandle{path: n.NetNs, id: id, ns: nsFd, h: h, index: link.Attrs().Index}
+	lm.handles[n.Name] = nh
+	return nh, nil
+}
+
+// Forget closes the cached handle of n, it must be called before n is
+// deleted as the open namespace keeps it and the node veth alive
+func (lm *LinkManager) Forget(n api.Node) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	if nh, ok := lm.handles[n.Name]; ok {
+		nh.mu.Lock()
+		nh.close()
+		nh.mu.Unlock()
+		delete(lm.handles, n.Name)
+	}
+}
+
+// Close closes the handles of all nodes
+func (lm *LinkManager) Close() error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	for name, nh := range lm.handles {
+		nh.close()
+		delete(lm.handles, name)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package link
+
+import (
+	"Netlink/api"
+	"fmt"
+	"github.com/vishvananda/netlink"
+	"math"
+	"net"
+)
+
+// TcState is the traffic control configuration found on the veth of a node
+type TcState struct {
+	RootHtb bool               // HTB qdisc with handle 1: at the root
+	Classes map[uint32]uint64  // classid -> rate in bytes/s
+	Netems  map[uint32]TcNetem // parent classid -> netem qdisc
+	Filters []TcFilter         // u32 filters below 1:
+}
+
+// TcNetem is a netem qdisc, Latency in us and Loss in percentage
+type TcNetem struct {
+	Handle  uint32
+	Latency uint32
+	Loss    float32
+}
+
+// TcFilter is a u32 filter, DstMac is empty for filters not matching on the destination MAC
+type TcFilter struct {
+	ClassId uint32
+	DstMac  string
+}
+
+// ClassRate is the rate in bytes/s the kernel reports for the class of props
+func ClassRate(props api.LinkProperties) uint64 {
+	return props.Rate * 1024 * 1024 / 8
+}
+
+// ReadTc lists the qdiscs, classes and filters on the veth of n
+func (lm *LinkManager) ReadTc(n api.Node) (*TcState, error) {
+	state := &TcState{
+		Classes: make(map[uint32]uint64),
+		Netems:  make(map[uint32]TcNetem),
+	}
+
+	err := lm.withHandle(n, func(nh *nsHandle) error {
+		link := nh.veth()
+
+		qdiscs, err := nh.h.QdiscList(link)
+		if err != nil {
+			return fmt.Errorf("failed to list qdiscs: %w", err)
+		}
+		for _, q := range qdiscs {
+			switch q := q.(type) {
+			case *netlink.Htb:
+				if q.Parent == netlink.HANDLE_ROOT && q.Handle == netlink.MakeHandle(1, 0) {
+					state.RootHtb = true
+				}
+			case *netlink.Netem:
+				// the latency is reported in ticks
+				state.Netems[q.Parent] = TcNetem{
+					Handle:  q.Handle,
+					Latency: uint32(math.Round(float64(q.Latency) / netlink.TickInUsec())),
+					Loss:    float32(float64(q.Loss) / math.MaxUint32 * 100),
+				}
+			}
+		}
+		if !state.RootHtb {
+			return nil
+		}
+
+		classes, err := nh.h.ClassList(link, netlink.MakeHandle(1, 0))
+		if err != nil {
+			return fmt.Errorf("failed to list classes: %w", err)
+		}
+		for _, c := range classes {
+			if htb, ok := c.(*netlink.HtbClass); ok {
+				state.Classes[htb.Handle] = htb.Rate
+			}
+		}
+
+		filters, err := nh.h.FilterList(link, netlink.MakeHandle(1, 0))
+		if err != nil {
+			return fmt.Errorf("failed to list filters: %w", err)
+		}
+		for _, f := range filters {
+			u32, ok := f.(*netlink.U32)
+			if !ok || u32.ClassId == 0 {
+				continue
+			}
+			filter := TcFilter{ClassId: u32.ClassId}
+			if u32.Sel != nil {
+				filter.DstMac = keysMac(u32.Sel.Keys)
+			}
+			state.Filters = append(state.Filters, filter)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// keysMac returns the destination MAC address the keys of MacKeys match,
+// empty if they match something else
+func keysMac(keys []netlink.TcU32Key) string {
+	var hi, lo *netlink.TcU32Key
+	for i, key := range keys {
+		switch {
+		case key.Off == -14 && key.Mask == 0xffffffff:
+			hi = &keys[i]
+		case key.Off == -12 && key.Mask == 0x0000ffff:
+			lo = &keys[i]
+		}
+	}
+	if hi == nil || lo == nil {
+		return ""
+	}
+	return net.HardwareAddr{byte(hi.Val >> 24), byte(hi.Val >> 16), byte(hi.Val >> 8), byte(hi.Val),
+		byte(lo.Val >> 8), byte(lo.Val)}.String()
+}
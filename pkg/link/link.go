@@ -3,43 +3,67 @@ package link
 import (
 	"Netlink/api"
 	"Netlink/pkg/ovs"
+	"Netlink/pkg/routing"
+	"log/slog"
+	"sort"
+	"sync"
 )
 
+// LinkManager installs the tc configuration of links in the node namespaces,
+// through a netlink handle per node kept open until Forget
 type LinkManager struct {
-	om *ovs.OvsManager
+	log     *slog.Logger
+	mu      sync.Mutex
+	handles map[string]*nsHandle // node name -> handle
 }
 
-func NewLinkManager(o *ovs.OvsManager) *LinkManager {
+func NewLinkManager(logger *slog.Logger) *LinkManager {
 	return &LinkManager{
-		om: o,
+		log:     logger,
+		handles: make(map[string]*nsHandle),
 	}
 }
 
-func (lm *LinkManager) ApplyLink(src api.Node) error {
-	if len(src.Rules) == 0 {
-		return nil
-	}
+// Shaper installs the classes of one link direction,
+// LinkManager does it with netlink
+type Shaper interface {
+	AddHtbClass(n api.Node, props api.LinkProperties) error
+	ReplaceHtbClass(n api.Node, old, props api.LinkProperties) error
+}
 
+// Buckets returns the group buckets forwarding to every destination of src,
+// sorted by name: ,bucket=output:"node1-ovs",bucket=output:"node2-ovs".
+// Directions that are routing.Down get none, no packet of src reaches the
+// peer, including the multicast hellos of routing protocols no filter shapes.
+func Buckets(src api.Node) string {
+	dsts := make([]string, 0, len(src.Rules))
+	for dst, props := range src.Rules {
+		if !routing.Down(props) {
+			dsts = append(dsts, dst)
+		}
+	}
+	sort.Strings(dsts)
 	var output string
-	for dst := range src.Rules {
-		output += ",bucket=output:\"" + dst + ovs.VethOvsSideSuffix + "\"" // ,bucket=output:"node1-ovs",bucket=output:"node2-ovs"
+	for _, dst := range dsts {
+		output += ",bucket=output:\"" + dst + ovs.VethOvsSideSuffix + "\""
 	}
-	return lm.om.AddFlowsByLink(src, output)
+	return output
 }
 
 // ApplyLinkProperties : Apply link properties only for unidirectional link
 // directional link should be handled by the caller
-func (lm *LinkManager) ApplyLinkProperties(link *api.Link, ingress *api.Node, dst api.Node) error {
+func ApplyLinkProperties(s Shaper, link *api.Link, ingress *api.Node, dst api.Node) error {
 	link.Properties.DstIP = dst.Interface.Ipv4
+	link.Properties.DstMac = dst.Interface.Mac
 	// Check if the rule is new
 	if _, existed := ingress.Rules[link.DstNode]; existed {
 		if ingress.Rules[link.DstNode].HTBClassid == 0 {
 			// CreateHtbClass will modify ingress.Rules
-			return lm.CreateHtbClass(link, ingress)
+			return CreateHtbClass(s, link, ingress)
 		}
-		return lm.UpdateHtbClass(link, ingress)
+		return UpdateHtbClass(s, link, ingress)
 	} else {
 		// CreateHtbClass will modify ingress.Rules
-		return lm.CreateHtbClass(link, ingress)
+		return CreateHtbClass(s, link, ingress)
 	}
 }
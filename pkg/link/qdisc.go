@@ -2,12 +2,9 @@ package link
 
 import (
 	"Netlink/api"
-	"Netlink/pkg/node"
 	"fmt"
-	ns "github.com/containernetworking/plugins/pkg/ns"
 	"github.com/vishvananda/netlink"
 	"golang.org/x/sys/unix"
-	"log"
 	"net"
 	"strings"
 )
@@ -18,36 +15,25 @@ const (
 
 // 1. Only finish htb qdisc
 // 2. Use 1:0 as all parent handle
-// 3. Filter by destination IP
+// 3. Filter by destination MAC: the next hop, so routed packets are shaped
+//    like those to the neighbour. Multicast such as OSPF hellos is sent
+//    unshaped, only a direction that is down drops it (see Buckets).
 
 // CreateRootQdisc : tc qdisc add dev eth0 root handle 1: htb default 30
 func (lm *LinkManager) CreateRootQdisc(n api.Node) error {
-	// enter container namespace
-	containerNs, err := ns.GetNS(n.NetNs)
-	if err != nil {
-		return fmt.Errorf("failed to get namespace for container: %v", err)
-	}
-	defer containerNs.Close()
-
-	err = containerNs.Do(func(_ ns.NetNS) error {
-		// get link by name
-		link, err := netlink.LinkByName(n.Name + node.NodeVethSuffix)
-		if err != nil {
-			return fmt.Errorf("failed to get link by name: %v", err)
-		}
-
+	err := lm.withHandle(n, func(nh *nsHandle) error {
 		// set HTB root qdisc
 		qdisc := netlink.NewHtb(
 			netlink.QdiscAttrs{
-				LinkIndex: link.Attrs().Index,
+				LinkIndex: nh.index,
 				Handle:    netlink.MakeHandle(1, 0), // root qdisc
 				Parent:    netlink.HANDLE_ROOT,      // root handle
 			})
 		qdisc.Defcls = 1 // Default classid 1:1
 
 		// add HTB root qdisc
-		if err := netlink.QdiscAdd(qdisc); err != nil {
-			return fmt.Errorf("failed to add HTB root qdisc: %v", err)
+		if err := nh.h.QdiscAdd(qdisc); err != nil {
+			return fmt.Errorf("failed to add HTB root qdisc: %w", err)
 		}
 		return nil
 	})
@@ -57,11 +43,11 @@ func (lm *LinkManager) CreateRootQdisc(n api.Node) error {
 
 // CreateHtbClass :
 // tc class add dev eth0 parent 1: classid 1:2 htb rate 1mbit burst 10000
-// tc filter add dev eth0 protocol ip parent 1:0 prio 1 u32 match ip dst 192.168.1.1 flowid 1:2
+// tc filter add dev eth0 protocol all parent 1:0 prio 1 u32 match ether dst 02:4e:4c:00:00:02 flowid 1:2
 // tc qdisc add dev eth0 parent 1:2 handle 10: netem delay 100ms  # here parent is bw control classid
 // will modify node.Rules, record the classid
 // bw control comes before loss and latency
-func (lm *LinkManager) CreateHtbClass(l *api.Link, n *api.Node) error {
+func CreateHtbClass(s Shaper, l *api.Link, n *api.Node) error {
 
 	if l.Properties.Latency <= 0 && l.Properties.Rate <= 0 && l.Properties.Loss <= 0 {
 		return nil
@@ -69,28 +55,29 @@ func (lm *LinkManager) CreateHtbClass(l *api.Link, n *api.Node) error {
 	if l.Properties.Rate <= 0 {
 		l.Properties.Rate = MaxRate
 	}
-	l.Properties.HTBClassid = netlink.MakeHandle(1, uint16(len(n.Rules)+2)) // +2 for root and default class
-	l.Properties.NetemHandleId = netlink.MakeHandle(uint16(len(n.Rules)+2), 0)
+	l.Properties.HTBClassid, l.Properties.NetemHandleId = NextHandles(*n)
 	n.Rules[l.DstNode] = l.Properties
 
-	// enter container namespace
-	containerNs, err := ns.GetNS(n.NetNs)
-	if err != nil {
-		return fmt.Errorf("failed to get namespace for container: %v", err)
-	}
-	defer containerNs.Close()
+	return s.AddHtbClass(*n, l.Properties)
+}
 
-	err = containerNs.Do(func(_ ns.NetNS) error {
-		// get link by name
-		link, err := netlink.LinkByName(n.Name + node.NodeVethSuffix)
-		if err != nil {
-			return fmt.Errorf("failed to get link by name: %v", err)
-		}
+// NextHandles returns the classid and netem handle CreateHtbClass assigns on n
+func NextHandles(n api.Node) (classid uint32, netem uint32) {
+	classid = netlink.MakeHandle(1, uint16(len(n.Rules)+2)) // +2 for root and default class
+	netem = netlink.MakeHandle(uint16(len(n.Rules)+2), 0)
+	return classid, netem
+}
 
+// AddHtbClass installs class, filter and netem qdisc of props with the
+// classid and netem handle already recorded in props
+func (lm *LinkManager) AddHtbClass(n api.Node, props api.LinkProperties) error {
+	l := &api.Link{Properties: props}
+
+	err := lm.withHandle(n, func(nh *nsHandle) error {
 		// 1. bw control
 		class := netlink.NewHtbClass(
 			netlink.ClassAttrs{
-				LinkIndex: link.Attrs().Index,
+				LinkIndex: nh.index,
 				Handle:    l.Properties.HTBClassid,  // classid 1:2
 				Parent:    netlink.MakeHandle(1, 0), // parent 1:
 			},
@@ -101,46 +88,39 @@ func (lm *LinkManager) CreateHtbClass(l *api.Link, n *api.Node) error {
 			},
 		)
 
-		if err := netlink.ClassAdd(class); err != nil {
-			return fmt.Errorf("failed to add HTB class: %v", err)
+		if err := nh.h.ClassAdd(class); err != nil {
+			return fmt.Errorf("failed to add HTB class: %w", err)
 		}
 
-		// 2. filter by destination IP
-		ipInt, err := IpToInt(l.Properties.DstIP)
+		// 2. filter by destination MAC
+		keys, err := MacKeys(l.Properties.DstMac)
 		if err != nil {
 			return err
 		}
 
 		filter := &netlink.U32{
 			FilterAttrs: netlink.FilterAttrs{
-				LinkIndex: link.Attrs().Index,
+				LinkIndex: nh.index,
 				Parent:    netlink.MakeHandle(1, 0),
 				Handle:    netlink.MakeHandle(1, 0),
 				Priority:  1,
-				Protocol:  unix.ETH_P_IP,
+				Protocol:  unix.ETH_P_ALL,
 			},
-			// Match dst IP 192.168.1.1
 			Sel: &netlink.TcU32Sel{
-				Keys: []netlink.TcU32Key{
-					{
-						Mask: 0xffffffff,
-						Val:  ipInt, // Using the converted IP integer
-						Off:  16,    // Offset for dst IP (12 for src IP)
-					},
-				},
+				Keys:  keys,
 				Flags: netlink.TC_U32_TERMINAL, // Terminal action, no further classification. IMPORTANT!
 			},
 			ClassId: l.Properties.HTBClassid,
 		}
 
-		if err := netlink.FilterAdd(filter); err != nil {
-			return fmt.Errorf("failed to add u32 filter: %v", err)
+		if err := nh.h.FilterAdd(filter); err != nil {
+			return fmt.Errorf("failed to add u32 filter: %w", err)
 		}
 
 		// 3. add netem qdisc
 		if l.Properties.Latency > 0 || l.Properties.Loss > 0 {
 			netemQdisc := netlink.NewNetem(netlink.QdiscAttrs{
-				LinkIndex: link.Attrs().Index,
+				LinkIndex: nh.index,
 				Parent:    l.Properties.HTBClassid,
 				Handle:    l.Properties.NetemHandleId, // Not important
 			}, netlink.NetemQdiscAttrs{
@@ -149,8 +129,8 @@ func (lm *LinkManager) CreateHtbClass(l *api.Link, n *api.Node) error {
 				Limit:   300000,
 			})
 
-			if err := netlink.QdiscAdd(netemQdisc); err != nil {
-				return fmt.Errorf("failed to add netem qdisc to %s: %v", n.Name, err)
+			if err := nh.h.QdiscAdd(netemQdisc); err != nil {
+				return fmt.Errorf("failed to add netem qdisc to %s: %w", n.Name, err)
 			}
 		}
 
@@ -160,9 +140,9 @@ func (lm *LinkManager) CreateHtbClass(l *api.Link, n *api.Node) error {
 	return err
 }
 
-// UpdateHtbClass :
-// tc class change dev node1-veth0 parent 1: classid 1:2 htb rate 1mbit burst 10000
-func (lm *LinkManager) UpdateHtbClass(l *api.Link, n *api.Node) error {
+// UpdateHtbClass changes the properties of the existing class of l,
+// keeping its classid, netem handle and destination
+func UpdateHtbClass(s Shaper, l *api.Link, n *api.Node) error {
 	var oldRule = n.Rules[l.DstNode]
 	if l.Properties.Rate <= 0 {
 		l.Properties.Rate = MaxRate
@@ -172,27 +152,24 @@ func (lm *LinkManager) UpdateHtbClass(l *api.Link, n *api.Node) error {
 	}
 	l.Properties.HTBClassid = oldRule.HTBClassid
 	l.Properties.DstIP = oldRule.DstIP
+	l.Properties.DstMac = oldRule.DstMac
 	l.Properties.NetemHandleId = oldRule.NetemHandleId
 	n.Rules[l.DstNode] = l.Properties
 
-	// enter container namespace
-	containerNs, err := ns.GetNS(n.NetNs)
-	if err != nil {
-		return fmt.Errorf("failed to get namespace for container: %v", err)
-	}
-	defer containerNs.Close()
+	return s.ReplaceHtbClass(*n, oldRule, l.Properties)
+}
 
-	err = containerNs.Do(func(_ ns.NetNS) error {
-		// get link by name
-		link, err := netlink.LinkByName(n.Name + node.NodeVethSuffix)
-		if err != nil {
-			return fmt.Errorf("failed to get link by name: %v", err.Error())
-		}
+// ReplaceHtbClass changes the rate and netem of the class of props where they differ from old:
+// tc class change dev node1-veth0 parent 1: classid 1:2 htb rate 1mbit burst 10000
+func (lm *LinkManager) ReplaceHtbClass(n api.Node, oldRule api.LinkProperties, props api.LinkProperties) error {
+	l := &api.Link{Properties: props}
+
+	err := lm.withHandle(n, func(nh *nsHandle) error {
 		// Update Htb class (bw control)
 		if l.Properties.Rate != oldRule.Rate {
 			newHtbClass := netlink.NewHtbClass(
 				netlink.ClassAttrs{
-					LinkIndex: link.Attrs().Index,
+					LinkIndex: nh.index,
 					Handle:    l.Properties.HTBClassid,  // classid 1:2
 					Parent:    netlink.MakeHandle(1, 0), // parent 1:
 				},
@@ -202,16 +179,17 @@ func (lm *LinkManager) UpdateHtbClass(l *api.Link, n *api.Node) error {
 					Prio:   1,
 				},
 			)
-			if err := netlink.ClassReplace(newHtbClass); err != nil {
-				return fmt.Errorf("failed to update HTB class: %v", err)
+			if err := nh.h.ClassReplace(newHtbClass); err != nil {
+				return fmt.Errorf("failed to update HTB class: %w", err)
 			}
 		}
 
 		// Update netem qdisc
 		if l.Properties.Latency != oldRule.Latency || l.Properties.Loss != oldRule.Loss {
-			log.Println("update netem qdisc: ", l.Properties.HTBClassid, oldRule.NetemHandleId)
+			lm.log.Debug("update netem qdisc", "op", "netem.replace", "node", n.Name, "dst", l.Properties.DstIP,
+				"netns", n.NetNs, "classid", l.Properties.HTBClassid, "handle", oldRule.NetemHandleId)
 			newNetemQdisc := netlink.NewNetem(netlink.QdiscAttrs{
-				LinkIndex: link.Attrs().Index,
+				LinkIndex: nh.index,
 				Parent:    l.Properties.HTBClassid,
 				Handle:    l.Properties.NetemHandleId,
 			}, netlink.NetemQdiscAttrs{
@@ -219,14 +197,65 @@ func (lm *LinkManager) UpdateHtbClass(l *api.Link, n *api.Node) error {
 				Loss:    l.Properties.Loss,           // loss 10%
 				Limit:   300000,
 			})
-			if err := netlink.QdiscReplace(newNetemQdisc); err != nil {
-				return fmt.Errorf("failed to update netem qdisc: %v", err)
+			if err := nh.h.QdiscReplace(newNetemQdisc); err != nil {
+				return fmt.Errorf("failed to update netem qdisc: %w", err)
 			}
 		}
 		return nil
 	})
 
-	return nil
+	return err
+}
+
+// DeleteHtbClass removes the filter, netem qdisc and class installed for props,
+// parts that do not exist are skipped
+func (lm *LinkManager) DeleteHtbClass(n api.Node, props api.LinkProperties) error {
+	if props.HTBClassid == 0 {
+		return nil
+	}
+	return lm.withHandle(n, func(nh *nsHandle) error {
+		link := nh.veth()
+
+		// the class cannot be deleted while a filter points to it
+		filters, err := nh.h.FilterList(link, netlink.MakeHandle(1, 0))
+		if err != nil {
+			return fmt.Errorf("failed to list filters: %w", err)
+		}
+		for _, f := range filters {
+			if u32, ok := f.(*netlink.U32); ok && u32.ClassId == props.HTBClassid {
+				if err := nh.h.FilterDel(u32); err != nil {
+					return fmt.Errorf("failed to delete u32 filter: %w", err)
+				}
+			}
+		}
+
+		// the netem qdisc is removed together with its parent class
+		classes, err := nh.h.ClassList(link, netlink.MakeHandle(1, 0))
+		if err != nil {
+			return fmt.Errorf("failed to list classes: %w", err)
+		}
+		for _, c := range classes {
+			if c.Attrs().Handle == props.HTBClassid {
+				if err := nh.h.ClassDel(c); err != nil {
+					return fmt.Errorf("failed to delete HTB class: %w", err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// MacKeys returns the u32 keys matching the destination MAC address mac,
+// at offsets before the network header like tc u32 match ether dst
+func MacKeys(mac string) ([]netlink.TcU32Key, error) {
+	hw, err := net.ParseMAC(mac)
+	if err != nil || len(hw) != 6 {
+		return nil, fmt.Errorf("invalid MAC address: %q", mac)
+	}
+	return []netlink.TcU32Key{
+		{Mask: 0xffffffff, Val: uint32(hw[0])<<24 | uint32(hw[1])<<16 | uint32(hw[2])<<8 | uint32(hw[3]), Off: -14},
+		{Mask: 0x0000ffff, Val: uint32(hw[4])<<8 | uint32(hw[5]), Off: -12},
+	}, nil
 }
 
 func IpToInt(IP string) (uint32, error) {
@@ -0,0 +1,80 @@
+package link
+
+import (
+	"Netlink/api"
+	"fmt"
+	"github.com/vishvananda/netlink"
+)
+
+// Counters are the statistics the kernel keeps for a class or qdisc
+type Counters struct {
+	Bytes      uint64
+	Packets    uint64
+	Drops      uint64
+	Overlimits uint64
+	Backlog    uint64 // bytes queued
+	Qlen       uint64 // packets queued
+}
+
+// ClassStats are the counters of an HTB class and the netem qdisc below it
+type ClassStats struct {
+	Class    Counters
+	Netem    Counters
+	HasNetem bool
+}
+
+func counters(s *netlink.ClassStatistics) Counters {
+	var c Counters
+	if s == nil {
+		return c
+	}
+	if s.Basic != nil {
+		c.Bytes = s.Basic.Bytes
+		c.Packets = uint64(s.Basic.Packets)
+	}
+	if s.Queue != nil {
+		c.Drops = uint64(s.Queue.Drops)
+		c.Overlimits = uint64(s.Queue.Overlimits)
+		c.Backlog = uint64(s.Queue.Backlog)
+		c.Qlen = uint64(s.Queue.Qlen)
+	}
+	return c
+}
+
+// ReadStats returns the counters of every HTB class on the veth of n by classid
+func (lm *LinkManager) ReadStats(n api.Node) (map[uint32]ClassStats, error) {
+	stats := make(map[uint32]ClassStats)
+
+	err := lm.withHandle(n, func(nh *nsHandle) error {
+		link := nh.veth()
+
+		classes, err := nh.h.ClassList(link, netlink.MakeHandle(1, 0))
+		if err != nil {
+			return fmt.Errorf("failed to list classes: %w", err)
+		}
+		for _, c := range classes {
+			if _, ok := c.(*netlink.HtbClass); ok {
+				stats[c.Attrs().Handle] = ClassStats{Class: counters(c.Attrs().Statistics)}
+			}
+		}
+
+		qdiscs, err := nh.h.QdiscList(link)
+		if err != nil {
+			return fmt.Errorf("failed to list qdiscs: %w", err)
+		}
+		for _, q := range qdiscs {
+			if _, ok := q.(*netlink.Netem); !ok {
+				continue
+			}
+			s := stats[q.Attrs().Parent]
+			s.Netem = counters((*netlink.ClassStatistics)(q.Attrs().Statistics))
+			s.HasNetem = true
+			stats[q.Attrs().Parent] = s
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
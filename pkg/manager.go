@@ -2,41 +2,222 @@ package pkg
 
 import (
 	"Netlink/api"
+	"Netlink/pkg/event"
+	"Netlink/pkg/generator"
 	"Netlink/pkg/link"
 	"Netlink/pkg/node"
 	"Netlink/pkg/ovs"
+	"Netlink/pkg/routing"
+	"Netlink/pkg/validate"
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
 )
 
+// ErrNodeNotFound is returned when an operation refers to an unknown node
+var ErrNodeNotFound = errors.New("node not found")
+
 // Manager handles the management of nodes, links, and network configurations
 // in the system. It is responsible for adding nodes, linking nodes, applying
 // link properties, and cleaning up resources when destroyed.
 type Manager struct {
+	// mu guards Nodes, readers such as the metrics endpoint run
+	// concurrently with the interactive session
+	mu    sync.RWMutex
 	Nodes map[string]api.Node // map node name to node
-	om    *ovs.OvsManager
-	lm    *link.LinkManager
-	cm    *node.ContainerManager
-	ctx   context.Context
+	// nodesMu serializes access to Nodes between the workers of Apply,
+	// which all run under mu
+	nodesMu sync.Mutex
+	sw      Switch
+	tc      TrafficControl
+	rt      NodeRuntime
+	cfg     Config
+	events  *event.Bus
+	log     *slog.Logger
+	// routing is the mode routes are installed by, set by Apply
+	routing api.Routing
+	// stopWatch stops re-plumbing restarted nodes
+	stopWatch func()
+}
+
+// Config holds the settings of a Manager, zero values select the defaults
+type Config struct {
+	Bridge   string // OVS bridge name, ovs.DefaultBridge if empty
+	Image    string // image for nodes without one, node.DefaultImage if empty
+	Registry string // registry images naming none are pulled from, docker hub if empty
+	IPPool   string // CIDR for automatically assigned addresses, util.DefaultIPPool if empty
+	// nodes or links Apply provisions at once, DefaultParallelism if 0
+	Parallelism int
+	Logger      *slog.Logger // logger of the manager and its OVS, container and link managers, slog.Default() if nil
+
+	// implementations replacing OVS, docker and netlink, e.g. the fakes
+	// of package fake, nil selects the real one. The docker runtime
+	// needs the OVS switch.
+	Switch         Switch
+	Runtime        NodeRuntime
+	TrafficControl TrafficControl
+}
+
+// NewManager creates a new Manager instance with its OVS manager,
+// container manager and link manager unless cfg provides them
+func NewManager(ctx context.Context, cfg Config) (*Manager, error) {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	sw := cfg.Switch
+	if sw == nil {
+		om, err := ovs.NewOvsManager(cfg.Bridge, logger)
+		if err != nil {
+			return nil, err
+		}
+		sw = om
+	}
+	rt := cfg.Runtime
+	if rt == nil {
+		om, ok := sw.(*ovs.OvsManager)
+		if !ok {
+			return nil, errors.New("the docker runtime needs the OVS switch, provide a Runtime")
+		}
+		cm, err := node.NewContainerManager(om, cfg.Image, cfg.Registry, cfg.IPPool, logger)
+		if err != nil {
+			return nil, errors.Join(err, om.DeleteBridge())
+		}
+		// netns nodes work without docker
+		if err = cm.Ping(ctx); err != nil {
+			logger.Warn("only netns nodes can be created", "err", err)
+		}
+		rt = cm
+	}
+	tc := cfg.TrafficControl
+	if tc == nil {
+		tc = link.NewLinkManager(logger)
+	}
+
+	m := &Manager{
+		Nodes:  make(map[string]api.Node),
+		sw:     sw,
+		tc:     tc,
+		rt:     rt,
+		cfg:    cfg,
+		events: event.NewBus(),
+		log:    logger,
+	}
+	m.stopWatch = m.watchRestarts()
+	return m, nil
 }
 
-// NewManager creates a new Manager instance with the default OVS manager
-// and container manager.
-func NewManager() *Manager {
-	om := ovs.NewOvsManager()
-	cm := node.NewContainerManager(om)
-	lm := link.NewLinkManager(om)
+// Node returns a copy of the node with the given name
+func (m *Manager) Node(name string) (api.Node, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n, ok := m.Nodes[name]
+	if !ok {
+		return n, false
+	}
+	return copyNode(n), true
+}
 
-	return &Manager{
-		Nodes: make(map[string]api.Node),
-		om:    om,
-		lm:    lm,
-		cm:    cm,
-		ctx:   context.Background(),
+// NodeList returns a copy of all nodes ordered by Uid
+func (m *Manager) NodeList() []api.Node {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.nodeList()
+}
+
+func (m *Manager) nodeList() []api.Node {
+	nodes := make([]api.Node, 0, len(m.Nodes))
+	for _, n := range m.Nodes {
+		nodes = append(nodes, copyNode(n))
 	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Uid < nodes[j].Uid })
+	return nodes
 }
 
-func (m *Manager) AddNode(n api.Node) error {
+// LinkList returns every configured direction as a unidirectional link,
+// ordered by source Uid and destination name
+func (m *Manager) LinkList() []api.Link {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.linkList()
+}
+
+func (m *Manager) linkList() []api.Link {
+	var links []api.Link
+	for _, n := range m.nodeList() {
+		dsts := make([]string, 0, len(n.Rules))
+		for dst := range n.Rules {
+			dsts = append(dsts, dst)
+		}
+		sort.Strings(dsts)
+		for _, dst := range dsts {
+			links = append(links, api.Link{
+				SrcNode:        n.Name,
+				DstNode:        dst,
+				Properties:     n.Rules[dst],
+				UniDirectional: true,
+				SrcIntf:        n.Interface,
+				DstIntf:        m.Nodes[dst].Interface,
+			})
+		}
+	}
+	return links
+}
+
+// AddNode creates a node, replacing an existing node with the same name.
+// On failure everything it did is undone.
+func (m *Manager) AddNode(ctx context.Context, n api.Node) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.rt.EnsureImages(ctx, []api.Node{n}); err != nil {
+		return err
+	}
+	n.Uid = m.rt.ReserveUid()
+	return m.transaction(ctx, func(j *journal) error {
+		if err := m.addNode(ctx, j, n); err != nil {
+			return err
+		}
+		if err := m.setGateway(m.Nodes[n.Name]); err != nil {
+			return err
+		}
+		if err := m.updateRoutes(j); err != nil {
+			return err
+		}
+		return m.updateFrr(ctx, j)
+	})
+}
+
+// AddLink creates or updates a link between two existing nodes.
+// On failure everything it did is undone.
+func (m *Manager) AddLink(ctx context.Context, l api.Link) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.transaction(ctx, func(j *journal) error {
+		if err := m.addLink(ctx, j, l, nil); err != nil {
+			return err
+		}
+		if err := m.updateRoutes(j); err != nil {
+			return err
+		}
+		return m.updateFrr(ctx, j)
+	})
+}
+
+// addNode creates n with the Uid reserved for it, replacing the node with its name
+func (m *Manager) addNode(ctx context.Context, j *journal, n api.Node) (err error) {
+	start := time.Now()
+	op := event.OpNodeAdd
+	old, existed := m.lookupNode(n.Name)
+	if existed {
+		op = event.OpNodeReplace
+	}
+	defer func() {
+		m.emit(ctx, event.Event{Op: op, Node: n.Name, Duration: event.Since(start)}, err)
+	}()
 
 	// Initialize
 	if n.Rules == nil {
@@ -44,45 +225,74 @@ func (m *Manager) AddNode(n api.Node) error {
 	}
 
 	// check if existed
-	if _, existed := m.Nodes[n.Name]; existed {
-		if err := m.cm.DeleteNode(m.ctx, &n); err != nil {
+	if existed {
+		if err := m.deleteNode(ctx, &old); err != nil {
 			return err
 		}
+		j.record("delete node "+old.Name, event.Event{Op: event.OpNodeAdd, Node: old.Name}, func(ctx context.Context) error {
+			return m.restoreNode(ctx, old)
+		})
 	}
 
-	m.Nodes[n.Name] = n
-	err := m.cm.AddNode(m.ctx, &n)
+	m.storeNode(n)
+	// the runtime removes what it created when it fails, a container or
+	// namespace of the same name it could not create is not ours to delete
+	err = m.rt.AddNode(ctx, &n)
 	if err != nil {
 		return err
 	}
-	if err = m.lm.CreateRootQdisc(n); err != nil {
+	j.record("create node "+n.Name, event.Event{Op: event.OpNodeDelete, Node: n.Name}, func(ctx context.Context) error {
+		return m.deleteNode(ctx, &n)
+	})
+	if err = m.tc.CreateRootQdisc(n); err != nil {
 		return err
 	}
 	// update node
-	m.Nodes[n.Name] = n
+	m.storeNode(n)
 
 	return nil
 }
 
-func (m *Manager) AddLink(l api.Link) error {
+// deleteNode closes the tc handle of n, which keeps its namespace
+// alive, and deletes n
+func (m *Manager) deleteNode(ctx context.Context, n *api.Node) error {
+	m.tc.Forget(*n)
+	return m.rt.DeleteNode(ctx, n)
+}
+
+// addLink creates or updates both directions of l, the group buckets
+// are set at once unless groups collects them
+func (m *Manager) addLink(ctx context.Context, j *journal, l api.Link, groups *groupBatch) error {
 	// check invalid link
-	if _, existed := m.Nodes[l.SrcNode]; !existed {
-		return fmt.Errorf("src node %s not found", l.SrcNode)
+	src, existed := m.lookupNode(l.SrcNode)
+	if !existed {
+		return fmt.Errorf("src node %s: %w", l.SrcNode, ErrNodeNotFound)
 	}
-	if _, existed := m.Nodes[l.DstNode]; !existed {
-		return fmt.Errorf("dst node %s not found", l.DstNode)
+	dst, existed := m.lookupNode(l.DstNode)
+	if !existed {
+		return fmt.Errorf("dst node %s: %w", l.DstNode, ErrNodeNotFound)
 	}
 
-	// check src name and dst name
-	src := m.Nodes[l.SrcNode]
-	dst := m.Nodes[l.DstNode]
 	l.SrcIntf = src.Interface
 	l.DstIntf = dst.Interface
 
+	// link.add for new directions, link.update for configured ones
+	ops := [2]string{event.OpLinkUpdate, event.OpLinkUpdate}
+	if _, existed := src.Rules[l.DstNode]; !existed {
+		ops[0] = event.OpLinkAdd
+	}
+	if _, existed := dst.Rules[l.SrcNode]; !existed {
+		ops[1] = event.OpLinkAdd
+	}
+
+	// a direction going down or up changes the buckets
+	wasDown := [2]bool{routing.Down(src.Rules[l.DstNode]), routing.Down(dst.Rules[l.SrcNode])}
+
 	// check if existed
 	if _, existed := src.Rules[l.DstNode]; !existed {
 		src.Rules[l.DstNode] = api.LinkProperties{}
-		if err := m.lm.ApplyLink(src); err != nil {
+		m.recordRule(j, src, l.DstNode)
+		if err := m.updateGroup(src, groups); err != nil {
 			return err
 		}
 	}
@@ -90,13 +300,14 @@ func (m *Manager) AddLink(l api.Link) error {
 	// directional link
 	if _, existed := dst.Rules[l.SrcNode]; !existed {
 		dst.Rules[l.SrcNode] = api.LinkProperties{}
-		if err := m.lm.ApplyLink(dst); err != nil {
+		m.recordRule(j, dst, l.SrcNode)
+		if err := m.updateGroup(dst, groups); err != nil {
 			return err
 		}
 	}
 
 	// Apply Properties
-	if err := m.lm.ApplyLinkProperties(&l, &src, dst); err != nil {
+	if err := m.applyLinkProperties(ctx, j, l, &src, dst, ops[0]); err != nil {
 		return err
 	}
 
@@ -104,28 +315,303 @@ func (m *Manager) AddLink(l api.Link) error {
 		var bio_link = l
 		bio_link.SrcNode = l.DstNode
 		bio_link.DstNode = l.SrcNode
-		if err := m.lm.ApplyLinkProperties(&bio_link, &dst, src); err != nil {
+		if err := m.applyLinkProperties(ctx, j, bio_link, &dst, src, ops[1]); err != nil {
 			return err
 		}
 
 	}
+	if routing.Down(src.Rules[l.DstNode]) != wasDown[0] {
+		if err := m.regroup(j, src, groups); err != nil {
+			return err
+		}
+	}
+	if routing.Down(dst.Rules[l.SrcNode]) != wasDown[1] {
+		if err := m.regroup(j, dst, groups); err != nil {
+			return err
+		}
+	}
 	// update src & dst node
-	m.Nodes[l.SrcNode] = src
-	m.Nodes[l.DstNode] = dst
+	m.storeNode(src)
+	m.storeNode(dst)
+
+	return nil
+}
+
+// recordRule records how to undo a new rule of n: drop it and
+// restore the group buckets
+func (m *Manager) recordRule(j *journal, n api.Node, dst string) {
+	e := event.Event{Op: event.OpLinkDelete, Link: &event.Link{Src: n.Name, Dst: dst}}
+	j.record(fmt.Sprintf("rule %s -> %s", n.Name, dst), e, func(ctx context.Context) error {
+		delete(n.Rules, dst)
+		return m.applyLink(n)
+	})
+}
+
+// regroup sets the buckets of n after a direction went down or up, on
+// rollback the buckets of the restored node are set again
+func (m *Manager) regroup(j *journal, n api.Node, groups *groupBatch) error {
+	j.record("group of "+n.Name, event.Event{Op: event.OpUndo, Node: n.Name}, func(ctx context.Context) error {
+		// nodes created by the transaction are deleted instead
+		if old, ok := m.Nodes[n.Name]; ok {
+			return m.applyLink(old)
+		}
+		return nil
+	})
+	return m.updateGroup(n, groups)
+}
 
+// applyLinkProperties applies one direction of l and records how to undo it:
+// a new class is deleted, an updated class gets its previous properties back
+func (m *Manager) applyLinkProperties(ctx context.Context, j *journal, l api.Link, ingress *api.Node, dst api.Node, op string) (err error) {
+	old := ingress.Rules[l.DstNode]
+	start := time.Now()
+	defer func() {
+		e := event.Event{
+			Op:       op,
+			Link:     &event.Link{Src: l.SrcNode, Dst: l.DstNode},
+			New:      eventProperties(ingress.Rules[l.DstNode]),
+			Duration: event.Since(start),
+		}
+		if op == event.OpLinkUpdate {
+			e.Old = eventProperties(old)
+		}
+		m.emit(ctx, e, err)
+	}()
+	n := *ingress
+	undo := event.Event{Op: event.OpLinkUpdate, Link: &event.Link{Src: l.SrcNode, Dst: l.DstNode}, New: eventProperties(old)}
+	j.record(fmt.Sprintf("properties %s -> %s", l.SrcNode, l.DstNode), undo, func(ctx context.Context) error {
+		if old.HTBClassid == 0 {
+			return m.tc.DeleteHtbClass(n, n.Rules[l.DstNode])
+		}
+		restore := api.Link{SrcNode: l.SrcNode, DstNode: l.DstNode, Properties: old}
+		return link.UpdateHtbClass(m.tc, &restore, &n)
+	})
+	return link.ApplyLinkProperties(m.tc, &l, ingress, dst)
+}
+
+// restoreNode recreates a deleted node with its Uid, address, classes and
+// FRR configuration, the groups of its peers are refreshed as its OVS
+// port number changed
+func (m *Manager) restoreNode(ctx context.Context, n api.Node) error {
+	n = copyNode(n)
+	if err := m.rt.RestoreNode(ctx, &n); err != nil {
+		return err
+	}
+	m.Nodes[n.Name] = n
+	if err := m.restoreState(n); err != nil {
+		return err
+	}
+	// a restarted container keeps its files, a recreated one does not
+	if n.FrrConf != "" {
+		return m.installFrr(ctx, n)
+	}
+	return nil
+}
+
+// restoreState installs the root qdisc, classes, group and routes of the
+// recreated node n from its Rules and Routes and refreshes the groups of
+// its peers
+func (m *Manager) restoreState(n api.Node) error {
+	if err := m.tc.CreateRootQdisc(n); err != nil {
+		return err
+	}
+	for _, props := range n.Rules {
+		if props.HTBClassid == 0 {
+			continue
+		}
+		if err := m.tc.AddHtbClass(n, props); err != nil {
+			return err
+		}
+	}
+	if err := m.applyLink(n); err != nil {
+		return err
+	}
+	for _, peer := range m.Nodes {
+		if _, ok := peer.Rules[n.Name]; ok && peer.Name != n.Name {
+			if err := m.applyLink(peer); err != nil {
+				return err
+			}
+		}
+	}
+	if len(n.Routes) > 0 {
+		return m.installRoutes(n)
+	}
 	return nil
 }
 
-func (m *Manager) Destroy() {
+// ValidateOptions describes the running topology for validation
+func (m *Manager) ValidateOptions() validate.Options {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.validateOptions()
+}
+
+func (m *Manager) validateOptions() validate.Options {
+	return validate.Options{IPPool: m.cfg.IPPool, Existing: m.nodeList()}
+}
+
+// Apply validates topoCfg against the running topology, expands its
+// generators and adds the nodes and then the links, the routes of the
+// routing mode and the FRR configurations are updated last. It stops
+// at the first error or when ctx is done and then undoes everything it
+// did, leaving the previous topology in place.
+func (m *Manager) Apply(ctx context.Context, topoCfg api.TopoConfig) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	start := time.Now()
+	defer func() {
+		m.emit(ctx, event.Event{Op: event.OpApply, Duration: event.Since(start)}, err)
+	}()
+	if err := validate.Topo(topoCfg, m.validateOptions()).Err(); err != nil {
+		return err
+	}
+	topoCfg, err = generator.Expand(topoCfg)
+	if err != nil {
+		return err
+	}
+	// a missing image fails the apply before any node is created
+	if err = m.rt.EnsureImages(ctx, topoCfg.Nodes); err != nil {
+		return err
+	}
+
+	return m.transaction(ctx, func(j *journal) error {
+		parallelism := m.parallelism(ctx)
+
+		// Add nodes, Uids are reserved in order so automatic
+		// addresses do not depend on which worker is faster
+		nodes := make([]api.Node, len(topoCfg.Nodes))
+		for i, n := range topoCfg.Nodes {
+			n.Uid = m.rt.ReserveUid()
+			nodes[i] = n
+		}
+		p := m.startPhase(ctx, "nodes", len(nodes))
+		err := m.parallel(ctx, parallelism, len(nodes), p, func(i int) error {
+			if err := m.addNode(ctx, j, nodes[i]); err != nil {
+				return fmt.Errorf("failed to add node %s: %w", nodes[i].Name, err)
+			}
+			return nil
+		})
+		if p.end(err); err != nil {
+			return err
+		}
+
+		// Add links, the groups are set once per node afterwards
+		groups := &groupBatch{nodes: make(map[string]bool)}
+		p = m.startPhase(ctx, "links", len(topoCfg.Links))
+		for _, round := range linkRounds(topoCfg.Links) {
+			err = m.parallel(ctx, parallelism, len(round), p, func(i int) error {
+				l := round[i]
+				if err := m.addLink(ctx, j, l, groups); err != nil {
+					return fmt.Errorf("failed to add link %s-%s: %w", l.SrcNode, l.DstNode, err)
+				}
+				return nil
+			})
+			if err != nil {
+				break
+			}
+		}
+		if p.end(err); err != nil {
+			return err
+		}
+		names := groups.names()
+		p = m.startPhase(ctx, "groups", len(names))
+		err = m.parallel(ctx, parallelism, len(names), p, func(i int) error {
+			n, _ := m.lookupNode(names[i])
+			return m.applyLink(n)
+		})
+		if p.end(err); err != nil {
+			return err
+		}
+
+		// gateways may be defined after the nodes using them
+		var routed []string
+		for _, n := range nodes {
+			if n.Gateway != "" {
+				routed = append(routed, n.Name)
+			}
+		}
+		p = m.startPhase(ctx, "gateways", len(routed))
+		err = m.parallel(ctx, parallelism, len(routed), p, func(i int) error {
+			n, _ := m.lookupNode(routed[i])
+			return m.setGateway(n)
+		})
+		if p.end(err); err != nil {
+			return err
+		}
+
+		// routes follow the shortest paths of the whole topology
+		if topoCfg.Routing != nil {
+			m.setRouting(j, *topoCfg.Routing)
+		}
+		changed := m.routeChanges()
+		p = m.startPhase(ctx, "routes", len(changed))
+		err = m.parallel(ctx, parallelism, len(changed), p, func(i int) error {
+			return m.setRoutes(j, changed[i])
+		})
+		if p.end(err); err != nil {
+			return err
+		}
+
+		// FRR neighbours are known once every link is in place
+		changed, err = m.frrChanges()
+		if err != nil {
+			return err
+		}
+		p = m.startPhase(ctx, "frr", len(changed))
+		err = m.parallel(ctx, parallelism, len(changed), p, func(i int) error {
+			return m.setFrr(ctx, j, changed[i])
+		})
+		p.end(err)
+		return err
+	})
+}
+
+// setGateway points the default route of n to the node named by its Gateway
+func (m *Manager) setGateway(n api.Node) error {
+	if n.Gateway == "" {
+		return nil
+	}
+	gw, ok := m.lookupNode(n.Gateway)
+	if !ok {
+		return fmt.Errorf("gateway %s of node %s: %w", n.Gateway, n.Name, ErrNodeNotFound)
+	}
+	// AddNode runs before the link is added, Apply validated it
+	if _, ok := n.Rules[n.Gateway]; !ok {
+		m.log.Warn("no link to the gateway, packets to it are dropped", "node", n.Name, "gateway", n.Gateway)
+	}
+	return m.rt.SetDefaultRoute(n, gw.Interface.Ipv4)
+}
+
+// Destroy removes all nodes and the bridge, it keeps going on failure
+// and returns every error it met
+func (m *Manager) Destroy(ctx context.Context) error {
+	m.stopWatch()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	start := time.Now()
+	var errs []error
 	for _, n := range m.Nodes {
-		err := m.cm.DeleteNode(m.ctx, &n)
+		nodeStart := time.Now()
+		err := m.deleteNode(ctx, &n)
+		m.emit(ctx, event.Event{Op: event.OpNodeDelete, Node: n.Name, Duration: event.Since(nodeStart)}, err)
 		if err != nil {
-			println(err.Error())
+			errs = append(errs, err)
 		}
 	}
-	err := m.om.DeleteBridge()
-	if err != nil {
-		println(err.Error())
-		return
+	m.Nodes = make(map[string]api.Node)
+	if err := m.sw.DeleteBridge(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to delete bridge: %w", err))
+	}
+	if err := m.rt.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := m.tc.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	err := errors.Join(errs...)
+	m.emit(ctx, event.Event{Op: event.OpDestroy, Duration: event.Since(start)}, err)
+	if err := m.events.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close event log: %w", err))
 	}
+	return errors.Join(errs...)
 }
@@ -0,0 +1,891 @@
+package pkg_test
+
+import (
+	"Netlink/api"
+	"Netlink/pkg"
+	"Netlink/pkg/event"
+	"Netlink/pkg/fake"
+	"Netlink/pkg/validate"
+	"Netlink/pkg/view"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/vishvananda/netlink"
+	"io"
+	"log/slog"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	_ pkg.Switch         = (*fake.Switch)(nil)
+	_ pkg.NodeRuntime    = (*fake.Runtime)(nil)
+	_ pkg.TrafficControl = (*fake.TrafficControl)(nil)
+)
+
+func newManager(t *testing.T) (*pkg.Manager, *fake.Fakes) {
+	t.Helper()
+	f := fake.New()
+	m, err := pkg.NewManager(context.Background(), pkg.Config{
+		Logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Switch:         f.Switch,
+		Runtime:        f.Runtime,
+		TrafficControl: f.TrafficControl,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, f
+}
+
+func addNodes(t *testing.T, m *pkg.Manager, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if err := m.AddNode(context.Background(), api.Node{Name: name}); err != nil {
+			t.Fatalf("AddNode(%s): %v", name, err)
+		}
+	}
+}
+
+func mustNode(t *testing.T, m *pkg.Manager, name string) api.Node {
+	t.Helper()
+	n, ok := m.Node(name)
+	if !ok {
+		t.Fatalf("node %s not found", name)
+	}
+	return n
+}
+
+func assertBuckets(t *testing.T, f *fake.Fakes, n api.Node, want ...string) {
+	t.Helper()
+	got, ok := f.Switch.Buckets(n.Uid)
+	if !ok {
+		t.Fatalf("group %d of %s not found", n.Uid, n.Name)
+	}
+	if want == nil {
+		want = []string{}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("buckets of %s = %v, want %v", n.Name, got, want)
+	}
+}
+
+func TestAddNode(t *testing.T) {
+	m, f := newManager(t)
+	addNodes(t, m, "node1", "node2")
+
+	for i, name := range []string{"node1", "node2"} {
+		n := mustNode(t, m, name)
+		if n.Uid != i+1 {
+			t.Errorf("%s: Uid = %d, want %d", name, n.Uid, i+1)
+		}
+		if n.Interface.Ipv4 == "" {
+			t.Errorf("%s: no address assigned", name)
+		}
+		if n.NetNs == "" || n.Interface.OvsPort <= 0 {
+			t.Errorf("%s: not attached, netns %q port %d", name, n.NetNs, n.Interface.OvsPort)
+		}
+		assertBuckets(t, f, n)
+	}
+	if a, b := mustNode(t, m, "node1").Interface.Ipv4, mustNode(t, m, "node2").Interface.Ipv4; a == b {
+		t.Errorf("nodes share the address %s", a)
+	}
+	if got := len(f.Ops.Method("CreateRootQdisc")); got != 2 {
+		t.Errorf("%d root qdiscs created, want 2", got)
+	}
+}
+
+func TestAddNodeKeepsValidAddress(t *testing.T) {
+	m, _ := newManager(t)
+	n := api.Node{Name: "node1", Interface: api.NodeInterface{Ipv4: "10.0.0.1/24"}}
+	if err := m.AddNode(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustNode(t, m, "node1").Interface.Ipv4; got != "10.0.0.1/24" {
+		t.Errorf("Ipv4 = %s, want 10.0.0.1/24", got)
+	}
+}
+
+func TestAddNodeReplace(t *testing.T) {
+	m, f := newManager(t)
+	addNodes(t, m, "node1", "node2")
+	old := mustNode(t, m, "node1")
+	addNodes(t, m, "node1")
+
+	n := mustNode(t, m, "node1")
+	if n.Uid == old.Uid {
+		t.Errorf("replaced node kept Uid %d", n.Uid)
+	}
+	if got := f.Ops.Method("DeleteNode"); len(got) != 1 || got[0].Node != "node1" {
+		t.Errorf("DeleteNode calls = %v, want one for node1", got)
+	}
+	// a cached tc handle would keep the namespace of the old node alive
+	var order []string
+	for _, op := range f.Ops.All() {
+		if op.Node == "node1" && (op.Method == "Forget" || op.Method == "DeleteNode") {
+			order = append(order, op.Method)
+		}
+	}
+	if want := []string{"Forget", "DeleteNode"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("calls for the replaced node = %v, want %v", order, want)
+	}
+	if _, ok := f.Switch.Buckets(old.Uid); ok {
+		t.Errorf("group %d of the replaced node still exists", old.Uid)
+	}
+	if len(m.NodeList()) != 2 {
+		t.Errorf("%d nodes, want 2", len(m.NodeList()))
+	}
+}
+
+func TestAddLinkBidirectional(t *testing.T) {
+	m, f := newManager(t)
+	addNodes(t, m, "node1", "node2")
+	props := api.LinkProperties{Rate: 100, Latency: 10, Loss: 1}
+	if err := m.AddLink(context.Background(), api.Link{SrcNode: "node1", DstNode: "node2", Properties: props}); err != nil {
+		t.Fatal(err)
+	}
+
+	n1, n2 := mustNode(t, m, "node1"), mustNode(t, m, "node2")
+	for _, c := range []struct {
+		src, dst api.Node
+	}{{n1, n2}, {n2, n1}} {
+		rule, ok := c.src.Rules[c.dst.Name]
+		if !ok {
+			t.Fatalf("%s has no rule to %s", c.src.Name, c.dst.Name)
+		}
+		// the rule to the peer is recorded before its class gets a handle
+		if rule.HTBClassid != netlink.MakeHandle(1, 3) || rule.NetemHandleId != netlink.MakeHandle(3, 0) {
+			t.Errorf("%s -> %s: classid %x netem %x, want 1:3 and 3:", c.src.Name, c.dst.Name, rule.HTBClassid, rule.NetemHandleId)
+		}
+		if rule.Rate != 100 || rule.Latency != 10 || rule.Loss != 1 {
+			t.Errorf("%s -> %s: properties %+v", c.src.Name, c.dst.Name, rule)
+		}
+		if rule.DstIP != c.dst.Interface.Ipv4 || rule.DstMac != c.dst.Interface.Mac || rule.DstMac == "" {
+			t.Errorf("%s -> %s: DstIP %s DstMac %s, want %s %s", c.src.Name, c.dst.Name, rule.DstIP, rule.DstMac, c.dst.Interface.Ipv4, c.dst.Interface.Mac)
+		}
+		if got := f.TrafficControl.Classes(c.src.Name); !reflect.DeepEqual(got, map[uint32]api.LinkProperties{rule.HTBClassid: rule}) {
+			t.Errorf("classes of %s = %v", c.src.Name, got)
+		}
+		assertBuckets(t, f, c.src, c.dst.Name+"-ovs")
+	}
+
+	links := m.LinkList()
+	if len(links) != 2 {
+		t.Fatalf("%d link directions, want 2", len(links))
+	}
+}
+
+func TestAddLinkUniDirectional(t *testing.T) {
+	m, f := newManager(t)
+	addNodes(t, m, "node1", "node2")
+	l := api.Link{SrcNode: "node1", DstNode: "node2", UniDirectional: true, Properties: api.LinkProperties{Rate: 10}}
+	if err := m.AddLink(context.Background(), l); err != nil {
+		t.Fatal(err)
+	}
+
+	n1, n2 := mustNode(t, m, "node1"), mustNode(t, m, "node2")
+	if n1.Rules["node2"].HTBClassid == 0 {
+		t.Error("node1 -> node2 is not shaped")
+	}
+	// the reverse direction forwards without shaping
+	if rule, ok := n2.Rules["node1"]; !ok || rule.HTBClassid != 0 {
+		t.Errorf("node2 -> node1 = %+v, %v, want an unshaped rule", rule, ok)
+	}
+	if got := len(f.TrafficControl.Classes("node2")); got != 0 {
+		t.Errorf("%d classes on node2, want 0", got)
+	}
+	assertBuckets(t, f, n1, "node2-ovs")
+	assertBuckets(t, f, n2, "node1-ovs")
+}
+
+func TestAddLinkWithoutProperties(t *testing.T) {
+	m, f := newManager(t)
+	addNodes(t, m, "node1", "node2")
+	if err := m.AddLink(context.Background(), api.Link{SrcNode: "node1", DstNode: "node2"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Ops.Method("AddHtbClass"); len(got) != 0 {
+		t.Errorf("classes added for an unshaped link: %v", got)
+	}
+	assertBuckets(t, f, mustNode(t, m, "node1"), "node2-ovs")
+	assertBuckets(t, f, mustNode(t, m, "node2"), "node1-ovs")
+}
+
+func TestAddLinkDefaultRate(t *testing.T) {
+	m, _ := newManager(t)
+	addNodes(t, m, "node1", "node2")
+	l := api.Link{SrcNode: "node1", DstNode: "node2", Properties: api.LinkProperties{Latency: 5}}
+	if err := m.AddLink(context.Background(), l); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustNode(t, m, "node1").Rules["node2"].Rate; got == 0 {
+		t.Error("a link with latency only got no rate")
+	}
+}
+
+func TestAddLinkClassids(t *testing.T) {
+	m, _ := newManager(t)
+	addNodes(t, m, "node1", "node2", "node3")
+	props := api.LinkProperties{Rate: 10}
+	for _, dst := range []string{"node2", "node3"} {
+		if err := m.AddLink(context.Background(), api.Link{SrcNode: "node1", DstNode: dst, Properties: props}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n1 := mustNode(t, m, "node1")
+	a, b := n1.Rules["node2"].HTBClassid, n1.Rules["node3"].HTBClassid
+	if a == b {
+		t.Errorf("node1 uses classid %x for both peers", a)
+	}
+	if a != netlink.MakeHandle(1, 3) || b != netlink.MakeHandle(1, 4) {
+		t.Errorf("classids %x and %x, want 1:3 and 1:4", a, b)
+	}
+}
+
+func TestAddLinkUpdate(t *testing.T) {
+	m, f := newManager(t)
+	addNodes(t, m, "node1", "node2")
+	l := api.Link{SrcNode: "node1", DstNode: "node2", Properties: api.LinkProperties{Rate: 10, Latency: 5}}
+	if err := m.AddLink(context.Background(), l); err != nil {
+		t.Fatal(err)
+	}
+	before := mustNode(t, m, "node1").Rules["node2"]
+	f.Ops.Reset()
+
+	l.Properties = api.LinkProperties{Rate: 20, Latency: 50, Loss: 2}
+	if err := m.AddLink(context.Background(), l); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"node1", "node2"} {
+		peer := map[string]string{"node1": "node2", "node2": "node1"}[name]
+		rule := mustNode(t, m, name).Rules[peer]
+		if rule.Rate != 20 || rule.Latency != 50 || rule.Loss != 2 {
+			t.Errorf("%s -> %s: properties %+v", name, peer, rule)
+		}
+		if rule.HTBClassid != before.HTBClassid || rule.NetemHandleId != before.NetemHandleId {
+			t.Errorf("%s -> %s: handles changed to %x %x", name, peer, rule.HTBClassid, rule.NetemHandleId)
+		}
+		if got := f.TrafficControl.Classes(name)[rule.HTBClassid]; got != rule {
+			t.Errorf("installed class of %s = %+v, want %+v", name, got, rule)
+		}
+	}
+	if got := len(f.Ops.Method("ReplaceHtbClass")); got != 2 {
+		t.Errorf("%d classes replaced, want 2", got)
+	}
+	if got := f.Ops.Method("AddHtbClass"); len(got) != 0 || len(f.Ops.Method("AddFlowsByLink")) != 0 {
+		t.Errorf("update added classes or changed groups: %v", f.Ops.All())
+	}
+
+	// unchanged properties are not reinstalled
+	f.Ops.Reset()
+	if err := m.AddLink(context.Background(), l); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Ops.All(); len(got) != 0 {
+		t.Errorf("applying the same link again did %v", got)
+	}
+}
+
+func TestAddLinkUnknownNode(t *testing.T) {
+	m, _ := newManager(t)
+	addNodes(t, m, "node1")
+	err := m.AddLink(context.Background(), api.Link{SrcNode: "node1", DstNode: "node9"})
+	if !errors.Is(err, pkg.ErrNodeNotFound) {
+		t.Errorf("err = %v, want ErrNodeNotFound", err)
+	}
+}
+
+func TestAddLinkRollback(t *testing.T) {
+	m, f := newManager(t)
+	addNodes(t, m, "node1", "node2")
+	errTc := errors.New("tc failed")
+	f.Ops.Fail("AddHtbClass", "node2", errTc)
+
+	l := api.Link{SrcNode: "node1", DstNode: "node2", Properties: api.LinkProperties{Rate: 10}}
+	if err := m.AddLink(context.Background(), l); !errors.Is(err, errTc) {
+		t.Fatalf("err = %v, want %v", err, errTc)
+	}
+	for _, name := range []string{"node1", "node2"} {
+		n := mustNode(t, m, name)
+		if len(n.Rules) != 0 {
+			t.Errorf("rules of %s not restored: %v", name, n.Rules)
+		}
+		if got := f.TrafficControl.Classes(name); len(got) != 0 {
+			t.Errorf("classes of %s not removed: %v", name, got)
+		}
+		assertBuckets(t, f, n)
+	}
+
+	// the link can be added once the failure is gone
+	f.Ops.Fail("AddHtbClass", "node2", nil)
+	if err := m.AddLink(context.Background(), l); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustNode(t, m, "node2").Rules["node1"].HTBClassid; got != netlink.MakeHandle(1, 3) {
+		t.Errorf("classid after rollback %x, want 1:3", got)
+	}
+}
+
+func TestAddNodeNameTaken(t *testing.T) {
+	m, f := newManager(t)
+	// a node of the runtime the manager did not create, e.g. a container
+	// of another topology
+	other := api.Node{Name: "node1"}
+	if err := f.Runtime.AddNode(context.Background(), &other); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddNode(context.Background(), api.Node{Name: "node1"}); err == nil {
+		t.Fatal("AddNode succeeded")
+	}
+	if got := f.Ops.Method("DeleteNode"); len(got) != 0 {
+		t.Errorf("rollback deleted a node it did not create: %v", got)
+	}
+	if _, ok := f.Runtime.Node("node1"); !ok {
+		t.Error("the existing node1 was removed")
+	}
+	if _, ok := m.Node("node1"); ok {
+		t.Error("the failed node is still known")
+	}
+}
+
+func TestApply(t *testing.T) {
+	m, _ := newManager(t)
+	events, cancel := m.Events().Subscribe(64)
+	defer cancel()
+
+	topo := api.TopoConfig{
+		Nodes: []api.Node{{Name: "node1"}, {Name: "node2"}, {Name: "node3"}},
+		Links: []api.Link{
+			{SrcNode: "node1", DstNode: "node2", Properties: api.LinkProperties{Rate: 10, Latency: 5}},
+			{SrcNode: "node2", DstNode: "node3", Properties: api.LinkProperties{Rate: 20}},
+		},
+	}
+	if err := m.Apply(context.Background(), topo); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(m.LinkList()); got != 4 {
+		t.Errorf("%d link directions, want 4", got)
+	}
+
+	drifts, err := m.Verify(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 0 {
+		t.Errorf("drift after apply: %v", drifts)
+	}
+
+	ops := make(map[string]int)
+	for len(events) > 0 {
+		ops[(<-events).Op]++
+	}
+	want := map[string]int{event.OpNodeAdd: 3, event.OpLinkAdd: 4, event.OpApply: 1}
+	if !reflect.DeepEqual(ops, want) {
+		t.Errorf("events %v, want %v", ops, want)
+	}
+}
+
+func TestApplyRollback(t *testing.T) {
+	m, f := newManager(t)
+	addNodes(t, m, "node1")
+	f.Ops.Fail("CreateRootQdisc", "node3", errors.New("no veth"))
+
+	topo := api.TopoConfig{
+		Nodes: []api.Node{{Name: "node2"}, {Name: "node3"}},
+		Links: []api.Link{{SrcNode: "node1", DstNode: "node2"}},
+	}
+	if err := m.Apply(context.Background(), topo); err == nil {
+		t.Fatal("Apply succeeded")
+	}
+	nodes := m.NodeList()
+	if len(nodes) != 1 || nodes[0].Name != "node1" {
+		t.Errorf("nodes after rollback %v, want node1 only", nodes)
+	}
+	for _, name := range []string{"node2", "node3"} {
+		if _, ok := f.Runtime.Node(name); ok {
+			t.Errorf("%s was not deleted", name)
+		}
+	}
+}
+
+func TestApplyRollbackEvents(t *testing.T) {
+	m, f := newManager(t)
+	addNodes(t, m, "node1")
+	f.Ops.Fail("CreateRootQdisc", "node3", errors.New("no veth"))
+
+	topo := api.TopoConfig{Nodes: []api.Node{{Name: "node2"}, {Name: "node3"}}}
+	if err := m.Apply(context.Background(), topo); err == nil {
+		t.Fatal("Apply succeeded")
+	}
+	// the undo steps come before the summary
+	deleted := make(map[string]bool)
+	summary := false
+	for _, e := range m.Events().History() {
+		switch {
+		case e.Op == event.OpRollback:
+			summary = true
+		case e.Rollback && summary:
+			t.Errorf("undo step %+v after the rollback summary", e)
+		case e.Rollback && e.Op == event.OpNodeDelete:
+			deleted[e.Node] = true
+		}
+	}
+	if !summary {
+		t.Error("no rollback summary")
+	}
+	if want := map[string]bool{"node2": true, "node3": true}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("rolled back deletions %v, want %v", deleted, want)
+	}
+}
+
+func TestApplyMissingImage(t *testing.T) {
+	m, f := newManager(t)
+	f.Ops.Fail("EnsureImages", "node2", errors.New("image not present"))
+
+	topo := api.TopoConfig{
+		Nodes: []api.Node{{Name: "node1"}, {Name: "node2", ImagePullPolicy: api.PullNever}, {Name: "ns1", Kind: api.KindNetns}},
+	}
+	if err := m.Apply(context.Background(), topo); err == nil {
+		t.Fatal("Apply succeeded")
+	}
+	// every image is checked, netns nodes have none
+	if got := len(f.Ops.Method("EnsureImages")); got != 2 {
+		t.Errorf("%d images checked, want 2", got)
+	}
+	if got := f.Ops.Method("AddNode"); len(got) != 0 {
+		t.Errorf("nodes created before the images were available: %v", got)
+	}
+}
+
+func TestApplyGateway(t *testing.T) {
+	m, f := newManager(t)
+	topo := api.TopoConfig{
+		Nodes: []api.Node{{Name: "node1", Gateway: "gw1"}, {Name: "gw1", Kind: api.KindNetns}},
+		Links: []api.Link{{SrcNode: "gw1", DstNode: "node1"}},
+	}
+	if err := m.Apply(context.Background(), topo); err != nil {
+		t.Fatal(err)
+	}
+	got := f.Ops.Method("SetDefaultRoute")
+	want := "via=" + mustNode(t, m, "gw1").Interface.Ipv4
+	if len(got) != 1 || got[0].Node != "node1" || got[0].Detail != want {
+		t.Errorf("SetDefaultRoute calls = %v, want one for node1 %s", got, want)
+	}
+
+	// the group of a node without a link to its gateway drops every packet to it
+	m, f = newManager(t)
+	topo.Links[0].UniDirectional = true
+	err := m.Apply(context.Background(), topo)
+	if err == nil || !strings.Contains(err.Error(), "no link to its gateway") {
+		t.Fatalf("err = %v, want no link to the gateway", err)
+	}
+	if got := f.Ops.Method("AddNode"); len(got) != 0 {
+		t.Errorf("nodes created for an invalid gateway: %v", got)
+	}
+}
+
+func TestApplyParallel(t *testing.T) {
+	topo := api.TopoConfig{}
+	for i := 1; i <= 20; i++ {
+		topo.Nodes = append(topo.Nodes, api.Node{Name: fmt.Sprintf("node%d", i)})
+	}
+	// a ring and a hub, the hub gets many classes in a fixed order
+	for i := 1; i <= 20; i++ {
+		topo.Links = append(topo.Links,
+			api.Link{SrcNode: fmt.Sprintf("node%d", i), DstNode: fmt.Sprintf("node%d", i%20+1), Properties: api.LinkProperties{Rate: uint64(i)}})
+		if i > 2 && i < 20 {
+			topo.Links = append(topo.Links, api.Link{SrcNode: "node1", DstNode: fmt.Sprintf("node%d", i), Properties: api.LinkProperties{Latency: uint32(i)}})
+		}
+	}
+
+	apply := func(parallelism int) []api.Node {
+		m, _ := newManager(t)
+		if err := m.Apply(pkg.WithParallelism(context.Background(), parallelism), topo); err != nil {
+			t.Fatalf("parallelism %d: %v", parallelism, err)
+		}
+		if drifts, err := m.Verify(context.Background()); err != nil || len(drifts) != 0 {
+			t.Errorf("parallelism %d: drift after apply: %v %v", parallelism, drifts, err)
+		}
+		nodes := m.NodeList()
+		// ofports are numbered in the order the ports are added
+		for i := range nodes {
+			nodes[i].Interface.OvsPort = 0
+		}
+		return nodes
+	}
+	// Uids, addresses and classids do not depend on the scheduling
+	want := apply(1)
+	if got := apply(8); !reflect.DeepEqual(got, want) {
+		t.Errorf("parallel apply differs from sequential:\n got %v\nwant %v", got, want)
+	}
+}
+
+func TestReplumbRestartedNode(t *testing.T) {
+	m, f := newManager(t)
+	events, cancel := m.Events().Subscribe(64)
+	defer cancel()
+	topo := api.TopoConfig{
+		Nodes: []api.Node{{Name: "node1"}, {Name: "node2"}},
+		Links: []api.Link{{SrcNode: "node1", DstNode: "node2", Properties: api.LinkProperties{Rate: 10}}},
+	}
+	if err := m.Apply(context.Background(), topo); err != nil {
+		t.Fatal(err)
+	}
+	old := mustNode(t, m, "node1")
+	f.Ops.Reset()
+
+	if err := f.Runtime.Restart(context.Background(), "node1"); err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(5 * time.Second)
+wait:
+	for {
+		select {
+		case e := <-events:
+			if e.Op == event.OpNodeRestart {
+				if e.Node != "node1" || e.Error != "" {
+					t.Fatalf("restart event %+v", e)
+				}
+				break wait
+			}
+		case <-timeout:
+			t.Fatal("no restart event")
+		}
+	}
+
+	n := mustNode(t, m, "node1")
+	if n.Interface.OvsPort == old.Interface.OvsPort {
+		t.Errorf("re-plumbed node kept OVS port %d", n.Interface.OvsPort)
+	}
+	var order []string
+	for _, op := range f.Ops.All() {
+		if op.Node == "node1" {
+			order = append(order, op.Method)
+		}
+	}
+	want := []string{"DeleteGroupTable", "DeletePort", "Forget", "Replumb", "AddPort", "AddGroupTable", "CreateRootQdisc", "AddHtbClass", "AddFlowsByLink"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("calls for the restarted node = %v, want %v", order, want)
+	}
+	assertBuckets(t, f, n, "node2-ovs")
+	drifts, err := m.Verify(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 0 {
+		t.Errorf("drift after re-plumb: %v", drifts)
+	}
+
+	// the start of a container that did not restart changes nothing
+	f.Ops.Reset()
+	if err := m.Replumb(context.Background(), "node1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Ops.Method("Replumb"); len(got) != 0 {
+		t.Errorf("Replumb calls = %v, want none", got)
+	}
+}
+
+func TestAddLinkDown(t *testing.T) {
+	m, f := newManager(t)
+	addNodes(t, m, "node1", "node2", "node3")
+	if err := m.AddLink(context.Background(), api.Link{SrcNode: "node1", DstNode: "node3"}); err != nil {
+		t.Fatal(err)
+	}
+	l := api.Link{SrcNode: "node1", DstNode: "node2", Properties: api.LinkProperties{Loss: 100}}
+	if err := m.AddLink(context.Background(), l); err != nil {
+		t.Fatal(err)
+	}
+	// packets the filters do not match, such as multicast hellos, are dropped too
+	assertBuckets(t, f, mustNode(t, m, "node1"), "node3-ovs")
+	assertBuckets(t, f, mustNode(t, m, "node2"))
+	if drifts, err := m.Verify(context.Background()); err != nil || len(drifts) != 0 {
+		t.Errorf("drift of a down link: %v %v", drifts, err)
+	}
+
+	// the direction of node1 is up again when node2 fails, it is rolled back
+	f.Ops.Fail("AddFlowsByLink", "node2", errors.New("ovs failed"))
+	l.Properties.Loss = 10
+	if err := m.AddLink(context.Background(), l); err == nil {
+		t.Fatal("AddLink succeeded")
+	}
+	assertBuckets(t, f, mustNode(t, m, "node1"), "node3-ovs")
+
+	f.Ops.Fail("AddFlowsByLink", "node2", nil)
+	if err := m.AddLink(context.Background(), l); err != nil {
+		t.Fatal(err)
+	}
+	assertBuckets(t, f, mustNode(t, m, "node1"), "node2-ovs", "node3-ovs")
+	assertBuckets(t, f, mustNode(t, m, "node2"), "node1-ovs")
+}
+
+func TestApplyStaticRouting(t *testing.T) {
+	m, f := newManager(t)
+	topo := api.TopoConfig{
+		Nodes: []api.Node{{Name: "node1"}, {Name: "node2"}, {Name: "node3"}},
+		Links: []api.Link{
+			{SrcNode: "node1", DstNode: "node2", Properties: api.LinkProperties{Rate: 10, Latency: 5}},
+			{SrcNode: "node2", DstNode: "node3", Properties: api.LinkProperties{Latency: 5}},
+		},
+		Routing: &api.Routing{Mode: api.RoutingStatic, Metric: api.MetricLatency},
+	}
+	if err := m.Apply(context.Background(), topo); err != nil {
+		t.Fatal(err)
+	}
+	routes := func(method string) map[string]string {
+		got := make(map[string]string)
+		for _, op := range f.Ops.Method(method) {
+			got[op.Node] = op.Detail
+		}
+		return got
+	}
+	want := map[string]string{"node1": "node3>node2", "node3": "node1>node2"}
+	if got := routes("SetRoutes"); !reflect.DeepEqual(got, want) {
+		t.Errorf("routes %v, want %v", got, want)
+	}
+	n1 := mustNode(t, m, "node1")
+	if len(n1.Routes) != 1 || n1.Routes[0].Cost != 10 || n1.Routes[0].HTBClassid != n1.Rules["node2"].HTBClassid {
+		t.Errorf("routes of node1 %+v", n1.Routes)
+	}
+
+	// a link update keeping the paths installs nothing again
+	f.Ops.Reset()
+	if err := m.AddLink(context.Background(), api.Link{SrcNode: "node1", DstNode: "node2", Properties: api.LinkProperties{Rate: 20, Latency: 5}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Ops.Method("SetRoutes"); len(got) != 0 {
+		t.Errorf("SetRoutes calls on unchanged paths %v", got)
+	}
+
+	// a link losing every packet is no path
+	f.Ops.Reset()
+	if err := m.AddLink(context.Background(), api.Link{SrcNode: "node2", DstNode: "node3", Properties: api.LinkProperties{Loss: 100}}); err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]string{"node1": "", "node3": ""}
+	if got := routes("SetRoutes"); !reflect.DeepEqual(got, want) {
+		t.Errorf("routes after loss %v, want %v", got, want)
+	}
+	if got := mustNode(t, m, "node1").Routes; len(got) != 0 {
+		t.Errorf("node1 kept routes %+v", got)
+	}
+}
+
+func TestApplyStaticRoutingOverridesNeighbour(t *testing.T) {
+	// the direct link to node3 is slower than the path through node2
+	slow := api.LinkProperties{Latency: 100}
+	for _, c := range []struct {
+		name string
+		fast api.LinkProperties
+	}{{"shaped", api.LinkProperties{Latency: 10}}, {"unshaped", api.LinkProperties{}}} {
+		t.Run(c.name, func(t *testing.T) {
+			m, f := newManager(t)
+			topo := api.TopoConfig{
+				Nodes: []api.Node{{Name: "node1"}, {Name: "node2"}, {Name: "node3"}},
+				Links: []api.Link{
+					{SrcNode: "node1", DstNode: "node3", Properties: slow},
+					{SrcNode: "node1", DstNode: "node2", Properties: c.fast},
+					{SrcNode: "node2", DstNode: "node3", Properties: c.fast},
+				},
+				Routing: &api.Routing{Mode: api.RoutingStatic, Metric: api.MetricLatency},
+			}
+			if err := m.Apply(context.Background(), topo); err != nil {
+				t.Fatal(err)
+			}
+			n1 := mustNode(t, m, "node1")
+			if len(n1.Routes) != 1 || n1.Routes[0].Dst != "node3" || n1.Routes[0].Via != "node2" {
+				t.Fatalf("routes of node1 %+v, want node3 via node2", n1.Routes)
+			}
+			// the kernel puts the MAC of the next hop on packets to node3, so
+			// they leave through the class of the link to node2, not through
+			// that of the direct link
+			nextHop := mustNode(t, m, n1.Routes[0].Via).Interface.Mac
+			want := n1.Rules["node2"].HTBClassid
+			if want == 0 {
+				want = netlink.MakeHandle(1, 1)
+			}
+			direct := n1.Rules["node3"].HTBClassid
+			if got := f.TrafficControl.Classify("node1", nextHop); got != want || got == direct {
+				t.Errorf("node1 -> node3 classified to %x, want %x (direct link %x)", got, want, direct)
+			}
+			if drifts, err := m.Verify(context.Background()); err != nil || len(drifts) != 0 {
+				t.Errorf("drift after apply: %v %v", drifts, err)
+			}
+		})
+	}
+}
+
+func TestApplyFrr(t *testing.T) {
+	m, f := newManager(t)
+	ospf := &api.Ospf{HelloInterval: 1}
+	topo := api.TopoConfig{
+		Nodes: []api.Node{
+			{Name: "node1", Frr: &api.Frr{Ospf: ospf, Bgp: &api.Bgp{Asn: 65001}}},
+			{Name: "node2", Frr: &api.Frr{Ospf: ospf, Bgp: &api.Bgp{Asn: 65002}}},
+			{Name: "node3", Frr: &api.Frr{Ospf: ospf}},
+			{Name: "ns1", Kind: api.KindNetns},
+		},
+		Links: []api.Link{
+			{SrcNode: "node1", DstNode: "node2"},
+			{SrcNode: "node2", DstNode: "node3"},
+			{SrcNode: "node3", DstNode: "ns1"},
+		},
+	}
+	if err := m.Apply(context.Background(), topo); err != nil {
+		t.Fatal(err)
+	}
+	daemons := func() map[string]string {
+		got := make(map[string]string)
+		for _, op := range f.Ops.Method("SetFrr") {
+			got[op.Node] = op.Detail
+		}
+		return got
+	}
+	want := map[string]string{"node1": "bgpd,ospfd", "node2": "bgpd,ospfd", "node3": "ospfd"}
+	if got := daemons(); !reflect.DeepEqual(got, want) {
+		t.Errorf("frr daemons %v, want %v", got, want)
+	}
+	n1, n2 := mustNode(t, m, "node1"), mustNode(t, m, "node2")
+	peer := strings.Split(n2.Interface.Ipv4, "/")[0]
+	for _, line := range []string{
+		"ospf router-id 0.0.0." + strconv.Itoa(n1.Uid),
+		"neighbor " + peer + " remote-as 65002",
+		"network " + strings.Split(n1.Interface.Ipv4, "/")[0] + "/32",
+	} {
+		if !strings.Contains(n1.FrrConf, line+"\n") {
+			t.Errorf("frr.conf of node1 lacks %q:\n%s", line, n1.FrrConf)
+		}
+	}
+
+	// a new BGP neighbour rewrites the configuration of node2 only
+	f.Ops.Reset()
+	if err := m.AddNode(context.Background(), api.Node{Name: "node4", Frr: &api.Frr{Bgp: &api.Bgp{Asn: 65004}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddLink(context.Background(), api.Link{SrcNode: "node2", DstNode: "node4"}); err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]string{"node2": "bgpd,ospfd", "node4": "bgpd"}
+	if got := daemons(); !reflect.DeepEqual(got, want) {
+		t.Errorf("frr daemons after adding node4 %v, want %v", got, want)
+	}
+	if conf := mustNode(t, m, "node2").FrrConf; !strings.Contains(conf, "remote-as 65004\n") {
+		t.Errorf("frr.conf of node2 lacks node4:\n%s", conf)
+	}
+}
+
+func TestApplyFrrRollback(t *testing.T) {
+	m, f := newManager(t)
+	addNodes(t, m, "node1", "node2")
+	f.Ops.Fail("SetFrr", "node2", errors.New("reload failed"))
+	ospf := &api.Frr{Ospf: &api.Ospf{}}
+	topo := api.TopoConfig{
+		Nodes: []api.Node{{Name: "node1", Frr: ospf}, {Name: "node2", Frr: ospf}},
+		Links: []api.Link{{SrcNode: "node1", DstNode: "node2"}},
+	}
+	if err := m.Apply(pkg.WithParallelism(context.Background(), 1), topo); err == nil {
+		t.Fatal("Apply succeeded")
+	}
+	// node1 ran no FRR before, its configuration is emptied and ospfd stopped
+	var calls []string
+	for _, op := range f.Ops.Method("SetFrr") {
+		if op.Node == "node1" {
+			calls = append(calls, op.Detail)
+		}
+	}
+	if want := []string{"ospfd", ""}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("SetFrr calls for node1 = %q, want %q", calls, want)
+	}
+	if conf := mustNode(t, m, "node1").FrrConf; conf != "" {
+		t.Errorf("node1 kept frr.conf:\n%s", conf)
+	}
+}
+
+func TestShowYamlReapplies(t *testing.T) {
+	m, _ := newManager(t)
+	topo := api.TopoConfig{
+		Nodes: []api.Node{
+			{Name: "node1", Interface: api.NodeInterface{Ipv4: "10.0.0.1/24"}, Env: map[string]string{"A": "1"},
+				Memory: "512m", RestartPolicy: "always", Frr: &api.Frr{Ospf: &api.Ospf{HelloInterval: 1}}},
+			{Name: "ns1", Kind: api.KindNetns, Command: []string{"sleep", "infinity"}, Gateway: "gw1", Labels: map[string]string{"role": "client"}},
+			{Name: "gw1", Kind: api.KindNat, Uplink: "eth0"},
+			{Name: "host1", Kind: api.KindHost},
+		},
+		Links: []api.Link{
+			{SrcNode: "node1", DstNode: "ns1", Properties: api.LinkProperties{Latency: 10}},
+			{SrcNode: "ns1", DstNode: "gw1"},
+			{SrcNode: "node1", DstNode: "host1", Properties: api.LinkProperties{Rate: 100}, UniDirectional: true},
+		},
+	}
+	if err := m.Apply(context.Background(), topo); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := view.WriteTopology(&out, view.FormatYAML, m.NodeList(), m.LinkList(), ""); err != nil {
+		t.Fatal(err)
+	}
+	// automatic addresses are assigned again, the others are kept
+	if strings.Contains(out.String(), "192.168.10.") || !strings.Contains(out.String(), "10.0.0.1/24") {
+		t.Errorf("addresses of the shown topology:\n%s", out.String())
+	}
+
+	shown, report := validate.Bytes(out.Bytes(), "show.yaml", validate.Options{})
+	if err := report.Err(); err != nil {
+		t.Fatalf("%v\n%s", err, out.String())
+	}
+	m2, _ := newManager(t)
+	if err := m2.Apply(context.Background(), shown); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := view.TopoConfig(m2.NodeList(), m2.LinkList(), ""), view.TopoConfig(m.NodeList(), m.LinkList(), ""); !reflect.DeepEqual(got, want) {
+		t.Errorf("re-applied topology\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestPlanMatchesApply(t *testing.T) {
+	m, f := newManager(t)
+	topo := api.TopoConfig{
+		Nodes: []api.Node{{Name: "node1"}, {Name: "node2"}},
+		Links: []api.Link{{SrcNode: "node1", DstNode: "node2", Properties: api.LinkProperties{Latency: 10}}},
+	}
+	// the fakes of the plan number the OVS ports in Uid order
+	if err := m.Apply(pkg.WithParallelism(context.Background(), 1), topo); err != nil {
+		t.Fatal(err)
+	}
+	// node2 is replaced, node3 added and the link to node1 changed
+	next := api.TopoConfig{
+		Nodes: []api.Node{{Name: "node2"}, {Name: "node3", Kind: api.KindNetns}},
+		Links: []api.Link{
+			{SrcNode: "node1", DstNode: "node2", Properties: api.LinkProperties{Latency: 20}},
+			{SrcNode: "node2", DstNode: "node3", Properties: api.LinkProperties{Rate: 10}},
+		},
+		Routing: &api.Routing{Mode: api.RoutingStatic},
+	}
+	before := m.NodeList()
+	f.Ops.Reset()
+	plan, err := m.Plan(next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Ops.All(); len(got) != 0 {
+		t.Errorf("Plan changed the topology: %v", got)
+	}
+	if got := m.NodeList(); !reflect.DeepEqual(got, before) {
+		t.Errorf("Plan changed the nodes: %+v", got)
+	}
+
+	if err := m.Apply(pkg.WithParallelism(context.Background(), 1), next); err != nil {
+		t.Fatal(err)
+	}
+	var applied []pkg.Operation
+	for _, op := range f.Ops.All() {
+		applied = append(applied, pkg.Operation{Action: op.Method, Node: op.Node, Detail: op.Detail})
+	}
+	if !reflect.DeepEqual(plan.Operations, applied) {
+		t.Errorf("plan\n%v\napplied\n%v", plan.Operations, applied)
+	}
+}
@@ -0,0 +1,141 @@
+// Package metrics exposes the tc and OVS counters of a running topology
+// in the Prometheus text exposition format.
+package metrics
+
+import (
+	"Netlink/pkg"
+	"Netlink/pkg/link"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Source reads a snapshot of the counters, e.g. Calculator.Stats
+type Source func(ctx context.Context) (*pkg.Stats, error)
+
+// Handler serves the counters of src at every request
+func Handler(src Source) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, err := src(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var buf bytes.Buffer
+		if err = Write(&buf, s); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = w.Write(buf.Bytes())
+	})
+}
+
+// family collects the samples of one metric
+type family struct {
+	name    string
+	help    string
+	kind    string // counter or gauge
+	samples []string
+}
+
+func (f *family) add(labels []string, value float64) {
+	f.samples = append(f.samples, fmt.Sprintf("%s{%s} %s", f.name, strings.Join(labels, ","), strconv.FormatFloat(value, 'g', -1, 64)))
+}
+
+type registry struct {
+	families map[string]*family
+}
+
+func (r *registry) family(name, kind, help string) *family {
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{name: name, help: help, kind: kind}
+		r.families[name] = f
+	}
+	return f
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func label(name, value string) string {
+	return name + `="` + labelEscaper.Replace(value) + `"`
+}
+
+// Write prints s in the Prometheus text format, link series are labelled
+// with src, dst and the configured rate, latency and loss
+func Write(w io.Writer, s *pkg.Stats) error {
+	r := &registry{families: make(map[string]*family)}
+
+	for _, l := range s.Links {
+		p := l.Properties
+		base := []string{label("src", l.Src), label("dst", l.Dst)}
+		configured := append(append([]string{}, base...),
+			label("rate_mbps", strconv.FormatUint(p.Rate, 10)),
+			label("latency_ms", strconv.FormatUint(uint64(p.Latency), 10)),
+			label("loss_percent", strconv.FormatFloat(float64(p.Loss), 'g', -1, 32)))
+
+		r.family("netlink_link_configured_rate_bits_per_second", "gauge", "Configured rate of the link direction, 0 if unshaped.").
+			add(base, float64(p.Rate)*1024*1024)
+		r.family("netlink_link_configured_latency_seconds", "gauge", "Configured latency of the link direction.").
+			add(base, float64(p.Latency)/1000)
+		r.family("netlink_link_configured_loss_ratio", "gauge", "Configured loss of the link direction.").
+			add(base, float64(p.Loss)/100)
+		if !l.Shaped {
+			continue
+		}
+		addCounters(r, "netlink_htb_class", "HTB class", configured, l.Class)
+		if l.HasNetem {
+			addCounters(r, "netlink_netem", "netem qdisc", configured, l.Netem)
+		}
+	}
+
+	for _, n := range s.Nodes {
+		labels := []string{label("node", n.Node)}
+		r.family("netlink_ovs_port_rx_packets_total", "counter", "Packets received by OVS from the node.").add(labels, float64(n.Port.RxPackets))
+		r.family("netlink_ovs_port_rx_bytes_total", "counter", "Bytes received by OVS from the node.").add(labels, float64(n.Port.RxBytes))
+		r.family("netlink_ovs_port_rx_dropped_total", "counter", "Packets from the node dropped by OVS.").add(labels, float64(n.Port.RxDropped))
+		r.family("netlink_ovs_port_tx_packets_total", "counter", "Packets sent by OVS to the node.").add(labels, float64(n.Port.TxPackets))
+		r.family("netlink_ovs_port_tx_bytes_total", "counter", "Bytes sent by OVS to the node.").add(labels, float64(n.Port.TxBytes))
+		r.family("netlink_ovs_port_tx_dropped_total", "counter", "Packets to the node dropped by OVS.").add(labels, float64(n.Port.TxDropped))
+		r.family("netlink_ovs_group_packets_total", "counter", "Packets forwarded by the group of the node.").add(labels, float64(n.Group.Packets))
+		r.family("netlink_ovs_group_bytes_total", "counter", "Bytes forwarded by the group of the node.").add(labels, float64(n.Group.Bytes))
+		failed := 0.0
+		if s.Errors[n.Node] != nil {
+			failed = 1
+		}
+		r.family("netlink_node_scrape_error", "gauge", "1 if the tc counters of the node could not be read.").add(labels, failed)
+	}
+
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := r.families[name]
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind); err != nil {
+			return err
+		}
+		for _, sample := range f.samples {
+			if _, err := fmt.Fprintln(w, sample); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func addCounters(r *registry, prefix, what string, labels []string, c link.Counters) {
+	r.family(prefix+"_bytes_total", "counter", "Bytes sent through the "+what+".").add(labels, float64(c.Bytes))
+	r.family(prefix+"_packets_total", "counter", "Packets sent through the "+what+".").add(labels, float64(c.Packets))
+	r.family(prefix+"_drops_total", "counter", "Packets dropped by the "+what+".").add(labels, float64(c.Drops))
+	r.family(prefix+"_overlimits_total", "counter", "Overlimit events of the "+what+".").add(labels, float64(c.Overlimits))
+	r.family(prefix+"_backlog_bytes", "gauge", "Bytes queued in the "+what+".").add(labels, float64(c.Backlog))
+	r.family(prefix+"_backlog_packets", "gauge", "Packets queued in the "+what+".").add(labels, float64(c.Qlen))
+}
@@ -5,12 +5,16 @@ import (
 	"Netlink/pkg/ovs"
 	"Netlink/pkg/util"
 	"context"
+	"errors"
 	"fmt"
 	ns "github.com/containernetworking/plugins/pkg/ns"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
 	"github.com/vishvananda/netlink"
+	"log/slog"
 	"net"
+	"sync"
 )
 
 const (
@@ -18,82 +22,189 @@ const (
 	DefaultImage   = "frr:v4"
 )
 
-// ContainerManager manages the lifecycle of containers
+// ContainerManager manages the lifecycle of containers and netns nodes
 // seq is used to assign a unique id to each container( for ovs group id)
-// seq will never decrease
+// seq will never decrease, it is guarded by mu as nodes are created concurrently
+// image is used for nodes without an explicit image,
+// registry is where images naming none are pulled from, docker hub if empty,
+// ipPool is the range for nodes without a valid ipv4 address
 type ContainerManager struct {
-	dClient *client.Client
-	om      *ovs.OvsManager
-	seq     int
+	dClient  *client.Client
+	om       *ovs.OvsManager
+	mu       sync.Mutex
+	seq      int
+	image    string
+	registry string
+	ipPool   string
+	log      *slog.Logger
 }
 
-func NewContainerManager(o *ovs.OvsManager) *ContainerManager {
+// NewContainerManager connects to the docker daemon from the environment,
+// empty image and ipPool fall back to DefaultImage and util.DefaultIPPool
+func NewContainerManager(o *ovs.OvsManager, image, registry, ipPool string, logger *slog.Logger) (*ContainerManager, error) {
+	if image == "" {
+		image = DefaultImage
+	}
+	if ipPool == "" {
+		ipPool = util.DefaultIPPool
+	}
+	if _, err := util.AllocateIpv4(ipPool, 1); err != nil {
+		return nil, err
+	}
 	dClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	if err != nil {
-		println("Error creating docker client")
+		return nil, fmt.Errorf("error creating docker client: %w", err)
 	}
 	return &ContainerManager{
-		dClient: dClient,
-		om:      o,
-		seq:     1,
+		dClient:  dClient,
+		om:       o,
+		seq:      1,
+		image:    image,
+		registry: registry,
+		ipPool:   ipPool,
+		log:      logger,
+	}, nil
+}
+
+// Ping checks that the docker daemon is reachable
+func (cm *ContainerManager) Ping(ctx context.Context) error {
+	if _, err := cm.dClient.Ping(ctx); err != nil {
+		return fmt.Errorf("docker daemon unreachable: %w", err)
 	}
+	return nil
+}
+
+// Close releases the docker client
+func (cm *ContainerManager) Close() error {
+	return cm.dClient.Close()
 }
 
 // AddNode creates a container with the given node configuration
 // start the container, get NetNS
 // link the container to ovs bridge
 func (cm *ContainerManager) AddNode(ctx context.Context, n *api.Node) error {
-	n.Uid = cm.seq
-	cm.seq++
+	if n.Uid == 0 {
+		n.Uid = cm.ReserveUid()
+	}
 	// check illegal
-	if n.Image == "" {
-		n.Image = DefaultImage
+	if n.Image == "" && (n.Kind == "" || n.Kind == api.KindContainer) {
+		n.Image = cm.image
+	}
+	ip, err := Address(n.Interface.Ipv4, cm.ipPool, n.Uid)
+	if err != nil {
+		return err
+	}
+	if ip != n.Interface.Ipv4 {
+		cm.log.Warn("empty, invalid or system-reserved ipv4 address replaced", "op", "node.add",
+			"node", n.Name, "ipv4", n.Interface.Ipv4, "assigned", ip)
+		n.Interface.Ipv4 = ip
 	}
-	if !util.CheckInvalidIpv4(n.Interface.Ipv4) {
-		n.Interface.Ipv4 = "192.168.10." + fmt.Sprintf("%d", n.Uid) + "/24"
 
-		println("node ", n.Name, " has empty or invalid or system-reserved ipv4 address,"+
-			" reset to "+n.Interface.Ipv4)
+	return cm.createNode(ctx, n)
+}
+
+// ReserveUid takes the next Uid for a node created later
+func (cm *ContainerManager) ReserveUid() int {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	uid := cm.seq
+	cm.seq++
+	return uid
+}
+
+// NextUid returns the Uid the next created node gets
+func (cm *ContainerManager) NextUid() int {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.seq
+}
+
+// Address returns the address a node with ipv4 and uid is given:
+// empty, invalid and addresses in ipPool (reserved for automatic
+// assignment) are replaced by the uid-th address of ipPool
+func Address(ipv4, ipPool string, uid int) (string, error) {
+	if util.CheckInvalidIpv4(ipv4) && !util.InPool(ipv4, ipPool) {
+		return ipv4, nil
+	}
+	return util.AllocateIpv4(ipPool, uid)
+}
+
+// Mac returns the address of the node veth of the node with uid, locally
+// administered. It stays the same when the node is restored or its
+// container restarts, the filters of the peers match on it.
+func Mac(uid int) string {
+	return fmt.Sprintf("02:4e:4c:%02x:%02x:%02x", byte(uid>>16), byte(uid>>8), byte(uid))
+}
+
+// RestoreNode recreates a deleted node keeping its Uid and address,
+// used to undo the replacement of a node
+func (cm *ContainerManager) RestoreNode(ctx context.Context, n *api.Node) error {
+	cm.mu.Lock()
+	if n.Uid >= cm.seq {
+		cm.seq = n.Uid + 1
+	}
+	cm.mu.Unlock()
+	return cm.createNode(ctx, n)
+}
+
+// createNode creates and starts the container or namespace of n and links
+// it to OVS. Once the container or namespace exists a failure removes
+// what was created, one of the same name that could not be created is kept.
+func (cm *ContainerManager) createNode(ctx context.Context, n *api.Node) (err error) {
+	switch n.Kind {
+	case api.KindNetns:
+		return cm.createNetns(ctx, n)
+	case api.KindHost:
+		return cm.createHost(ctx, n)
+	case api.KindNat:
+		return cm.createNat(ctx, n)
 	}
 
 	// Create the container
-	sysctls := make(map[string]string)
-	sysctls["net.ipv4.ip_forward"] = "1"
-	sysctls["net.ipv6.conf.all.forwarding"] = "1"
-
-	_, err := cm.dClient.ContainerCreate(ctx, &container.Config{
-		Image:           n.Image,
-		NetworkDisabled: true,
-		User:            "root",
-	}, &container.HostConfig{
-		Privileged: true,
-		Binds:      []string{},
-		Sysctls:    sysctls,
-	}, nil, nil, n.Name)
+	cfg, hostCfg, err := ContainerSpec(*n)
 	if err != nil {
-		println("Error creating container")
-		return err
+		return fmt.Errorf("node %s: %w", n.Name, err)
+	}
+	cfg.Labels = ContainerLabels(cm.om.Bridge(), *n)
+	created, err := cm.dClient.ContainerCreate(ctx, cfg, hostCfg, nil, nil, n.Name)
+	if err != nil {
+		return fmt.Errorf("error creating container %s: %w", n.Name, err)
 	}
+	n.ContainerID = created.ID
+	defer cm.cleanupOnError(ctx, n, &err)
 
 	err = cm.dClient.ContainerStart(ctx, n.Name, container.StartOptions{})
 	if err != nil {
-		println("Error starting container")
-		return err
+		return fmt.Errorf("error starting container %s: %w", n.Name, err)
 	}
 
 	// Get Ns from container
 	res, err := cm.dClient.ContainerInspect(ctx, n.Name)
 	if err != nil {
-		println("Error inspecting container")
-		return err
+		return fmt.Errorf("error inspecting container %s: %w", n.Name, err)
+	}
+	n.Pid = res.State.Pid
+	// the path of the process changes when the container restarts
+	n.NetNs = ContainerNetnsPath(cm.om.Bridge(), n.Name)
+	if err = bindNetns(n.Pid, n.NetNs); err != nil {
+		return fmt.Errorf("error binding netns of %s: %w", n.Name, err)
 	}
-	n.NetNs = fmt.Sprintf("/proc/%d/ns/net", res.State.Pid)
-	println("NetNs: ", n.NetNs)
+	cm.log.Debug("container started", "op", "node.add", "node", n.Name, "netns", n.NetNs, "image", n.Image)
 
 	return cm.LinkNodeToOVS(n)
 
 }
 
+// cleanupOnError deletes the half created node n if *err is set
+func (cm *ContainerManager) cleanupOnError(ctx context.Context, n *api.Node, err *error) {
+	if *err == nil {
+		return
+	}
+	if derr := cm.DeleteNode(context.WithoutCancel(ctx), n); derr != nil {
+		*err = errors.Join(*err, fmt.Errorf("cleanup of %s: %w", n.Name, derr))
+	}
+}
+
 // LinkNodeToOVS links the container to the OVS bridge
 func (cm *ContainerManager) LinkNodeToOVS(n *api.Node) error {
 	err := cm.CreateVethPair(n)
@@ -102,7 +213,10 @@ func (cm *ContainerManager) LinkNodeToOVS(n *api.Node) error {
 	}
 
 	// Create group table for nodex-ovs
-	err = cm.om.AddGroupTable(n.Name+"-ovs", n.Uid)
+	if err = cm.om.AddGroupTable(n.Name+ovs.VethOvsSideSuffix, n.Uid); err != nil {
+		return err
+	}
+	n.Interface.OvsPort, err = ovs.GetPortId(cm.om.Bridge(), n.Name+ovs.VethOvsSideSuffix)
 	return err
 }
 
@@ -118,38 +232,38 @@ func (cm *ContainerManager) CreateVethPair(n *api.Node) error {
 	linkAttr.Name = vethOvs
 	linkAttr.MTU = 1500
 	linkAttr.Flags = net.FlagUp
+	mac, err := net.ParseMAC(Mac(n.Uid))
+	if err != nil {
+		return err
+	}
 
 	veth0 := &netlink.Veth{
-		LinkAttrs: linkAttr,
-		PeerName:  vethContainer,
+		LinkAttrs:        linkAttr,
+		PeerName:         vethContainer,
+		PeerHardwareAddr: mac,
 	}
 
-	err := netlink.LinkAdd(veth0)
+	err = netlink.LinkAdd(veth0)
 	if err != nil {
-		println("Error creating veth pair")
-		return err
+		return fmt.Errorf("error creating veth pair %s: %w", vethOvs, err)
 	}
 
 	// 2. Bring up the veth pair
 	containerLink, err := netlink.LinkByName(vethContainer)
 	if err != nil {
-		println("Error getting link by name")
-		return err
+		return fmt.Errorf("error getting link %s: %w", vethContainer, err)
 	}
 
 	if err = netlink.LinkSetUp(containerLink); err != nil {
-		println("Error setting link up: ", containerLink.Attrs().Name)
-		return err
+		return fmt.Errorf("error setting link %s up: %w", vethContainer, err)
 	}
 
 	hostLink, err := netlink.LinkByName(vethOvs)
 	if err != nil {
-		println("Error getting link by name")
-		return err
+		return fmt.Errorf("error getting link %s: %w", vethOvs, err)
 	}
 	if err = netlink.LinkSetUp(hostLink); err != nil {
-		println("Error setting link up: ", hostLink.Attrs().Name)
-		return err
+		return fmt.Errorf("error setting link %s up: %w", vethOvs, err)
 	}
 
 	// 3. Move one end to container
@@ -192,23 +306,79 @@ func (cm *ContainerManager) CreateVethPair(n *api.Node) error {
 
 	// 4. Connect to OVS
 	if err = cm.om.AddVeth(vethOvs); err != nil {
-		println("Error adding veth to OVS")
-		return err
+		return fmt.Errorf("error adding %s to OVS: %w", vethOvs, err)
 	}
+	cm.log.Debug("veth pair created", "op", "node.add", "node", n.Name, "netns", n.NetNs,
+		"veth", vethContainer, "ipv4", n.Interface.Ipv4)
 
 	// 5. record veth information
-	n.Interface.Mac = veth0.Attrs().HardwareAddr.String()
+	n.Interface.Mac = mac.String()
 	n.Interface.Name = vethContainer
 	n.Interface.NodeName = n.Name
 	return nil
 }
 
+// DeleteNode removes the container and its OVS flow, group and port,
+// parts that were never created are skipped so a half created node can be deleted
 func (cm *ContainerManager) DeleteNode(ctx context.Context, n *api.Node) error {
-
-	err := cm.dClient.ContainerRemove(ctx, n.Name, container.RemoveOptions{Force: true})
-	if err != nil {
+	if err := cm.unlinkFromOVS(n); err != nil {
 		return err
 	}
 
+	switch n.Kind {
+	case api.KindNetns:
+		if err := deleteNetns(n); err != nil {
+			return err
+		}
+	case api.KindNat:
+		if err := deleteNat(n); err != nil {
+			return err
+		}
+	case api.KindHost:
+		// only the veth pair, removed below
+	default:
+		// by ID where known, a container of the same name may not be ours
+		target := n.ContainerID
+		if target == "" {
+			target = n.Name
+		}
+		err := cm.dClient.ContainerRemove(ctx, target, container.RemoveOptions{Force: true})
+		if err != nil && !errdefs.IsNotFound(err) {
+			return fmt.Errorf("error removing container %s: %w", n.Name, err)
+		}
+		if err = unbindNetns(ContainerNetnsPath(cm.om.Bridge(), n.Name)); err != nil {
+			return err
+		}
+	}
+	return deleteHostVeth(n)
+}
+
+// unlinkFromOVS removes the group, flow and port of n from the bridge
+func (cm *ContainerManager) unlinkFromOVS(n *api.Node) error {
+	vethOvs := n.Name + ovs.VethOvsSideSuffix
+	if n.Uid > 0 {
+		inPort := n.Interface.OvsPort
+		if inPort <= 0 {
+			var err error
+			if inPort, err = ovs.GetPortId(cm.om.Bridge(), vethOvs); err != nil {
+				cm.log.Debug("ovs port not found", "op", "node.delete", "node", n.Name, "port", vethOvs, "err", err)
+			}
+		}
+		if err := cm.om.DeleteGroupTable(inPort, n.Uid); err != nil {
+			return err
+		}
+	}
+	return cm.om.DeleteVeth(vethOvs)
+}
+
+// deleteHostVeth removes the veth pair of n left in the host namespace: it
+// was never moved into the node or n is a host node
+func deleteHostVeth(n *api.Node) error {
+	vethOvs := n.Name + ovs.VethOvsSideSuffix
+	if link, err := netlink.LinkByName(vethOvs); err == nil {
+		if err = netlink.LinkDel(link); err != nil {
+			return fmt.Errorf("failed to delete veth %s: %w", vethOvs, err)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,199 @@
+package node
+
+import (
+	"Netlink/api"
+	"context"
+	"errors"
+	"fmt"
+	ns "github.com/containernetworking/plugins/pkg/ns"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/moby/term"
+	"golang.org/x/sys/unix"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+// ExecOptions is a command run in a node and its standard streams.
+// With TTY the command gets a terminal, Stdin and Stdout should be one.
+type ExecOptions struct {
+	Cmd    []string
+	TTY    bool
+	Stdin  io.Reader // nil runs the command without input
+	Stdout io.Writer
+	Stderr io.Writer // unused with TTY, the terminal merges the streams
+}
+
+// Exec runs the command in node n and returns its exit code: through
+// docker exec in container nodes, in the namespace of the node like
+// nsenter for the other kinds. Errors are those of starting the command,
+// not its exit code.
+func Exec(ctx context.Context, n api.Node, opts ExecOptions) (int, error) {
+	if len(opts.Cmd) == 0 {
+		return 0, errors.New("no command given")
+	}
+	if opts.Stdout == nil {
+		opts.Stdout = io.Discard
+	}
+	if opts.Stderr == nil {
+		opts.Stderr = opts.Stdout
+	}
+	if n.Kind == "" || n.Kind == api.KindContainer {
+		return execContainer(ctx, n, opts)
+	}
+	return execNetns(ctx, n, opts)
+}
+
+// execNetns runs the command on the host in the namespace of n, it gets
+// the streams, a terminal among them is used by the command directly
+func execNetns(ctx context.Context, n api.Node, opts ExecOptions) (int, error) {
+	cmd := exec.CommandContext(ctx, opts.Cmd[0], opts.Cmd[1:]...)
+	if opts.TTY {
+		// Ctrl-C cancels ctx but is meant for the command in the terminal
+		cmd = exec.Command(opts.Cmd[0], opts.Cmd[1:]...)
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = opts.Stdin, opts.Stdout, opts.Stderr
+	if err := ns.WithNetNSPath(n.NetNs, func(_ ns.NetNS) error {
+		return cmd.Start()
+	}); err != nil {
+		return 0, fmt.Errorf("error running %q in %s: %w", opts.Cmd[0], n.Name, err)
+	}
+	err := cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	return 0, err
+}
+
+// execContainer runs the command with docker exec, with TTY the local
+// terminal is raw while it runs and its size follows the local one
+func execContainer(ctx context.Context, n api.Node, opts ExecOptions) (int, error) {
+	dClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return 0, fmt.Errorf("error creating docker client: %w", err)
+	}
+	defer dClient.Close()
+
+	inFd, inTerm := term.GetFdInfo(opts.Stdin)
+	outFd, outTerm := term.GetFdInfo(opts.Stdout)
+	execOpts := container.ExecOptions{
+		Cmd:          opts.Cmd,
+		Tty:          opts.TTY,
+		AttachStdin:  opts.Stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+	}
+	var size *[2]uint
+	if opts.TTY && outTerm {
+		if ws, err := term.GetWinsize(outFd); err == nil {
+			size = &[2]uint{uint(ws.Height), uint(ws.Width)}
+		}
+	}
+	execOpts.ConsoleSize = size
+	created, err := dClient.ContainerExecCreate(ctx, n.Name, execOpts)
+	if err != nil {
+		return 0, fmt.Errorf("error creating exec in container %s: %w", n.Name, err)
+	}
+	resp, err := dClient.ContainerExecAttach(ctx, created.ID, container.ExecAttachOptions{Tty: opts.TTY, ConsoleSize: size})
+	if err != nil {
+		return 0, fmt.Errorf("error attaching to exec in container %s: %w", n.Name, err)
+	}
+	defer resp.Close()
+
+	if opts.TTY && inTerm {
+		state, err := term.SetRawTerminal(inFd)
+		if err != nil {
+			return 0, fmt.Errorf("error setting terminal raw: %w", err)
+		}
+		defer term.RestoreTerminal(inFd, state)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	if opts.TTY && outTerm {
+		winch := make(chan os.Signal, 1)
+		signal.Notify(winch, syscall.SIGWINCH)
+		defer signal.Stop(winch)
+		go func() {
+			for {
+				select {
+				case <-winch:
+				case <-done:
+					return
+				}
+				if ws, err := term.GetWinsize(outFd); err == nil {
+					_ = dClient.ContainerExecResize(ctx, created.ID, container.ResizeOptions{Height: uint(ws.Height), Width: uint(ws.Width)})
+				}
+			}
+		}()
+	}
+	if opts.Stdin != nil {
+		go func() {
+			copyInput(resp.Conn, opts.Stdin, done)
+			_ = resp.CloseWrite()
+		}()
+	}
+	// closing the connection ends the output copy when ctx is cancelled
+	go func() {
+		select {
+		case <-ctx.Done():
+			resp.Close()
+		case <-done:
+		}
+	}()
+	if opts.TTY {
+		_, err = io.Copy(opts.Stdout, resp.Reader)
+	} else {
+		_, err = stdcopy.StdCopy(opts.Stdout, opts.Stderr, resp.Reader)
+	}
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error reading output of exec in container %s: %w", n.Name, err)
+	}
+	inspect, err := dClient.ContainerExecInspect(ctx, created.ID)
+	if err != nil {
+		return 0, fmt.Errorf("error inspecting exec in container %s: %w", n.Name, err)
+	}
+	return inspect.ExitCode, nil
+}
+
+// copyInput copies src to dst until src ends or done is closed. A file
+// such as the terminal is polled, so a line typed after the command
+// ended is not taken from the interactive session.
+func copyInput(dst io.Writer, src io.Reader, done <-chan struct{}) {
+	f, ok := src.(*os.File)
+	if !ok {
+		_, _ = io.Copy(dst, src)
+		return
+	}
+	buf := make([]byte, 32*1024)
+	fds := []unix.PollFd{{Fd: int32(f.Fd()), Events: unix.POLLIN}}
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		ready, err := unix.Poll(fds, 100)
+		if errors.Is(err, unix.EINTR) || (err == nil && ready == 0) {
+			continue
+		} else if err != nil {
+			return
+		}
+		nr, err := f.Read(buf)
+		if nr > 0 {
+			if _, werr := dst.Write(buf[:nr]); werr != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
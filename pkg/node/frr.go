@@ -0,0 +1,61 @@
+package node
+
+import (
+	"Netlink/api"
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	ns "github.com/containernetworking/plugins/pkg/ns"
+	"github.com/docker/docker/api/types/container"
+	"strings"
+)
+
+// FRR files in the container and the command applying them, a reload
+// starts and stops daemons as the daemons file changed and falls back to
+// a start where FRR is not running
+const (
+	FrrDir         = "/etc/frr"
+	FrrConfFile    = "frr.conf"
+	FrrDaemonsFile = "daemons"
+	FrrReload      = "/usr/lib/frr/frrinit.sh reload || /usr/lib/frr/frrinit.sh start"
+	frrFileMode    = 0o644
+)
+
+// SetFrr writes frr.conf and daemons to FrrDir in the container of n and
+// reloads FRR. The node forwards packets, see enableForwarding.
+func (cm *ContainerManager) SetFrr(ctx context.Context, n api.Node, conf, daemons string) error {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range []struct{ name, content string }{{FrrDaemonsFile, daemons}, {FrrConfFile, conf}} {
+		hdr := &tar.Header{Name: f.name, Mode: frrFileMode, Size: int64(len(f.content))}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write([]byte(f.content)); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := cm.dClient.CopyToContainer(ctx, n.Name, FrrDir, &buf, container.CopyToContainerOptions{}); err != nil {
+		return fmt.Errorf("failed to write FRR configuration of %s: %w", n.Name, err)
+	}
+
+	if err := ns.WithNetNSPath(n.NetNs, func(_ ns.NetNS) error {
+		return enableForwarding(n.Name + NodeVethSuffix)
+	}); err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	code, err := Exec(ctx, n, ExecOptions{Cmd: []string{"/bin/sh", "-c", FrrReload}, Stdout: &out})
+	if err != nil {
+		return fmt.Errorf("failed to reload FRR in %s: %w", n.Name, err)
+	}
+	if code != 0 {
+		return fmt.Errorf("failed to reload FRR in %s: exit code %d: %s", n.Name, code, strings.TrimSpace(out.String()))
+	}
+	return nil
+}
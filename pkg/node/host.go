@@ -0,0 +1,207 @@
+package node
+
+import (
+	"Netlink/api"
+	"context"
+	"errors"
+	"fmt"
+	ns "github.com/containernetworking/plugins/pkg/ns"
+	"github.com/vishvananda/netlink"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// NatUplinkSuffix names the host side of the veth pair connecting a nat
+// node to the host, NatInsideSuffix the side in the nat node
+const (
+	NatUplinkSuffix = "-up"
+	NatInsideSuffix = "-nat"
+)
+
+// HostNetns returns the namespace of the emulator, the one of host nodes
+func HostNetns() string {
+	return fmt.Sprintf("/proc/%d/ns/net", os.Getpid())
+}
+
+// createHost links the host to OVS: the node veth stays in the host
+// namespace and gets the address of the node, so traffic between the
+// host and the nodes is forwarded and shaped like that of any node
+func (cm *ContainerManager) createHost(ctx context.Context, n *api.Node) (err error) {
+	n.NetNs = HostNetns()
+	defer cm.cleanupOnError(ctx, n, &err)
+	return cm.LinkNodeToOVS(n)
+}
+
+// TransferNet returns the /30 between the host and the nat node with uid,
+// taken from the link-local range: host address, node address
+func TransferNet(uid int) (string, string) {
+	base := net.IPv4(169, 254, byte(uid/64), byte(uid%64*4)).To4()
+	host := net.IPv4(base[0], base[1], base[2], base[3]+1)
+	node := net.IPv4(base[0], base[1], base[2], base[3]+2)
+	return host.String() + "/30", node.String() + "/30"
+}
+
+// createNat creates the namespace of a nat node, links it to OVS and
+// connects it to the host with a second veth pair. Traffic of the nodes
+// is masqueraded to the transfer address in the namespace and again to
+// the uplink on the host.
+func (cm *ContainerManager) createNat(ctx context.Context, n *api.Node) (err error) {
+	if n.Uplink == "" {
+		return fmt.Errorf("nat node %s has no uplink", n.Name)
+	}
+	if err = cm.createNetns(ctx, n); err != nil {
+		return err
+	}
+	defer cm.cleanupOnError(ctx, n, &err)
+	if err = addNatUplink(n); err != nil {
+		return err
+	}
+	cm.log.Debug("nat gateway created", "op", "node.add", "node", n.Name, "netns", n.NetNs, "uplink", n.Uplink)
+	return nil
+}
+
+// addNatUplink connects the namespace of nat node n to the host
+// and masquerades traffic out of its uplink
+func addNatUplink(n *api.Node) error {
+	hostSide := n.Name + NatUplinkSuffix
+	natInside := n.Name + NatInsideSuffix
+	hostAddr, nodeAddr := TransferNet(n.Uid)
+	veth := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: hostSide, MTU: 1500}, PeerName: natInside}
+	if err := netlink.LinkAdd(veth); err != nil {
+		return fmt.Errorf("error creating veth pair %s: %w", hostSide, err)
+	}
+	inside, err := netlink.LinkByName(natInside)
+	if err != nil {
+		return fmt.Errorf("error getting link %s: %w", natInside, err)
+	}
+	natNs, err := ns.GetNS(n.NetNs)
+	if err != nil {
+		return fmt.Errorf("failed to get namespace for nat node: %v", err)
+	}
+	defer natNs.Close()
+	if err = netlink.LinkSetNsFd(inside, int(natNs.Fd())); err != nil {
+		return fmt.Errorf("failed to set namespace for veth: %v", err)
+	}
+	if err = setAddr(hostSide, hostAddr); err != nil {
+		return err
+	}
+	if err = writeSysctl("net/ipv4/ip_forward", "1"); err != nil {
+		return err
+	}
+
+	if err = natNs.Do(func(_ ns.NetNS) error {
+		if err := setAddr(natInside, nodeAddr); err != nil {
+			return err
+		}
+		gw, _, _ := net.ParseCIDR(hostAddr)
+		if err := netlink.RouteAdd(&netlink.Route{Gw: gw}); err != nil {
+			return fmt.Errorf("failed to add default route: %v", err)
+		}
+		if err := writeSysctl("net/ipv4/ip_forward", "1"); err != nil {
+			return err
+		}
+		return iptables("-t", "nat", "-A", "POSTROUTING", "-o", natInside, "-j", "MASQUERADE")
+	}); err != nil {
+		return fmt.Errorf("failed to configure nat namespace: %v", err)
+	}
+
+	for _, rule := range hostNatRules(n, hostAddr) {
+		if err := iptables(append([]string{"-I"}, rule...)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hostNatRules are the iptables rules a nat node adds on the host,
+// without the -I or -D command
+func hostNatRules(n *api.Node, hostAddr string) [][]string {
+	hostSide := n.Name + NatUplinkSuffix
+	_, transfer, _ := net.ParseCIDR(hostAddr)
+	comment := []string{"-m", "comment", "--comment", "netlink nat " + n.Name}
+	return [][]string{
+		append([]string{"POSTROUTING", "-t", "nat", "-s", transfer.String(), "-o", n.Uplink, "-j", "MASQUERADE"}, comment...),
+		append([]string{"FORWARD", "-i", hostSide, "-o", n.Uplink, "-j", "ACCEPT"}, comment...),
+		append([]string{"FORWARD", "-i", n.Uplink, "-o", hostSide, "-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "ACCEPT"}, comment...),
+	}
+}
+
+// deleteNat removes the host rules and veth of a nat node and its namespace
+func deleteNat(n *api.Node) error {
+	var errs []error
+	if n.Uid > 0 {
+		hostAddr, _ := TransferNet(n.Uid)
+		for _, rule := range hostNatRules(n, hostAddr) {
+			// rules that were never added are not an error
+			_ = iptables(append([]string{"-D"}, rule...)...)
+		}
+	}
+	if link, err := netlink.LinkByName(n.Name + NatUplinkSuffix); err == nil {
+		if err = netlink.LinkDel(link); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete veth %s: %w", link.Attrs().Name, err))
+		}
+	}
+	return errors.Join(append(errs, deleteNetns(n))...)
+}
+
+// setAddr adds the address to the link and sets it up
+func setAddr(name, cidr string) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return fmt.Errorf("error getting link %s: %w", name, err)
+	}
+	addr, err := netlink.ParseAddr(cidr)
+	if err != nil {
+		return err
+	}
+	if err = netlink.AddrAdd(link, addr); err != nil {
+		return fmt.Errorf("failed to add address to %s: %v", name, err)
+	}
+	if err = netlink.LinkSetUp(link); err != nil {
+		return fmt.Errorf("error setting link %s up: %w", name, err)
+	}
+	return nil
+}
+
+// writeSysctl sets a sysctl of the namespace of the calling thread
+func writeSysctl(key, value string) error {
+	if err := os.WriteFile("/proc/sys/"+key, []byte(value), 0o644); err != nil {
+		return fmt.Errorf("failed to set %s: %w", strings.ReplaceAll(key, "/", "."), err)
+	}
+	return nil
+}
+
+func iptables(args ...string) error {
+	// -w waits for the xtables lock held by nodes created concurrently
+	out, err := exec.Command("iptables", append([]string{"-w"}, args...)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("iptables %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// SetDefaultRoute points the default route of n to the address gw
+// on its veth, replacing a previous default route
+func (cm *ContainerManager) SetDefaultRoute(n api.Node, gw string) error {
+	ip, _, err := net.ParseCIDR(gw)
+	if err != nil {
+		return fmt.Errorf("invalid gateway address %q: %w", gw, err)
+	}
+	nodeNs, err := ns.GetNS(n.NetNs)
+	if err != nil {
+		return fmt.Errorf("failed to get namespace for node: %v", err)
+	}
+	defer nodeNs.Close()
+	return nodeNs.Do(func(_ ns.NetNS) error {
+		link, err := netlink.LinkByName(n.Name + NodeVethSuffix)
+		if err != nil {
+			return fmt.Errorf("failed to get link by name: %v", err)
+		}
+		if err := netlink.RouteReplace(&netlink.Route{LinkIndex: link.Attrs().Index, Gw: ip}); err != nil {
+			return fmt.Errorf("failed to set default route of %s via %s: %v", n.Name, ip, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,220 @@
+package node
+
+import (
+	"Netlink/api"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/go-units"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// progressInterval limits how often the download progress of an image is logged
+const progressInterval = 2 * time.Second
+
+// pullRank orders the pull policies, an image shared by nodes with
+// different policies gets the highest
+var pullRank = map[string]int{api.PullNever: 0, api.PullIfNotPresent: 1, api.PullAlways: 2}
+
+// ImageSource is how an image is made available, taken from the nodes
+// using it: the highest pull policy and the first archive
+type ImageSource struct {
+	Image   string
+	Policy  string
+	Archive string
+	Nodes   []string
+}
+
+// ImageSources returns the images of the container nodes ordered by name,
+// nodes without an image use defaultImage
+func ImageSources(nodes []api.Node, defaultImage string) []ImageSource {
+	var sources []ImageSource
+	index := make(map[string]int)
+	for _, n := range nodes {
+		if n.Kind != "" && n.Kind != api.KindContainer {
+			continue
+		}
+		ref := n.Image
+		if ref == "" {
+			ref = defaultImage
+		}
+		policy := n.ImagePullPolicy
+		if policy == "" {
+			policy = api.PullIfNotPresent
+		}
+		i, ok := index[ref]
+		if !ok {
+			i = len(sources)
+			index[ref] = i
+			sources = append(sources, ImageSource{Image: ref, Policy: policy})
+		} else if pullRank[policy] > pullRank[sources[i].Policy] {
+			sources[i].Policy = policy
+		}
+		sources[i].Nodes = append(sources[i].Nodes, n.Name)
+		if sources[i].Archive == "" {
+			sources[i].Archive = n.ImageArchive
+		}
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].Image < sources[j].Image })
+	return sources
+}
+
+// PullRef returns the reference ref is pulled as, prefixed with registry
+// unless empty or ref names a registry
+func PullRef(registry, ref string) string {
+	if registry == "" || hasRegistry(ref) {
+		return ref
+	}
+	return registry + "/" + ref
+}
+
+// EnsureImages makes the images of the container nodes available before
+// any of them is created: images are pulled or loaded from their archive
+// according to the pull policy of the nodes, errors of all images are returned
+func (cm *ContainerManager) EnsureImages(ctx context.Context, nodes []api.Node) error {
+	sources := ImageSources(nodes, cm.image)
+	if len(sources) == 0 {
+		return nil
+	}
+	if err := cm.Ping(ctx); err != nil {
+		return err
+	}
+	var errs []error
+	for _, src := range sources {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := cm.ensureImage(ctx, src); err != nil {
+			errs = append(errs, fmt.Errorf("image %s of %s: %w", src.Image, strings.Join(src.Nodes, ", "), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (cm *ContainerManager) ensureImage(ctx context.Context, src ImageSource) error {
+	ref := src.Image
+	present, err := cm.imagePresent(ctx, ref)
+	if err != nil {
+		return err
+	}
+	switch {
+	case src.Policy == api.PullNever && !present:
+		return fmt.Errorf("not present and imagePullPolicy is %s", api.PullNever)
+	case src.Policy != api.PullAlways && present:
+		cm.log.Debug("image present", "image", ref)
+		return nil
+	case src.Archive != "":
+		return cm.loadImage(ctx, ref, src.Archive)
+	}
+	return cm.pullImage(ctx, ref)
+}
+
+func (cm *ContainerManager) imagePresent(ctx context.Context, ref string) (bool, error) {
+	if _, _, err := cm.dClient.ImageInspectWithRaw(ctx, ref); err != nil {
+		if errdefs.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error inspecting image: %w", err)
+	}
+	return true, nil
+}
+
+// pullImage pulls ref, from the registry of the manager if it has one
+// and ref names none, and tags the pulled image as ref
+func (cm *ContainerManager) pullImage(ctx context.Context, ref string) error {
+	from := PullRef(cm.registry, ref)
+	start := time.Now()
+	cm.log.Info("pulling image", "image", from)
+	body, err := cm.dClient.ImagePull(ctx, from, image.PullOptions{})
+	if err != nil {
+		return fmt.Errorf("error pulling %s: %w", from, err)
+	}
+	defer body.Close()
+	if err = cm.readProgress(body, from); err != nil {
+		return fmt.Errorf("error pulling %s: %w", from, err)
+	}
+	if from != ref {
+		if err = cm.dClient.ImageTag(ctx, from, ref); err != nil {
+			return fmt.Errorf("error tagging %s as %s: %w", from, ref, err)
+		}
+	}
+	cm.log.Info("image pulled", "image", from, "duration", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// loadImage loads the tarball archive with docker load, it must contain ref
+func (cm *ContainerManager) loadImage(ctx context.Context, ref, archive string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return fmt.Errorf("error opening image archive: %w", err)
+	}
+	defer f.Close()
+	start := time.Now()
+	cm.log.Info("loading image", "image", ref, "archive", archive)
+	resp, err := cm.dClient.ImageLoad(ctx, f, true)
+	if err != nil {
+		return fmt.Errorf("error loading %s: %w", archive, err)
+	}
+	defer resp.Body.Close()
+	if err = cm.readProgress(resp.Body, ref); err != nil {
+		return fmt.Errorf("error loading %s: %w", archive, err)
+	}
+	present, err := cm.imagePresent(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if !present {
+		return fmt.Errorf("archive %s does not contain the image", archive)
+	}
+	cm.log.Info("image loaded", "image", ref, "duration", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// readProgress consumes the JSON message stream of a pull or load,
+// logging the downloaded bytes of all layers every progressInterval
+func (cm *ContainerManager) readProgress(r io.Reader, ref string) error {
+	dec := json.NewDecoder(r)
+	layers := make(map[string]*jsonmessage.JSONProgress)
+	last := time.Now()
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := dec.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if msg.Progress != nil && msg.ID != "" && msg.Status == "Downloading" {
+			layers[msg.ID] = msg.Progress
+		}
+		if time.Since(last) < progressInterval || len(layers) == 0 {
+			continue
+		}
+		last = time.Now()
+		var current, total int64
+		for _, p := range layers {
+			current += p.Current
+			total += p.Total
+		}
+		cm.log.Info("image progress", "image", ref, "layers", len(layers),
+			"downloaded", units.HumanSize(float64(current)), "total", units.HumanSize(float64(total)))
+	}
+}
+
+// hasRegistry reports whether the first component of ref names a
+// registry, following the rule of docker
+func hasRegistry(ref string) bool {
+	first, _, ok := strings.Cut(ref, "/")
+	return ok && (strings.ContainsAny(first, ".:") || first == "localhost")
+}
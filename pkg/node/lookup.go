@@ -0,0 +1,72 @@
+package node
+
+import (
+	"Netlink/api"
+	"context"
+	"fmt"
+	ns "github.com/containernetworking/plugins/pkg/ns"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/vishvananda/netlink"
+	"os"
+)
+
+// Lookup finds a running node by its named namespace or container, for
+// commands run outside the interactive session. Only the name, container,
+// namespace and address are known, Uid and Rules are not.
+func Lookup(ctx context.Context, name string) (api.Node, error) {
+	n := api.Node{Name: name}
+	if _, err := os.Stat(NetnsPath(name)); err == nil {
+		n.Kind = api.KindNetns
+		n.NetNs = NetnsPath(name)
+		n.Interface.Ipv4, err = ReadIpv4(n)
+		return n, err
+	}
+	dClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return n, fmt.Errorf("error creating docker client: %w", err)
+	}
+	defer dClient.Close()
+
+	res, err := dClient.ContainerInspect(ctx, name)
+	if errdefs.IsNotFound(err) {
+		return n, fmt.Errorf("node %s: no such container", name)
+	} else if err != nil {
+		return n, fmt.Errorf("error inspecting container %s: %w", name, err)
+	}
+	if res.State == nil || !res.State.Running {
+		return n, fmt.Errorf("node %s: container is not running", name)
+	}
+	n.ContainerID = res.ID
+	n.Pid = res.State.Pid
+	n.NetNs = fmt.Sprintf("/proc/%d/ns/net", res.State.Pid)
+	n.Interface.Ipv4, err = ReadIpv4(n)
+	return n, err
+}
+
+// ReadIpv4 returns the address of the veth of n as found in its namespace
+func ReadIpv4(n api.Node) (string, error) {
+	containerNs, err := ns.GetNS(n.NetNs)
+	if err != nil {
+		return "", fmt.Errorf("failed to get namespace for container: %v", err)
+	}
+	defer containerNs.Close()
+
+	var ipv4 string
+	err = containerNs.Do(func(_ ns.NetNS) error {
+		link, err := netlink.LinkByName(n.Name + NodeVethSuffix)
+		if err != nil {
+			return fmt.Errorf("failed to get link by name: %v", err)
+		}
+		addrs, err := netlink.AddrList(link, netlink.FAMILY_V4)
+		if err != nil {
+			return fmt.Errorf("failed to list addresses: %v", err)
+		}
+		if len(addrs) == 0 {
+			return fmt.Errorf("%s has no ipv4 address", link.Attrs().Name)
+		}
+		ipv4 = addrs[0].IPNet.String()
+		return nil
+	})
+	return ipv4, err
+}
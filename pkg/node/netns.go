@@ -0,0 +1,106 @@
+package node
+
+import (
+	"Netlink/api"
+	"context"
+	"errors"
+	"fmt"
+	ns "github.com/containernetworking/plugins/pkg/ns"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"syscall"
+)
+
+// NetnsDir holds the bind mounts of named namespaces, as used by ip netns
+const NetnsDir = "/run/netns"
+
+// NetnsPath returns the path of the named namespace of a netns node
+func NetnsPath(name string) string {
+	return filepath.Join(NetnsDir, name)
+}
+
+// createNetns creates the named namespace of n, starts its command
+// inside and links it to OVS like a container
+func (cm *ContainerManager) createNetns(ctx context.Context, n *api.Node) (err error) {
+	if err = addNamedNetns(n.Name); err != nil {
+		return fmt.Errorf("error creating netns %s: %w", n.Name, err)
+	}
+	n.NetNs = NetnsPath(n.Name)
+	defer cm.cleanupOnError(ctx, n, &err)
+
+	if len(n.Command) > 0 {
+		pid, err := startIn(n.NetNs, n.Command)
+		if err != nil {
+			return fmt.Errorf("error starting %q in netns %s: %w", n.Command[0], n.Name, err)
+		}
+		n.Pid = pid
+	}
+	cm.log.Debug("netns created", "op", "node.add", "node", n.Name, "netns", n.NetNs, "pid", n.Pid)
+
+	return cm.LinkNodeToOVS(n)
+}
+
+// addNamedNetns creates a network namespace bind mounted at NetnsPath(name)
+// with the loopback up
+func addNamedNetns(name string) error {
+	runtime.LockOSThread()
+	orig, err := netns.Get()
+	if err != nil {
+		runtime.UnlockOSThread()
+		return err
+	}
+	defer orig.Close()
+
+	// NewNamed moves the thread into the new namespace
+	created, err := netns.NewNamed(name)
+	if err == nil {
+		created.Close()
+		if lo, lerr := netlink.LinkByName("lo"); lerr != nil {
+			err = lerr
+		} else {
+			err = netlink.LinkSetUp(lo)
+		}
+	}
+	// a thread left in another namespace is not reused
+	if serr := netns.Set(orig); serr != nil {
+		return errors.Join(err, serr)
+	}
+	runtime.UnlockOSThread()
+	return err
+}
+
+// startIn starts args in the namespace at path in its own process group,
+// output is discarded
+func startIn(path string, args []string) (int, error) {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	err := ns.WithNetNSPath(path, func(_ ns.NetNS) error {
+		return cmd.Start()
+	})
+	if err != nil {
+		return 0, err
+	}
+	go cmd.Wait()
+	return cmd.Process.Pid, nil
+}
+
+// deleteNetns stops the process of n and removes its namespace,
+// the veth inside is removed with it
+func deleteNetns(n *api.Node) error {
+	if n.Pid > 0 {
+		if err := syscall.Kill(-n.Pid, syscall.SIGKILL); err != nil && !errors.Is(err, syscall.ESRCH) {
+			return fmt.Errorf("error stopping process %d of netns %s: %w", n.Pid, n.Name, err)
+		}
+	}
+	if _, err := os.Stat(NetnsPath(n.Name)); os.IsNotExist(err) {
+		return nil
+	}
+	if err := netns.DeleteNamed(n.Name); err != nil {
+		return fmt.Errorf("error deleting netns %s: %w", n.Name, err)
+	}
+	return nil
+}
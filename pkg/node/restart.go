@@ -0,0 +1,162 @@
+package node
+
+import (
+	"Netlink/api"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"golang.org/x/sys/unix"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// labels the emulator adds to its containers, the events of the
+// containers of one bridge are told apart by them
+const (
+	LabelNode   = "netlink.node"
+	LabelBridge = "netlink.bridge"
+)
+
+// watchBackoff limits how often the docker events are followed again
+// after the stream broke, e.g. while the daemon restarts
+const watchBackoff = 30 * time.Second
+
+// ContainerNetnsPath returns where the namespace of container node name
+// is bind mounted, the bridge names the topology
+func ContainerNetnsPath(bridge, name string) string {
+	return filepath.Join(NetnsDir, bridge+"-"+name)
+}
+
+// ContainerLabels returns the labels of the container of n: those of n
+// and the ones naming its node and bridge
+func ContainerLabels(bridge string, n api.Node) map[string]string {
+	labels := map[string]string{LabelNode: n.Name, LabelBridge: bridge}
+	for k, v := range n.Labels {
+		labels[k] = v
+	}
+	return labels
+}
+
+// bindNetns bind mounts the namespace of process pid at path, it stays
+// reachable at path when the process exits or the container restarts.
+// A mount left at path by a node that was not deleted is replaced.
+func bindNetns(pid int, path string) error {
+	if err := unbindNetns(path); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE|os.O_EXCL, 0o444)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	if err = unix.Mount(fmt.Sprintf("/proc/%d/ns/net", pid), path, "bind", unix.MS_BIND, ""); err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+// unbindNetns removes the bind mount at path, the namespace is freed with
+// the veth inside once no process or open handle uses it
+func unbindNetns(path string) error {
+	if err := unix.Unmount(path, unix.MNT_DETACH); err != nil && !errors.Is(err, unix.EINVAL) && !errors.Is(err, unix.ENOENT) {
+		return fmt.Errorf("error unmounting %s: %w", path, err)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// WatchRestarts sends the name of a container node of the bridge each
+// time its container is started, until ctx is done. After the event
+// stream broke it is followed again from the last event received.
+func (cm *ContainerManager) WatchRestarts(ctx context.Context) <-chan string {
+	out := make(chan string)
+	args := filters.NewArgs(
+		filters.Arg("type", string(events.ContainerEventType)),
+		filters.Arg("event", string(events.ActionStart)),
+		filters.Arg("label", LabelBridge+"="+cm.om.Bridge()),
+	)
+	go func() {
+		defer close(out)
+		since := strconv.FormatInt(time.Now().Unix(), 10)
+		backoff := time.Second
+		for {
+			msgs, errs := cm.dClient.Events(ctx, events.ListOptions{Since: since, Filters: args})
+			err := func() error {
+				for {
+					select {
+					case msg := <-msgs:
+						since = strconv.FormatInt(msg.Time, 10)
+						backoff = time.Second
+						name := msg.Actor.Attributes[LabelNode]
+						if name == "" {
+							continue
+						}
+						select {
+						case out <- name:
+						case <-ctx.Done():
+							return ctx.Err()
+						}
+					case err := <-errs:
+						return err
+					}
+				}
+			}()
+			if ctx.Err() != nil {
+				return
+			}
+			cm.log.Debug("docker events interrupted", "err", err, "retry", backoff)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, watchBackoff)
+		}
+	}()
+	return out
+}
+
+// Replumb attaches container node n again after its container restarted:
+// the namespace is bound again at n.NetNs and the veth pair, address and
+// OVS port and group are recreated. It reports false without changing
+// anything if n is not a container or its container did not change.
+func (cm *ContainerManager) Replumb(ctx context.Context, n *api.Node) (bool, error) {
+	if n.Kind != "" && n.Kind != api.KindContainer {
+		return false, nil
+	}
+	res, err := cm.dClient.ContainerInspect(ctx, n.Name)
+	if err != nil {
+		return false, fmt.Errorf("error inspecting container %s: %w", n.Name, err)
+	}
+	if res.State == nil || !res.State.Running || res.State.Pid == n.Pid {
+		return false, nil
+	}
+	cm.log.Info("container restarted", "op", "node.restart", "node", n.Name, "pid", res.State.Pid, "oldPid", n.Pid)
+
+	// the bind mount keeps the old namespace and the veth inside alive
+	if err = cm.unlinkFromOVS(n); err != nil {
+		return true, err
+	}
+	n.NetNs = ContainerNetnsPath(cm.om.Bridge(), n.Name)
+	if err = unbindNetns(n.NetNs); err != nil {
+		return true, err
+	}
+	if err = deleteHostVeth(n); err != nil {
+		return true, err
+	}
+	n.Pid = res.State.Pid
+	if err = bindNetns(n.Pid, n.NetNs); err != nil {
+		return true, fmt.Errorf("error binding netns of %s: %w", n.Name, err)
+	}
+	return true, cm.LinkNodeToOVS(n)
+}
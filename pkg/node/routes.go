@@ -0,0 +1,92 @@
+package node
+
+import (
+	"Netlink/api"
+	"fmt"
+	ns "github.com/containernetworking/plugins/pkg/ns"
+	"github.com/vishvananda/netlink"
+	"net"
+)
+
+// RouteProtocol marks the routes of the static routing mode, routes of
+// other origins in the node are left alone
+const RouteProtocol netlink.RouteProtocol = 250
+
+// SetRoutes replaces the static routes of n by routes, nil removes them.
+// A node with routes forwards packets, see enableForwarding; the host
+// is not changed.
+func (cm *ContainerManager) SetRoutes(n api.Node, routes []api.Route) error {
+	nodeNs, err := ns.GetNS(n.NetNs)
+	if err != nil {
+		return fmt.Errorf("failed to get namespace for node: %v", err)
+	}
+	defer nodeNs.Close()
+	return nodeNs.Do(func(_ ns.NetNS) error {
+		veth := n.Name + NodeVethSuffix
+		link, err := netlink.LinkByName(veth)
+		if err != nil {
+			return fmt.Errorf("failed to get link by name: %v", err)
+		}
+		if len(routes) > 0 && n.Kind != api.KindHost {
+			if err := enableForwarding(veth); err != nil {
+				return err
+			}
+		}
+
+		want := make(map[string]bool)
+		for _, r := range routes {
+			dst, err := hostNet(r.DstIP)
+			if err != nil {
+				return err
+			}
+			via, _, err := net.ParseCIDR(r.ViaIP)
+			if err != nil {
+				return fmt.Errorf("invalid address %q of %s: %w", r.ViaIP, r.Via, err)
+			}
+			// onlink as the next hop may be outside the subnet of the node
+			route := &netlink.Route{LinkIndex: link.Attrs().Index, Dst: dst, Gw: via,
+				Protocol: RouteProtocol, Flags: int(netlink.FLAG_ONLINK)}
+			if err := netlink.RouteReplace(route); err != nil {
+				return fmt.Errorf("failed to add route to %s via %s: %v", r.Dst, r.Via, err)
+			}
+			want[dst.String()] = true
+		}
+
+		existing, err := netlink.RouteListFiltered(netlink.FAMILY_V4, &netlink.Route{Protocol: RouteProtocol}, netlink.RT_FILTER_PROTOCOL)
+		if err != nil {
+			return fmt.Errorf("failed to list routes: %v", err)
+		}
+		for _, route := range existing {
+			if route.Dst != nil && !want[route.Dst.String()] {
+				if err := netlink.RouteDel(&route); err != nil {
+					return fmt.Errorf("failed to delete route to %s: %v", route.Dst, err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// enableForwarding makes the namespace it runs in forward packets without
+// sending redirects, as they leave through the veth they came in
+func enableForwarding(veth string) error {
+	for _, kv := range [][2]string{
+		{"net/ipv4/ip_forward", "1"},
+		{"net/ipv4/conf/all/send_redirects", "0"},
+		{"net/ipv4/conf/" + veth + "/send_redirects", "0"},
+	} {
+		if err := writeSysctl(kv[0], kv[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hostNet returns the /32 of the address in cidr
+func hostNet(cidr string) (*net.IPNet, error) {
+	ip, _, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", cidr, err)
+	}
+	return &net.IPNet{IP: ip.To4(), Mask: net.CIDRMask(32, 32)}, nil
+}
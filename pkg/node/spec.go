@@ -0,0 +1,97 @@
+package node
+
+import (
+	"Netlink/api"
+	"fmt"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-units"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ContainerSpec translates the container settings of n into the docker
+// configuration, the network is always disabled and IP forwarding enabled
+func ContainerSpec(n api.Node) (*container.Config, *container.HostConfig, error) {
+	sysctls := map[string]string{
+		"net.ipv4.ip_forward":          "1",
+		"net.ipv6.conf.all.forwarding": "1",
+	}
+	for k, v := range n.Sysctls {
+		sysctls[k] = v
+	}
+
+	cfg := &container.Config{
+		Image:           n.Image,
+		NetworkDisabled: true,
+		User:            "root",
+		Cmd:             n.Command,
+		Entrypoint:      n.Entrypoint,
+		Env:             Env(n.Env),
+		WorkingDir:      n.Workdir,
+		Labels:          n.Labels,
+	}
+	hostCfg := &container.HostConfig{
+		Privileged: n.Capabilities == nil,
+		CapAdd:     n.Capabilities,
+		Binds:      append([]string{}, n.Binds...),
+		Sysctls:    sysctls,
+	}
+
+	if n.Cpus < 0 {
+		return nil, nil, fmt.Errorf("invalid cpus %g", n.Cpus)
+	}
+	hostCfg.NanoCPUs = int64(n.Cpus * 1e9)
+	if n.Memory != "" {
+		memory, err := units.RAMInBytes(n.Memory)
+		if err != nil || memory <= 0 {
+			return nil, nil, fmt.Errorf("invalid memory %q, expected a size like 512m or 2g", n.Memory)
+		}
+		hostCfg.Memory = memory
+	}
+	policy, err := RestartPolicy(n.RestartPolicy)
+	if err != nil {
+		return nil, nil, err
+	}
+	hostCfg.RestartPolicy = policy
+	for _, bind := range n.Binds {
+		if parts := strings.Split(bind, ":"); len(parts) < 2 || len(parts) > 3 || parts[0] == "" || !strings.HasPrefix(parts[1], "/") {
+			return nil, nil, fmt.Errorf("invalid bind %q, expected host-src:/container-dest[:options]", bind)
+		}
+	}
+	return cfg, hostCfg, nil
+}
+
+// RestartPolicy parses no, always, unless-stopped or on-failure[:max-retries],
+// empty is no
+func RestartPolicy(s string) (container.RestartPolicy, error) {
+	name, retries, hasRetries := strings.Cut(s, ":")
+	policy := container.RestartPolicy{Name: container.RestartPolicyMode(name)}
+	if name == "" {
+		policy.Name = container.RestartPolicyDisabled
+	}
+	if hasRetries {
+		n, err := strconv.Atoi(retries)
+		if err != nil || n < 0 {
+			return policy, fmt.Errorf("invalid restart policy %q, expected on-failure:<max-retries>", s)
+		}
+		policy.MaximumRetryCount = n
+	}
+	if err := container.ValidateRestartPolicy(policy); err != nil {
+		return policy, fmt.Errorf("invalid restart policy %q, expected no, always, unless-stopped or on-failure[:max-retries]", s)
+	}
+	return policy, nil
+}
+
+// Env returns the variables as KEY=value sorted by key
+func Env(env map[string]string) []string {
+	if len(env) == 0 {
+		return nil
+	}
+	res := make([]string, 0, len(env))
+	for k, v := range env {
+		res = append(res, k+"="+v)
+	}
+	sort.Strings(res)
+	return res
+}
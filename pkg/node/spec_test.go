@@ -0,0 +1,124 @@
+package node_test
+
+import (
+	"Netlink/api"
+	"Netlink/pkg/node"
+	"github.com/docker/docker/api/types/container"
+	"reflect"
+	"testing"
+)
+
+func TestContainerSpec(t *testing.T) {
+	tests := []struct {
+		name    string
+		node    api.Node
+		wantErr bool
+		check   func(t *testing.T, cfg *container.Config, hostCfg *container.HostConfig)
+	}{
+		{
+			name: "defaults",
+			node: api.Node{Name: "node1", Image: "frr:v4"},
+			check: func(t *testing.T, cfg *container.Config, hostCfg *container.HostConfig) {
+				if !cfg.NetworkDisabled || cfg.Image != "frr:v4" {
+					t.Errorf("config %+v", cfg)
+				}
+				if !hostCfg.Privileged || hostCfg.Sysctls["net.ipv4.ip_forward"] != "1" {
+					t.Errorf("host config %+v", hostCfg)
+				}
+				if hostCfg.RestartPolicy.Name != container.RestartPolicyDisabled {
+					t.Errorf("restart policy %+v, want no", hostCfg.RestartPolicy)
+				}
+			},
+		},
+		{
+			name: "resources",
+			node: api.Node{Name: "node1", Cpus: 1.5, Memory: "512m", Capabilities: []string{"NET_ADMIN"},
+				Binds: []string{"/srv/conf:/etc/frr:ro"}, Sysctls: map[string]string{"net.ipv4.ip_forward": "0"}},
+			check: func(t *testing.T, cfg *container.Config, hostCfg *container.HostConfig) {
+				if hostCfg.NanoCPUs != 1.5e9 || hostCfg.Memory != 512*1024*1024 {
+					t.Errorf("cpus %d memory %d", hostCfg.NanoCPUs, hostCfg.Memory)
+				}
+				if hostCfg.Privileged || !reflect.DeepEqual([]string(hostCfg.CapAdd), []string{"NET_ADMIN"}) {
+					t.Errorf("privileged %v capabilities %v", hostCfg.Privileged, hostCfg.CapAdd)
+				}
+				if !reflect.DeepEqual(hostCfg.Binds, []string{"/srv/conf:/etc/frr:ro"}) {
+					t.Errorf("binds %v", hostCfg.Binds)
+				}
+				// the sysctls of the node win
+				if hostCfg.Sysctls["net.ipv4.ip_forward"] != "0" {
+					t.Errorf("sysctls %v", hostCfg.Sysctls)
+				}
+			},
+		},
+		{name: "negative cpus", node: api.Node{Cpus: -1}, wantErr: true},
+		{name: "bad memory", node: api.Node{Memory: "lots"}, wantErr: true},
+		{name: "zero memory", node: api.Node{Memory: "0"}, wantErr: true},
+		{name: "bad restart policy", node: api.Node{RestartPolicy: "sometimes"}, wantErr: true},
+		{name: "bind without destination", node: api.Node{Binds: []string{"/srv/conf"}}, wantErr: true},
+		{name: "bind to relative path", node: api.Node{Binds: []string{"/srv/conf:etc/frr"}}, wantErr: true},
+		{name: "bind with empty source", node: api.Node{Binds: []string{":/etc/frr"}}, wantErr: true},
+		{name: "bind with too many parts", node: api.Node{Binds: []string{"/a:/b:ro:z"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, hostCfg, err := node.ContainerSpec(tt.node)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, cfg, hostCfg)
+		})
+	}
+}
+
+func TestRestartPolicy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    container.RestartPolicy
+		wantErr bool
+	}{
+		{in: "", want: container.RestartPolicy{Name: container.RestartPolicyDisabled}},
+		{in: "no", want: container.RestartPolicy{Name: container.RestartPolicyDisabled}},
+		{in: "always", want: container.RestartPolicy{Name: container.RestartPolicyAlways}},
+		{in: "unless-stopped", want: container.RestartPolicy{Name: container.RestartPolicyUnlessStopped}},
+		{in: "on-failure", want: container.RestartPolicy{Name: container.RestartPolicyOnFailure}},
+		{in: "on-failure:3", want: container.RestartPolicy{Name: container.RestartPolicyOnFailure, MaximumRetryCount: 3}},
+		{in: "always:3", wantErr: true},
+		{in: "on-failure:-1", wantErr: true},
+		{in: "on-failure:x", wantErr: true},
+		{in: "sometimes", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := node.RestartPolicy(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("RestartPolicy(%q) = %+v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("RestartPolicy(%q) = %+v, %v, want %+v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestEnv(t *testing.T) {
+	tests := []struct {
+		env  map[string]string
+		want []string
+	}{
+		{env: nil, want: nil},
+		{env: map[string]string{}, want: nil},
+		{env: map[string]string{"B": "2", "A": "1", "EMPTY": ""}, want: []string{"A=1", "B=2", "EMPTY="}},
+	}
+	for _, tt := range tests {
+		if got := node.Env(tt.env); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Env(%v) = %v, want %v", tt.env, got, tt.want)
+		}
+	}
+}
@@ -4,8 +4,8 @@ import (
 	"Netlink/api"
 	"fmt"
 	"github.com/digitalocean/go-openvswitch/ovs"
-	"github.com/sirupsen/logrus"
 	"github.com/vishvananda/netlink"
+	"log/slog"
 	"os/exec"
 	"strconv"
 	"strings"
@@ -19,41 +19,50 @@ const (
 type OvsManager struct {
 	oClinet *ovs.Client
 	bridge  string
+	log     *slog.Logger
 }
 
 // NewOvsManager creates a new OvsManager
-// and initializes the default bridge
-func NewOvsManager() *OvsManager {
+// and initializes the given bridge (DefaultBridge if empty)
+func NewOvsManager(bridge string, logger *slog.Logger) (*OvsManager, error) {
+	if bridge == "" {
+		bridge = DefaultBridge
+	}
 	c := ovs.New()
 	om := &OvsManager{
 		oClinet: c,
-		bridge:  DefaultBridge,
+		bridge:  bridge,
+		log:     logger.With("bridge", bridge),
 	}
-	err := om.CreateBridge()
-	if err != nil {
-		panic(err)
+	if err := om.CreateBridge(); err != nil {
+		return nil, err
 	}
-	return om
+	return om, nil
+}
+
+// Bridge returns the name of the managed OVS bridge
+func (om *OvsManager) Bridge() string {
+	return om.bridge
 }
 
 // CreateBridge creates a new OVS bridge
 // deletes the default NORMAL rule, not supporting broadcast
 func (om *OvsManager) CreateBridge() error {
 	if err := om.oClinet.VSwitch.AddBridge(om.bridge); err != nil {
-		return err
+		return fmt.Errorf("failed to create OVS bridge %s: %w", om.bridge, err)
 	}
 	// delete the default NORMAL rule
 	if err := om.oClinet.OpenFlow.DelFlows(om.bridge, &ovs.MatchFlow{}); err != nil {
-		return err
+		return fmt.Errorf("failed to delete default flows on %s: %w", om.bridge, err)
 	}
 
 	// sudo ovs-vsctl set bridge ovs-br-host datapath_type=system
 	// set the bridge to use the system datapath
 	cmd := exec.Command("ovs-vsctl", "set", "bridge", om.bridge, "datapath_type=system")
-	err := cmd.Run()
-	if err != nil {
-		logrus.Fatalf("error setting OVS bridge %s datapath type: %v", om.bridge, err)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error setting OVS bridge %s datapath type: %w", om.bridge, err)
 	}
+	om.log.Debug("bridge created", "op", "bridge.create")
 
 	return nil
 }
@@ -94,7 +103,7 @@ func (om *OvsManager) AddFlowsByLink(src api.Node, output string) error {
 	// Add flow to ovs group table
 	//  ovs-ofctl mod-group netlink-br0 group_id=2,type=all,bucket=output:"node1-ovs",bucket=output:"node3-ovs"
 	cmd := exec.Command("ovs-ofctl", "mod-group", om.bridge, "group_id="+strconv.Itoa(src.Uid)+",type=all"+output)
-	//println(cmd.String())
+	om.log.Debug("modify group", "op", "group.modify", "node", src.Name, "group", src.Uid, "cmd", cmd.String())
 	res, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("failed to add group table: %v", string(res))
@@ -103,6 +112,11 @@ func (om *OvsManager) AddFlowsByLink(src api.Node, output string) error {
 	return err
 }
 
+// PortId returns the OpenFlow port number of port on the bridge
+func (om *OvsManager) PortId(port string) (int, error) {
+	return GetPortId(om.bridge, port)
+}
+
 // GetPortId returns the port id of the given port on the OVS bridge
 func GetPortId(bridge, port string) (int, error) {
 	cmd := exec.Command("ovs-vsctl", "get", "Interface", port, "ofport")
@@ -128,10 +142,242 @@ func (om *OvsManager) AddGroupTable(intf string, groupId int) error {
 		return fmt.Errorf("failed to add group table: %v", string(res))
 	}
 
-	in_port, _ := GetPortId(om.bridge, intf)
+	in_port, err := GetPortId(om.bridge, intf)
+	if err != nil {
+		return err
+	}
 	//ovs-ofctl add-flow netlink-br0 in_port=7,actions=group:2
 	cmd = exec.Command("ovs-ofctl", "add-flow", om.bridge, "in_port="+strconv.Itoa(in_port)+",actions=group:"+strconv.Itoa(groupId))
-	err = cmd.Run()
+	if res, err = cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to add flow for %s: %v", intf, string(res))
+	}
 
-	return err
+	return nil
+}
+
+// DeleteGroupTable removes the flow of in_port and the group table added by AddGroupTable,
+// inPort <= 0 skips the flow
+func (om *OvsManager) DeleteGroupTable(inPort int, groupId int) error {
+	if inPort > 0 {
+		// ovs-ofctl del-flows netlink-br0 in_port=7
+		cmd := exec.Command("ovs-ofctl", "del-flows", om.bridge, "in_port="+strconv.Itoa(inPort))
+		if res, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to delete flows of port %d: %v", inPort, string(res))
+		}
+	}
+	// ovs-ofctl del-groups netlink-br0 group_id=2
+	cmd := exec.Command("ovs-ofctl", "del-groups", om.bridge, "group_id="+strconv.Itoa(groupId))
+	if res, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to delete group table %d: %v", groupId, string(res))
+	}
+	return nil
+}
+
+// DeleteVeth removes the host side of the veth pair from the OVS bridge
+func (om *OvsManager) DeleteVeth(vethHost string) error {
+	if err := om.oClinet.VSwitch.DeletePort(om.bridge, vethHost); err != nil {
+		return fmt.Errorf("failed to delete veth %s from OVS bridge: %v", vethHost, err)
+	}
+	return nil
+}
+
+// DumpGroups returns the output ports of the buckets of every group on the bridge
+func (om *OvsManager) DumpGroups() (map[int][]string, error) {
+	// ovs-ofctl --names dump-groups netlink-br0
+	cmd := exec.Command("ovs-ofctl", "--names", "dump-groups", om.bridge)
+	res, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to dump groups: %v", string(res))
+	}
+	groups := make(map[int][]string)
+	for _, line := range strings.Split(string(res), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "group_id=") {
+			continue
+		}
+		// group_id=1,type=all,bucket=bucket_id:0,actions=output:"node2-ovs"
+		fields := strings.Split(line, ",")
+		id, err := strconv.Atoi(strings.TrimPrefix(fields[0], "group_id="))
+		if err != nil {
+			return nil, fmt.Errorf("unexpected group %q", line)
+		}
+		ports := []string{}
+		for _, f := range fields[1:] {
+			if i := strings.Index(f, "output:"); i >= 0 {
+				ports = append(ports, strings.Trim(f[i+len("output:"):], "\""))
+			}
+		}
+		groups[id] = ports
+	}
+	return groups, nil
+}
+
+// DumpFlows returns the group every input port is forwarded to
+func (om *OvsManager) DumpFlows() (map[string]int, error) {
+	// ovs-ofctl --names dump-flows netlink-br0
+	cmd := exec.Command("ovs-ofctl", "--names", "dump-flows", om.bridge)
+	res, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to dump flows: %v", string(res))
+	}
+	flows := make(map[string]int)
+	for _, line := range strings.Split(string(res), "\n") {
+		// cookie=0x0, duration=1.2s, table=0, n_packets=0, n_bytes=0, in_port="node1-ovs" actions=group:1
+		var port string
+		group := -1
+		for _, f := range strings.FieldsFunc(line, func(r rune) bool { return r == ' ' || r == ',' }) {
+			switch {
+			case strings.HasPrefix(f, "in_port="):
+				port = strings.Trim(strings.TrimPrefix(f, "in_port="), "\"")
+			case strings.HasPrefix(f, "actions=group:"):
+				group, _ = strconv.Atoi(strings.TrimPrefix(f, "actions=group:"))
+			}
+		}
+		if port != "" && group >= 0 {
+			flows[port] = group
+		}
+	}
+	return flows, nil
+}
+
+// PortStats are the counters of a port on the bridge
+type PortStats struct {
+	RxPackets uint64
+	RxBytes   uint64
+	RxDropped uint64
+	TxPackets uint64
+	TxBytes   uint64
+	TxDropped uint64
+}
+
+// GroupStats are the counters of a group table
+type GroupStats struct {
+	Packets uint64
+	Bytes   uint64
+}
+
+// DumpPortStats returns the counters of every port on the bridge by name
+func (om *OvsManager) DumpPortStats() (map[string]PortStats, error) {
+	// ovs-ofctl --names dump-ports netlink-br0
+	cmd := exec.Command("ovs-ofctl", "--names", "dump-ports", om.bridge)
+	res, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to dump ports: %v", string(res))
+	}
+	stats := make(map[string]PortStats)
+	var port string
+	for _, line := range strings.Split(string(res), "\n") {
+		//   port  "node1-ovs": rx pkts=10, bytes=840, drop=0, errs=0, frame=0, over=0, crc=0
+		//            tx pkts=5, bytes=420, drop=0, errs=0, coll=0
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "port ") {
+			i := strings.Index(line, ":")
+			if i < 0 {
+				continue
+			}
+			port = strings.Trim(strings.TrimSpace(line[len("port "):i]), "\"")
+			line = strings.TrimSpace(line[i+1:])
+		}
+		if port == "" {
+			continue
+		}
+		s := stats[port]
+		values := counterValues(line)
+		switch {
+		case strings.HasPrefix(line, "rx "):
+			s.RxPackets, s.RxBytes, s.RxDropped = values["pkts"], values["bytes"], values["drop"]
+		case strings.HasPrefix(line, "tx "):
+			s.TxPackets, s.TxBytes, s.TxDropped = values["pkts"], values["bytes"], values["drop"]
+		default:
+			continue
+		}
+		stats[port] = s
+	}
+	return stats, nil
+}
+
+// DumpGroupStats returns the counters of every group on the bridge by group id
+func (om *OvsManager) DumpGroupStats() (map[int]GroupStats, error) {
+	// ovs-ofctl dump-group-stats netlink-br0
+	cmd := exec.Command("ovs-ofctl", "dump-group-stats", om.bridge)
+	res, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to dump group stats: %v", string(res))
+	}
+	stats := make(map[int]GroupStats)
+	for _, line := range strings.Split(string(res), "\n") {
+		// group_id=1,duration=3.2s,ref_count=1,packet_count=0,byte_count=0,bucket0:packet_count=0,byte_count=0
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "group_id=") {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		id, err := strconv.Atoi(strings.TrimPrefix(fields[0], "group_id="))
+		if err != nil {
+			continue
+		}
+		var s GroupStats
+		// the totals come before the bucket counters
+		for _, f := range fields[1:] {
+			if strings.HasPrefix(f, "bucket") {
+				break
+			}
+			if v, ok := strings.CutPrefix(f, "packet_count="); ok {
+				s.Packets, _ = strconv.ParseUint(v, 10, 64)
+			} else if v, ok := strings.CutPrefix(f, "byte_count="); ok {
+				s.Bytes, _ = strconv.ParseUint(v, 10, 64)
+			}
+		}
+		stats[id] = s
+	}
+	return stats, nil
+}
+
+// counterValues parses "rx pkts=10, bytes=840, drop=0", unknown values ("?") are 0
+func counterValues(line string) map[string]uint64 {
+	values := make(map[string]uint64)
+	for _, f := range strings.FieldsFunc(line, func(r rune) bool { return r == ' ' || r == ',' }) {
+		if k, v, ok := strings.Cut(f, "="); ok {
+			values[k], _ = strconv.ParseUint(v, 10, 64)
+		}
+	}
+	return values
+}
+
+// AddMirror mirrors all traffic of port to the new internal port out
+func AddMirror(bridge, name, port, out string) error {
+	// ovs-vsctl add-port netlink-br0 node1-mir -- set interface node1-mir type=internal
+	//   -- --id=@p get port node1-ovs -- --id=@o get port node1-mir
+	//   -- --id=@m create mirror name=node1-mir select-src-port=@p select-dst-port=@p output-port=@o
+	//   -- add bridge netlink-br0 mirrors @m
+	cmd := exec.Command("ovs-vsctl",
+		"add-port", bridge, out, "--", "set", "interface", out, "type=internal",
+		"--", "--id=@p", "get", "port", port,
+		"--", "--id=@o", "get", "port", out,
+		"--", "--id=@m", "create", "mirror", "name="+name, "select-src-port=@p", "select-dst-port=@p", "output-port=@o",
+		"--", "add", "bridge", bridge, "mirrors", "@m")
+	if res, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to add mirror of %s: %v", port, string(res))
+	}
+	link, err := netlink.LinkByName(out)
+	if err != nil {
+		return fmt.Errorf("failed to find mirror port %s: %v", out, err)
+	}
+	if err = netlink.LinkSetUp(link); err != nil {
+		return fmt.Errorf("failed to bring up mirror port %s: %v", out, err)
+	}
+	return nil
+}
+
+// DeleteMirror removes the mirror and its output port added by AddMirror
+func DeleteMirror(bridge, name, out string) error {
+	// ovs-vsctl -- --id=@m get mirror node1-mir -- remove bridge netlink-br0 mirrors @m -- del-port netlink-br0 node1-mir
+	cmd := exec.Command("ovs-vsctl",
+		"--", "--id=@m", "get", "mirror", name,
+		"--", "remove", "bridge", bridge, "mirrors", "@m",
+		"--", "--if-exists", "del-port", bridge, out)
+	if res, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to delete mirror %s: %v", name, string(res))
+	}
+	return nil
 }
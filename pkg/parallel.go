@@ -0,0 +1,181 @@
+package pkg
+
+import (
+	"Netlink/api"
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultParallelism is the number of nodes or links Apply provisions at once
+const DefaultParallelism = 8
+
+// progressInterval limits how often the progress of a phase is logged
+const progressInterval = 2 * time.Second
+
+type parallelismKey struct{}
+
+// WithParallelism overrides Config.Parallelism for the Apply called with ctx
+func WithParallelism(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, parallelismKey{}, n)
+}
+
+func (m *Manager) parallelism(ctx context.Context) int {
+	if n, ok := ctx.Value(parallelismKey{}).(int); ok && n > 0 {
+		return n
+	}
+	if m.cfg.Parallelism > 0 {
+		return m.cfg.Parallelism
+	}
+	return DefaultParallelism
+}
+
+// lookupNode and storeNode access Nodes from the workers of Apply
+func (m *Manager) lookupNode(name string) (api.Node, bool) {
+	m.nodesMu.Lock()
+	defer m.nodesMu.Unlock()
+	n, ok := m.Nodes[name]
+	return n, ok
+}
+
+func (m *Manager) storeNode(n api.Node) {
+	m.nodesMu.Lock()
+	defer m.nodesMu.Unlock()
+	m.Nodes[n.Name] = n
+}
+
+// parallel runs fn for the items 0 to total-1 with at most parallelism
+// calls at once. After an error or when ctx is done no further item is
+// started, the errors are returned in item order.
+func (m *Manager) parallel(ctx context.Context, parallelism, total int, p *progress, fn func(i int) error) error {
+	errs := make([]error, total)
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := false
+	for i := 0; i < total; i++ {
+		sem <- struct{}{}
+		mu.Lock()
+		stop := failed
+		mu.Unlock()
+		if stop {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			errs[i] = err
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			err := fn(i)
+			if err != nil {
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+			}
+			errs[i] = err
+			p.step()
+		}(i)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// progress reports how far one phase of Apply is
+type progress struct {
+	m     *Manager
+	ctx   context.Context
+	phase string
+	total int
+	start time.Time
+
+	mu   sync.Mutex
+	done int
+	last time.Time
+}
+
+func (m *Manager) startPhase(ctx context.Context, phase string, total int) *progress {
+	p := &progress{m: m, ctx: ctx, phase: phase, total: total, start: time.Now(), last: time.Now()}
+	if total > 0 {
+		m.log.InfoContext(ctx, "apply phase started", "phase", phase, "total", total)
+	}
+	return p
+}
+
+// step counts a finished item, logged at most every progressInterval
+func (p *progress) step() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	if p.done < p.total && time.Since(p.last) >= progressInterval {
+		p.last = time.Now()
+		p.m.log.InfoContext(p.ctx, "apply progress", "phase", p.phase, "done", p.done, "total", p.total)
+	}
+}
+
+func (p *progress) end(err error) {
+	if p.total == 0 {
+		return
+	}
+	p.mu.Lock()
+	done := p.done
+	p.mu.Unlock()
+	attrs := []any{"phase", p.phase, "done", done, "total", p.total, "durationMs", time.Since(p.start).Milliseconds()}
+	if err != nil {
+		p.m.log.ErrorContext(p.ctx, "apply phase failed", append(attrs, "err", err)...)
+		return
+	}
+	p.m.log.InfoContext(p.ctx, "apply phase done", attrs...)
+}
+
+// linkRounds splits links into rounds in which every node is part of at
+// most one link. The links of a node stay in order, so its classids are
+// assigned as if the links were added one by one.
+func linkRounds(links []api.Link) [][]api.Link {
+	next := make(map[string]int) // first round a node is free in
+	var rounds [][]api.Link
+	for _, l := range links {
+		r := max(next[l.SrcNode], next[l.DstNode])
+		if r == len(rounds) {
+			rounds = append(rounds, nil)
+		}
+		rounds[r] = append(rounds[r], l)
+		next[l.SrcNode], next[l.DstNode] = r+1, r+1
+	}
+	return rounds
+}
+
+// groupBatch collects the nodes whose group buckets changed, Apply sets
+// each group once after all links instead of once per link direction
+type groupBatch struct {
+	mu    sync.Mutex
+	nodes map[string]bool
+}
+
+func (g *groupBatch) names() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	names := make([]string, 0, len(g.nodes))
+	for name := range g.nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// updateGroup sets the buckets of n, or leaves them to the batch
+func (m *Manager) updateGroup(n api.Node, groups *groupBatch) error {
+	if groups == nil {
+		return m.applyLink(n)
+	}
+	groups.mu.Lock()
+	defer groups.mu.Unlock()
+	groups.nodes[n.Name] = true
+	return nil
+}
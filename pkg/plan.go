@@ -0,0 +1,125 @@
+package pkg
+
+import (
+	"Netlink/api"
+	"Netlink/pkg/event"
+	"Netlink/pkg/fake"
+	"Netlink/pkg/ovs"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"text/tabwriter"
+)
+
+// Operation is one call Apply would make to the node runtime, traffic
+// control or switch, Detail holds its arguments
+type Operation struct {
+	Action string `json:"action"`
+	Node   string `json:"node"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Plan lists the operations of an Apply in execution order
+type Plan struct {
+	Operations []Operation `json:"operations"`
+}
+
+// Plan computes the operations Apply would execute for topoCfg against
+// the running topology, nothing is changed
+func (m *Manager) Plan(topoCfg api.TopoConfig) (*Plan, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return plan(m.cfg, m.sw.Bridge(), m.nodeList(), m.rt.NextUid(), m.routing, topoCfg)
+}
+
+// PlanTopo computes the operations Apply would execute for topoCfg
+// on an emulator without nodes
+func PlanTopo(cfg Config, topoCfg api.TopoConfig) (*Plan, error) {
+	bridge := cfg.Bridge
+	if bridge == "" {
+		bridge = ovs.DefaultBridge
+	}
+	// uids start at 1 as in a new container manager
+	return plan(cfg, bridge, nil, 1, api.Routing{}, topoCfg)
+}
+
+// plan runs Apply on a copy of nodes held by the recording fakes and
+// returns the operations they recorded
+func plan(cfg Config, bridge string, nodes []api.Node, nextUid int, routing api.Routing, topoCfg api.TopoConfig) (*Plan, error) {
+	ctx := context.Background()
+	f := fake.NewBridge(bridge, cfg.IPPool)
+	shadow := &Manager{
+		Nodes:     make(map[string]api.Node, len(nodes)),
+		sw:        f.Switch,
+		tc:        f.TrafficControl,
+		rt:        f.Runtime,
+		cfg:       cfg,
+		events:    event.NewBus(),
+		log:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+		routing:   routing,
+		stopWatch: func() {},
+	}
+	// the fakes start with the nodes, classes and groups of the running
+	// topology, routes and FRR configurations are only kept by the nodes
+	for _, n := range nodes {
+		if err := f.Runtime.RestoreNode(ctx, &n); err != nil {
+			return nil, err
+		}
+		if err := f.TrafficControl.CreateRootQdisc(n); err != nil {
+			return nil, err
+		}
+		for _, props := range n.Rules {
+			if props.HTBClassid == 0 {
+				continue
+			}
+			if err := f.TrafficControl.AddHtbClass(n, props); err != nil {
+				return nil, err
+			}
+		}
+		shadow.Nodes[n.Name] = n
+	}
+	for _, n := range shadow.Nodes {
+		if err := shadow.applyLink(n); err != nil {
+			return nil, err
+		}
+	}
+	f.Runtime.SetNextUid(nextUid)
+	f.Ops.Reset()
+
+	// one worker keeps the operations in a fixed order
+	if err := shadow.Apply(WithParallelism(ctx, 1), topoCfg); err != nil {
+		return nil, err
+	}
+	p := &Plan{Operations: []Operation{}}
+	for _, op := range f.Ops.All() {
+		p.Operations = append(p.Operations, Operation{Action: op.Method, Node: op.Node, Detail: op.Detail})
+	}
+	return p, nil
+}
+
+// Write prints the plan as text or json
+func (p *Plan) Write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(p)
+	case "text", "":
+		if len(p.Operations) == 0 {
+			_, err := fmt.Fprintln(w, "No changes.")
+			return err
+		}
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "#\tNODE\tACTION\tDETAIL")
+		for i, op := range p.Operations {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", i+1, op.Node, op.Action, op.Detail)
+		}
+		fmt.Fprintf(tw, "\n%d operation(s)\n", len(p.Operations))
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown plan format %q, expected text or json", format)
+	}
+}
@@ -0,0 +1,72 @@
+package pkg
+
+import (
+	"Netlink/pkg/event"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// restartActor is the actor of the events of nodes re-plumbed after
+// their container restarted on its own
+const restartActor = "docker"
+
+// watchRestarts re-plumbs the nodes the runtime reports restarted until
+// ctx is done, the returned function stops watching and waits for it
+func (m *Manager) watchRestarts() func() {
+	ctx, cancel := context.WithCancel(event.WithActor(context.Background(), restartActor))
+	restarts := m.rt.WatchRestarts(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for name := range restarts {
+			// errors are logged and emitted
+			if err := m.Replumb(ctx, name); errors.Is(err, ErrNodeNotFound) {
+				m.log.Debug("restarted container is no node", "node", name)
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// Replumb attaches the node again after its container restarted and the
+// node lost its namespace: the veth pair, address and OVS port are
+// recreated, the root qdisc, classes, filters and groups restored from
+// its Rules and FRR reloaded. Nothing is done if the container did not
+// change.
+func (m *Manager) Replumb(ctx context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, ok := m.Nodes[name]
+	if !ok {
+		return fmt.Errorf("%s: %w", name, ErrNodeNotFound)
+	}
+	start := time.Now()
+	n = copyNode(n)
+	// the cached handle keeps the old namespace alive
+	m.tc.Forget(n)
+	changed, err := m.rt.Replumb(ctx, &n)
+	if !changed && err == nil {
+		return nil
+	}
+	m.Nodes[name] = n
+	if err == nil {
+		err = m.restoreState(n)
+	}
+	if err == nil {
+		err = m.setGateway(n)
+	}
+	// FRR kept its files, the reload sets up the new namespace again
+	if err == nil && n.FrrConf != "" {
+		err = m.installFrr(ctx, n)
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to re-plumb node %s: %w", name, err)
+	}
+	m.emit(ctx, event.Event{Op: event.OpNodeRestart, Node: name, Duration: event.Since(start)}, err)
+	return err
+}
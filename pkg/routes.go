@@ -0,0 +1,97 @@
+package pkg
+
+import (
+	"Netlink/api"
+	"Netlink/pkg/event"
+	"Netlink/pkg/routing"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Routing returns the routing mode of the topology
+func (m *Manager) Routing() api.Routing {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.routing
+}
+
+// setRouting changes the routing mode, it is restored on rollback
+func (m *Manager) setRouting(j *journal, r api.Routing) {
+	old := m.routing
+	m.routing = r
+	j.record("set routing", event.Event{Op: event.OpUndo}, func(ctx context.Context) error {
+		m.routing = old
+		return nil
+	})
+}
+
+// routeChanges returns copies of the nodes whose installed routes differ
+// from those of the routing mode, holding the new routes, ordered by name
+func (m *Manager) routeChanges() []api.Node {
+	var want map[string][]api.Route
+	if m.routing.Mode == api.RoutingStatic {
+		want = routing.Routes(m.nodeList(), m.routing.Metric)
+	}
+	names := make([]string, 0, len(m.Nodes))
+	for name := range m.Nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var changed []api.Node
+	for _, name := range names {
+		n := m.Nodes[name]
+		routes := want[name]
+		if sameRoutes(n.Routes, routes) {
+			continue
+		}
+		n = copyNode(n)
+		n.Routes = routes
+		changed = append(changed, n)
+	}
+	return changed
+}
+
+// sameRoutes reports whether a and b are the same routes, nil and empty alike
+func sameRoutes(a, b []api.Route) bool {
+	return len(a) == len(b) && (len(a) == 0 || reflect.DeepEqual(a, b))
+}
+
+// updateRoutes installs the changed routes one node after the other,
+// Apply does it in parallel
+func (m *Manager) updateRoutes(j *journal) error {
+	for _, n := range m.routeChanges() {
+		if err := m.setRoutes(j, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setRoutes installs the routes of n, on rollback the restored routes
+// of the node are installed again
+func (m *Manager) setRoutes(j *journal, n api.Node) error {
+	j.record("set routes of "+n.Name, event.Event{Op: event.OpUndo, Node: n.Name}, func(ctx context.Context) error {
+		// nodes created by the transaction are deleted instead
+		if old, ok := m.Nodes[n.Name]; ok {
+			return m.installRoutes(old)
+		}
+		return nil
+	})
+	if err := m.installRoutes(n); err != nil {
+		return err
+	}
+	m.storeNode(n)
+	return nil
+}
+
+// installRoutes sets the routes of n, the packets are shaped by the
+// filters of the link to their next hop
+func (m *Manager) installRoutes(n api.Node) error {
+	if err := m.rt.SetRoutes(n, n.Routes); err != nil {
+		return fmt.Errorf("failed to set routes of %s: %w", n.Name, err)
+	}
+	return nil
+}
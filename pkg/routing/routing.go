@@ -0,0 +1,114 @@
+// Package routing computes the routes of the static routing mode: every
+// node forwards the packets to a node it has no shortest direct link to
+// through the first hop of the shortest path over the link directions.
+package routing
+
+import (
+	"Netlink/api"
+	"sort"
+)
+
+// Down reports whether a link direction carries no traffic, such links
+// are left out of the paths
+func Down(p api.LinkProperties) bool {
+	return p.Loss >= 100
+}
+
+// cost of a path, compared by the metric first and the other measure
+// on a tie, so a zero latency link still makes a path longer
+type cost struct {
+	primary, secondary uint64
+}
+
+func (c cost) less(o cost) bool {
+	return c.primary < o.primary || (c.primary == o.primary && c.secondary < o.secondary)
+}
+
+func (c cost) add(p api.LinkProperties, metric string) cost {
+	if metric == api.MetricHops {
+		return cost{c.primary + 1, c.secondary + uint64(p.Latency)}
+	}
+	return cost{c.primary + uint64(p.Latency), c.secondary + 1}
+}
+
+// Routes returns the routes of every node by name, ordered by destination.
+// A direction src -> dst exists if src has a rule to dst that is not Down.
+// Destinations whose shortest path is the direct link get no route,
+// equal paths are chosen by the names of the nodes.
+func Routes(nodes []api.Node, metric string) map[string][]api.Route {
+	byName := make(map[string]api.Node, len(nodes))
+	names := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		byName[n.Name] = n
+		names = append(names, n.Name)
+	}
+	sort.Strings(names)
+
+	routes := make(map[string][]api.Route)
+	for _, src := range names {
+		if r := shortestPaths(byName, names, src, metric); len(r) > 0 {
+			routes[src] = r
+		}
+	}
+	return routes
+}
+
+// shortestPaths runs Dijkstra from src and returns the routes of src
+func shortestPaths(nodes map[string]api.Node, names []string, src, metric string) []api.Route {
+	dist := map[string]cost{src: {}}
+	hop := make(map[string]string) // first hop of the path to a node
+	done := make(map[string]bool)
+	for {
+		// the closest node not done, names keep ties deterministic
+		next := ""
+		for _, name := range names {
+			if d, ok := dist[name]; ok && !done[name] && (next == "" || d.less(dist[next])) {
+				next = name
+			}
+		}
+		if next == "" {
+			break
+		}
+		done[next] = true
+		n := nodes[next]
+		dsts := make([]string, 0, len(n.Rules))
+		for dst := range n.Rules {
+			dsts = append(dsts, dst)
+		}
+		sort.Strings(dsts)
+		for _, dst := range dsts {
+			props := n.Rules[dst]
+			if _, ok := nodes[dst]; !ok || done[dst] || Down(props) {
+				continue
+			}
+			d := dist[next].add(props, metric)
+			if old, ok := dist[dst]; ok && !d.less(old) {
+				continue
+			}
+			dist[dst] = d
+			if next == src {
+				hop[dst] = dst
+			} else {
+				hop[dst] = hop[next]
+			}
+		}
+	}
+
+	var routes []api.Route
+	from := nodes[src]
+	for _, dst := range names {
+		via, ok := hop[dst]
+		if !ok || via == dst {
+			continue
+		}
+		routes = append(routes, api.Route{
+			Dst:        dst,
+			DstIP:      nodes[dst].Interface.Ipv4,
+			Via:        via,
+			ViaIP:      nodes[via].Interface.Ipv4,
+			Cost:       dist[dst].primary,
+			HTBClassid: from.Rules[via].HTBClassid,
+		})
+	}
+	return routes
+}
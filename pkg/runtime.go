@@ -0,0 +1,85 @@
+package pkg
+
+import (
+	"Netlink/api"
+	"Netlink/pkg/link"
+	"Netlink/pkg/node"
+	"Netlink/pkg/ovs"
+	"context"
+)
+
+// NodeRuntime creates the nodes and attaches them to the switch,
+// node.ContainerManager runs them as docker containers
+type NodeRuntime interface {
+	// AddNode assigns the address and creates n, with the next Uid
+	// unless one was reserved for it with ReserveUid. On failure the
+	// parts it created are removed.
+	AddNode(ctx context.Context, n *api.Node) error
+	// RestoreNode recreates a deleted node keeping its Uid and address
+	RestoreNode(ctx context.Context, n *api.Node) error
+	// DeleteNode removes n, parts that were never created are skipped
+	DeleteNode(ctx context.Context, n *api.Node) error
+	// EnsureImages makes the images of the container nodes among nodes
+	// available, pulling or loading them according to their pull policy
+	EnsureImages(ctx context.Context, nodes []api.Node) error
+	// ReserveUid takes the next Uid, safe for concurrent use
+	ReserveUid() int
+	// NextUid returns the Uid the next created node gets
+	NextUid() int
+	// WatchRestarts sends the name of a node each time its container is
+	// started again, until ctx is done
+	WatchRestarts(ctx context.Context) <-chan string
+	// Replumb attaches n again after its container restarted: namespace,
+	// veth, address and OVS port and group. It reports false if the
+	// container of n did not change.
+	Replumb(ctx context.Context, n *api.Node) (bool, error)
+	// SetDefaultRoute points the default route of n to the address gw
+	SetDefaultRoute(n api.Node, gw string) error
+	// SetRoutes replaces the routes of the static routing mode in n
+	SetRoutes(n api.Node, routes []api.Route) error
+	// SetFrr writes the FRR configuration files to the container of n
+	// and reloads FRR
+	SetFrr(ctx context.Context, n api.Node, conf, daemons string) error
+	Close() error
+}
+
+// TrafficControl installs the qdiscs, classes and filters shaping the
+// links in the node namespaces, link.LinkManager does it with netlink
+type TrafficControl interface {
+	link.Shaper
+	CreateRootQdisc(n api.Node) error
+	DeleteHtbClass(n api.Node, props api.LinkProperties) error
+	ReadTc(n api.Node) (*link.TcState, error)
+	ReadStats(n api.Node) (map[uint32]link.ClassStats, error)
+	// Forget releases what is cached for n, called before n is deleted
+	Forget(n api.Node)
+	Close() error
+}
+
+// Switch forwards between the nodes with one group per node,
+// ovs.OvsManager programs an OVS bridge
+type Switch interface {
+	Bridge() string
+	PortId(port string) (int, error)
+	// AddFlowsByLink sets the buckets of the group of src
+	AddFlowsByLink(src api.Node, output string) error
+	AddGroupTable(port string, group int) error
+	DeleteGroupTable(inPort int, group int) error
+	DumpGroups() (map[int][]string, error)
+	DumpFlows() (map[string]int, error)
+	DumpPortStats() (map[string]ovs.PortStats, error)
+	DumpGroupStats() (map[int]ovs.GroupStats, error)
+	DeleteBridge() error
+}
+
+var (
+	_ NodeRuntime    = (*node.ContainerManager)(nil)
+	_ TrafficControl = (*link.LinkManager)(nil)
+	_ Switch         = (*ovs.OvsManager)(nil)
+)
+
+// applyLink sets the buckets of the group of src to its Rules,
+// a node without rules gets an empty group
+func (m *Manager) applyLink(src api.Node) error {
+	return m.sw.AddFlowsByLink(src, link.Buckets(src))
+}
@@ -0,0 +1,81 @@
+package pkg
+
+import (
+	"Netlink/api"
+	"Netlink/pkg/link"
+	"Netlink/pkg/ovs"
+	"context"
+	"time"
+)
+
+// LinkStats are the counters of one configured direction, Shaped is false
+// for rules without an HTB class
+type LinkStats struct {
+	Src        string
+	Dst        string
+	Properties api.LinkProperties
+	Shaped     bool
+	link.ClassStats
+}
+
+// NodeStats are the counters of the OVS port and group of a node
+type NodeStats struct {
+	Node  string
+	Port  ovs.PortStats
+	Group ovs.GroupStats
+}
+
+// Stats is a snapshot of all counters, nodes that cannot be read are
+// listed in Errors and left out
+type Stats struct {
+	Time   time.Time
+	Links  []LinkStats
+	Nodes  []NodeStats
+	Errors map[string]error
+}
+
+// Stats reads the tc counters in every node namespace and the OVS port
+// and group counters, ordered like NodeList and LinkList
+func (m *Manager) Stats(ctx context.Context) (*Stats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ports, err := m.sw.DumpPortStats()
+	if err != nil {
+		return nil, err
+	}
+	groups, err := m.sw.DumpGroupStats()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Stats{Time: time.Now(), Errors: make(map[string]error)}
+	nodes := m.nodeList()
+	classes := make(map[string]map[uint32]link.ClassStats, len(nodes))
+	for _, n := range nodes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		s.Nodes = append(s.Nodes, NodeStats{
+			Node:  n.Name,
+			Port:  ports[n.Name+ovs.VethOvsSideSuffix],
+			Group: groups[n.Uid],
+		})
+		if classes[n.Name], err = m.tc.ReadStats(n); err != nil {
+			s.Errors[n.Name] = err
+		}
+	}
+	for _, l := range m.linkList() {
+		cs, ok := classes[l.SrcNode]
+		if !ok || s.Errors[l.SrcNode] != nil {
+			continue
+		}
+		ls := LinkStats{Src: l.SrcNode, Dst: l.DstNode, Properties: l.Properties}
+		if l.Properties.HTBClassid != 0 {
+			ls.Shaped = true
+			ls.ClassStats = cs[l.Properties.HTBClassid]
+		}
+		s.Links = append(s.Links, ls)
+	}
+	return s, nil
+}
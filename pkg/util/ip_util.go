@@ -1,11 +1,17 @@
 package util
 
 import (
+	"encoding/binary"
+	"fmt"
+	"net"
 	"regexp"
 	"strconv"
 	"strings"
 )
 
+// DefaultIPPool is the range reserved for automatically assigned node addresses
+const DefaultIPPool = "192.168.10.0/24"
+
 func CheckInvalidIpv4(ip string) bool {
 	// legal IP address format: 192.168.1.1/24
 	re := regexp.MustCompile(`^([0-9]{1,3}\.){3}[0-9]{1,3}(/([8-9]|1[0-9]|2[0-9]|3[0-2]))?$`)
@@ -28,10 +34,36 @@ func CheckInvalidIpv4(ip string) bool {
 		}
 	}
 
-	// We reserve the IP address range 192.168.10
-	if parts[0] == "192" && parts[1] == "168" && parts[2] == "10" {
+	return true
+}
+
+// InPool reports whether the address part of ip (with or without prefix) lies in pool
+func InPool(ip, pool string) bool {
+	_, poolNet, err := net.ParseCIDR(pool)
+	if err != nil {
 		return false
 	}
+	addr := net.ParseIP(strings.Split(ip, "/")[0])
+	return addr != nil && poolNet.Contains(addr)
+}
 
-	return true
+// AllocateIpv4 returns the idx-th host address of pool in CIDR notation,
+// e.g. AllocateIpv4("192.168.10.0/24", 3) = "192.168.10.3/24"
+func AllocateIpv4(pool string, idx int) (string, error) {
+	_, poolNet, err := net.ParseCIDR(pool)
+	if err != nil {
+		return "", fmt.Errorf("invalid ip pool %s: %w", pool, err)
+	}
+	base := poolNet.IP.To4()
+	if base == nil {
+		return "", fmt.Errorf("ip pool %s is not IPv4", pool)
+	}
+	ones, bits := poolNet.Mask.Size()
+	// exclude network and broadcast address
+	if idx <= 0 || uint64(idx) >= (uint64(1)<<uint(bits-ones))-1 {
+		return "", fmt.Errorf("ip pool %s exhausted at index %d", pool, idx)
+	}
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, binary.BigEndian.Uint32(base)+uint32(idx))
+	return fmt.Sprintf("%s/%d", ip.String(), ones), nil
 }
@@ -0,0 +1,546 @@
+package validate
+
+import (
+	"Netlink/api"
+	"Netlink/pkg/generator"
+	"Netlink/pkg/link"
+	"Netlink/pkg/node"
+	"Netlink/pkg/util"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"math"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// interface names are limited to 15 bytes and the node veth is named <node>-veth0
+const maxNodeName = 15 - len(node.NodeVethSuffix)
+
+var nodeNameRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// checker holds the state of one validation, root is nil for decoded topologies
+type checker struct {
+	file   string
+	root   *yaml.Node
+	opts   Options
+	report *Report
+}
+
+func newChecker(file string, root *yaml.Node, opts Options) *checker {
+	if opts.IPPool == "" {
+		opts.IPPool = util.DefaultIPPool
+	}
+	return &checker{file: file, root: root, opts: opts, report: &Report{}}
+}
+
+// locate returns the YAML node at path (string keys, int indices),
+// or the deepest node found on the way
+func (c *checker) locate(path []interface{}) *yaml.Node {
+	if c.root == nil || len(c.root.Content) == 0 {
+		return nil
+	}
+	n := c.root.Content[0]
+	for _, p := range path {
+		var next *yaml.Node
+		switch key := p.(type) {
+		case string:
+			if n.Kind == yaml.MappingNode {
+				for i := 0; i+1 < len(n.Content); i += 2 {
+					if n.Content[i].Value == key {
+						next = n.Content[i+1]
+						break
+					}
+				}
+			}
+		case int:
+			if n.Kind == yaml.SequenceNode && key < len(n.Content) {
+				next = n.Content[key]
+			}
+		}
+		if next == nil {
+			return n
+		}
+		n = next
+	}
+	return n
+}
+
+func (c *checker) add(path []interface{}, warning bool, format string, args ...interface{}) {
+	issue := Issue{File: c.file, Message: fmt.Sprintf(format, args...), Warning: warning}
+	if n := c.locate(path); n != nil && path != nil {
+		issue.Line, issue.Column = n.Line, n.Column
+	}
+	c.report.Issues = append(c.report.Issues, issue)
+}
+
+func (c *checker) errorf(path []interface{}, format string, args ...interface{}) {
+	c.add(path, false, format, args...)
+}
+
+func (c *checker) warnf(path []interface{}, format string, args ...interface{}) {
+	c.add(path, true, format, args...)
+}
+
+func (c *checker) errorAt(n *yaml.Node, format string, args ...interface{}) {
+	c.report.Issues = append(c.report.Issues, Issue{
+		File:    c.file,
+		Line:    n.Line,
+		Column:  n.Column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// nodeSpec is a node with the path it was defined at
+type nodeSpec struct {
+	api.Node
+	path []interface{}
+	ip   []interface{} // path of the ipv4 value
+}
+
+type linkSpec struct {
+	api.Link
+	path      []interface{}
+	generated bool // properties were checked at the generator
+}
+
+// check runs the semantic checks on topo, generators are expanded
+// and their issues reported at the generator
+func (c *checker) check(topo api.TopoConfig) {
+	var nodes []nodeSpec
+	var links []linkSpec
+	for i, n := range topo.Nodes {
+		nodes = append(nodes, nodeSpec{Node: n, path: []interface{}{"nodes", i}, ip: []interface{}{"nodes", i, "interface", "ipv4"}})
+	}
+	for i, l := range topo.Links {
+		links = append(links, linkSpec{Link: l, path: []interface{}{"links", i}})
+	}
+	for i, g := range topo.Generators {
+		path := []interface{}{"generators", i}
+		c.checkGenerator(g, path)
+		gen, err := generator.Generate(g)
+		if err != nil {
+			c.errorf(path, "%v", err)
+			continue
+		}
+		for _, n := range gen.Nodes {
+			nodes = append(nodes, nodeSpec{Node: n, path: path, ip: append(path, "subnet")})
+		}
+		for _, l := range gen.Links {
+			links = append(links, linkSpec{Link: l, path: append(path, "properties"), generated: true})
+		}
+	}
+
+	known := c.checkNodes(nodes)
+	c.checkGateways(nodes, links, known)
+	c.checkFrr(nodes)
+	c.checkAddresses(nodes)
+	c.checkLinks(links, known)
+	if topo.Routing != nil {
+		c.checkRouting(*topo.Routing)
+	}
+}
+
+func (c *checker) checkRouting(r api.Routing) {
+	switch r.Mode {
+	case "", api.RoutingNone, api.RoutingStatic:
+	default:
+		c.errorf([]interface{}{"routing", "mode"}, "unknown routing mode %q, expected %s or %s", r.Mode, api.RoutingNone, api.RoutingStatic)
+	}
+	switch r.Metric {
+	case "", api.MetricLatency, api.MetricHops:
+	default:
+		c.errorf([]interface{}{"routing", "metric"}, "unknown routing metric %q, expected %s or %s", r.Metric, api.MetricLatency, api.MetricHops)
+	}
+}
+
+// checkNodes reports invalid and duplicate names and returns all node names
+// links may refer to, including running nodes
+func (c *checker) checkNodes(nodes []nodeSpec) map[string]bool {
+	known := make(map[string]bool, len(nodes)+len(c.opts.Existing))
+	for _, n := range c.opts.Existing {
+		known[n.Name] = true
+	}
+	defined := make(map[string][]interface{}, len(nodes))
+	for _, n := range nodes {
+		namePath := append(append([]interface{}{}, n.path...), "name")
+		switch {
+		case n.Name == "":
+			c.errorf(n.path, "node without name")
+			continue
+		case len(n.Name) > maxNodeName:
+			c.errorf(namePath, "node name %q is longer than %d characters, its interface name would exceed the kernel limit", n.Name, maxNodeName)
+		case !nodeNameRe.MatchString(n.Name):
+			c.errorf(namePath, "node name %q may only contain letters, digits, '_', '.' and '-'", n.Name)
+		}
+		c.checkKind(n)
+		if first, ok := defined[n.Name]; ok {
+			c.errorf(namePath, "duplicate node %q, first defined at %s", n.Name, c.position(first))
+			continue
+		}
+		defined[n.Name] = n.path
+		known[n.Name] = true
+	}
+	return known
+}
+
+// checkKind reports fields the kind of n does not support
+func (c *checker) checkKind(n nodeSpec) {
+	field := func(name string) []interface{} {
+		return append(append([]interface{}{}, n.path...), name)
+	}
+	switch n.Kind {
+	case "", api.KindContainer, api.KindNetns, api.KindHost, api.KindNat:
+	default:
+		c.errorf(field("kind"), "node %s: unknown kind %q, expected %s, %s, %s or %s",
+			n.Name, n.Kind, api.KindContainer, api.KindNetns, api.KindHost, api.KindNat)
+		return
+	}
+	container := n.Kind == "" || n.Kind == api.KindContainer
+	if container {
+		if _, _, err := node.ContainerSpec(n.Node); err != nil {
+			c.errorf(n.path, "node %s: %v", n.Name, err)
+		}
+		switch n.ImagePullPolicy {
+		case "", api.PullAlways, api.PullIfNotPresent:
+		case api.PullNever:
+			if n.ImageArchive != "" {
+				c.warnf(field("imageArchive"), "node %s: imageArchive is never loaded with imagePullPolicy %s", n.Name, api.PullNever)
+			}
+		default:
+			c.errorf(field("imagePullPolicy"), "node %s: unknown imagePullPolicy %q, expected %s, %s or %s",
+				n.Name, n.ImagePullPolicy, api.PullAlways, api.PullIfNotPresent, api.PullNever)
+		}
+	} else {
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"image", n.Image != ""},
+			{"entrypoint", len(n.Entrypoint) > 0},
+			{"env", len(n.Env) > 0},
+			{"binds", len(n.Binds) > 0},
+			{"workdir", n.Workdir != ""},
+			{"cpus", n.Cpus != 0},
+			{"memory", n.Memory != ""},
+			{"sysctls", len(n.Sysctls) > 0},
+			{"capabilities", n.Capabilities != nil},
+			{"restartPolicy", n.RestartPolicy != ""},
+			{"imagePullPolicy", n.ImagePullPolicy != ""},
+			{"imageArchive", n.ImageArchive != ""},
+		} {
+			if f.set {
+				c.warnf(field(f.name), "node %s: %s is ignored by %s nodes", n.Name, f.name, n.Kind)
+			}
+		}
+	}
+	if len(n.Command) > 0 && !container && n.Kind != api.KindNetns {
+		c.warnf(field("command"), "node %s: command is only used by netns and container nodes", n.Name)
+	}
+	switch {
+	case n.Kind == api.KindNat && n.Uplink == "":
+		c.errorf(n.path, "node %s: nat nodes need an uplink, the host interface to masquerade out of", n.Name)
+	case n.Kind != api.KindNat && n.Uplink != "":
+		c.warnf(field("uplink"), "node %s: uplink is only used by nat nodes", n.Name)
+	}
+	if n.Kind == api.KindHost && n.Gateway != "" {
+		c.errorf(field("gateway"), "node %s: host nodes keep the default route of the host", n.Name)
+	}
+}
+
+// checkGateways reports gateways that are not nodes of the topology or
+// that the node has no link to, the group of the node would drop every
+// packet to them
+func (c *checker) checkGateways(nodes []nodeSpec, links []linkSpec, known map[string]bool) {
+	// directions src -> dst the links create
+	linked := make(map[[2]string]bool)
+	for _, l := range links {
+		linked[[2]string{l.SrcNode, l.DstNode}] = true
+		if !l.UniDirectional {
+			linked[[2]string{l.DstNode, l.SrcNode}] = true
+		}
+	}
+	for _, n := range nodes {
+		if n.Gateway == "" {
+			continue
+		}
+		path := append(append([]interface{}{}, n.path...), "gateway")
+		switch {
+		case n.Gateway == n.Name:
+			c.errorf(path, "node %s is its own gateway", n.Name)
+		case !known[n.Gateway]:
+			c.errorf(path, "node %s: gateway %q is not a node", n.Name, n.Gateway)
+		case !linked[[2]string{n.Name, n.Gateway}]:
+			c.errorf(path, "node %s has no link to its gateway %s", n.Name, n.Gateway)
+		}
+	}
+}
+
+var isisAreaRe = regexp.MustCompile(`^[0-9a-fA-F]{2}(\.[0-9a-fA-F]{4}){0,6}$`)
+
+// checkFrr reports invalid routing protocol settings and BGP neighbours
+// that are no nodes running BGP
+func (c *checker) checkFrr(nodes []nodeSpec) {
+	bgp := make(map[string]bool)
+	for _, n := range c.opts.Existing {
+		bgp[n.Name] = n.Frr != nil && n.Frr.Bgp != nil
+	}
+	for _, n := range nodes {
+		bgp[n.Name] = n.Frr != nil && n.Frr.Bgp != nil
+	}
+	for _, n := range nodes {
+		if n.Frr == nil {
+			continue
+		}
+		field := func(names ...interface{}) []interface{} {
+			return append(append(append([]interface{}{}, n.path...), "frr"), names...)
+		}
+		if n.Kind != "" && n.Kind != api.KindContainer {
+			c.errorf(field(), "node %s: frr only runs in container nodes", n.Name)
+			continue
+		}
+		cfg := n.Frr
+		if cfg.Ospf == nil && cfg.Bgp == nil && cfg.Isis == nil {
+			c.warnf(field(), "node %s: frr without ospf, bgp or isis starts no routing protocol", n.Name)
+		}
+		if cfg.RouterID != "" && net.ParseIP(cfg.RouterID).To4() == nil {
+			c.errorf(field("routerId"), "node %s: router id %q is not an ipv4 address", n.Name, cfg.RouterID)
+		}
+		if o := cfg.Ospf; o != nil {
+			if o.Area != "" && net.ParseIP(o.Area).To4() == nil && !isUint32(o.Area) {
+				c.errorf(field("ospf", "area"), "node %s: ospf area %q is neither dotted like 0.0.0.1 nor a number", n.Name, o.Area)
+			}
+			if o.DeadInterval != 0 && o.DeadInterval <= o.HelloInterval {
+				c.errorf(field("ospf", "deadInterval"), "node %s: ospf deadInterval must be longer than helloInterval", n.Name)
+			}
+		}
+		if b := cfg.Bgp; b != nil {
+			if b.Asn == 0 {
+				c.errorf(field("bgp"), "node %s: bgp needs an asn", n.Name)
+			}
+			for i, peer := range b.Neighbors {
+				runs, ok := bgp[peer]
+				switch {
+				case peer == n.Name:
+					c.errorf(field("bgp", "neighbors", i), "node %s is its own bgp neighbor", n.Name)
+				case !ok:
+					c.errorf(field("bgp", "neighbors", i), "node %s: bgp neighbor %q is not a node", n.Name, peer)
+				case !runs:
+					c.errorf(field("bgp", "neighbors", i), "node %s: bgp neighbor %s does not run bgp", n.Name, peer)
+				}
+			}
+			for i, network := range b.Networks {
+				if _, _, err := net.ParseCIDR(network); err != nil {
+					c.errorf(field("bgp", "networks", i), "node %s: bgp network %q is not a prefix like 10.1.0.0/16", n.Name, network)
+				}
+			}
+			if b.HoldTime != 0 && b.HoldTime < 3 {
+				c.errorf(field("bgp", "holdTime"), "node %s: bgp holdTime must be at least 3 seconds", n.Name)
+			} else if b.Keepalive != 0 && b.HoldTime != 0 && b.HoldTime < 3*b.Keepalive {
+				c.warnf(field("bgp", "holdTime"), "node %s: bgp holdTime below 3 keepalives drops sessions on a single lost keepalive", n.Name)
+			}
+		}
+		if i := cfg.Isis; i != nil && i.Area != "" && !isisAreaRe.MatchString(i.Area) {
+			c.errorf(field("isis", "area"), "node %s: isis area %q is not an area address like 49.0001", n.Name, i.Area)
+		}
+	}
+}
+
+func isUint32(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 32)
+	return err == nil
+}
+
+// checkAddresses validates explicit addresses, reports duplicates and
+// nodes that cannot share the single L2 segment of the bridge
+func (c *checker) checkAddresses(nodes []nodeSpec) {
+	_, pool, err := net.ParseCIDR(c.opts.IPPool)
+	if err != nil {
+		c.errorf(nil, "invalid ip pool %q: %v", c.opts.IPPool, err)
+		return
+	}
+
+	type owner struct {
+		name string
+		path []interface{}
+	}
+	used := make(map[string]owner)
+	redefined := make(map[string]bool, len(nodes))
+	for _, n := range nodes {
+		redefined[n.Name] = true
+	}
+	// addresses of running nodes that are not replaced stay in use
+	for _, n := range c.opts.Existing {
+		if redefined[n.Name] || n.Interface.Ipv4 == "" {
+			continue
+		}
+		used[strings.Split(n.Interface.Ipv4, "/")[0]] = owner{name: n.Name}
+	}
+
+	var subnets []*net.IPNet
+	subnetOwner := make(map[string]string)
+	auto := 0
+	for _, n := range nodes {
+		ipv4 := n.Interface.Ipv4
+		if ipv4 == "" {
+			auto++
+			continue
+		}
+		if !util.CheckInvalidIpv4(ipv4) {
+			c.errorf(n.ip, "node %s: invalid ipv4 address %q", n.Name, ipv4)
+			continue
+		}
+		ip, ipNet, err := net.ParseCIDR(ipv4)
+		if err != nil {
+			c.errorf(n.ip, "node %s: ipv4 address %q needs a prefix length, e.g. %s/24", n.Name, ipv4, ipv4)
+			continue
+		}
+		if pool.Contains(ip) {
+			c.errorf(n.ip, "node %s: %s lies in %s which is reserved for automatic addresses", n.Name, ipv4, c.opts.IPPool)
+			continue
+		}
+		if ones, bits := ipNet.Mask.Size(); ones < bits-1 && (ip.Equal(ipNet.IP) || ip.Equal(broadcast(ipNet))) {
+			c.errorf(n.ip, "node %s: %s is the network or broadcast address of its subnet", n.Name, ipv4)
+			continue
+		}
+		if o, ok := used[ip.String()]; ok {
+			if o.path != nil {
+				c.errorf(n.ip, "node %s: address %s is already used by node %s at %s", n.Name, ip, o.name, c.position(o.path))
+			} else {
+				c.errorf(n.ip, "node %s: address %s is already used by running node %s", n.Name, ip, o.name)
+			}
+			continue
+		}
+		used[ip.String()] = owner{name: n.Name, path: n.ip}
+
+		// overlapping subnets must agree on the prefix length
+		conflict := false
+		for _, s := range subnets {
+			if s.String() == ipNet.String() {
+				conflict = true
+				break
+			}
+			if s.Contains(ipNet.IP) || ipNet.Contains(s.IP) {
+				c.errorf(n.ip, "node %s: subnet %s overlaps subnet %s of node %s with a different prefix length", n.Name, ipNet, s, subnetOwner[s.String()])
+				conflict = true
+				break
+			}
+		}
+		if !conflict {
+			subnets = append(subnets, ipNet)
+			subnetOwner[ipNet.String()] = n.Name
+		}
+	}
+
+	if auto > 0 && len(subnets) > 0 {
+		c.warnf(nil, "%d node(s) get automatic addresses in %s while others use %s, they cannot reach each other without routes", auto, c.opts.IPPool, subnets[0])
+	}
+	if len(subnets) > 1 {
+		names := make([]string, len(subnets))
+		for i, s := range subnets {
+			names[i] = s.String()
+		}
+		c.warnf(nil, "nodes are spread over subnets %s on one bridge, they cannot reach each other without routes", strings.Join(names, ", "))
+	}
+}
+
+func broadcast(n *net.IPNet) net.IP {
+	ip := make(net.IP, len(n.IP))
+	for i := range n.IP {
+		ip[i] = n.IP[i] | ^n.Mask[i]
+	}
+	return ip
+}
+
+// checkLinks reports dangling endpoints, links defined twice and
+// properties the kernel would reject
+func (c *checker) checkLinks(links []linkSpec, known map[string]bool) {
+	defined := make(map[[2]string][]interface{}, 2*len(links))
+	for _, l := range links {
+		valid := true
+		for _, end := range []struct{ field, name string }{{"srcNode", l.SrcNode}, {"dstNode", l.DstNode}} {
+			path := append(append([]interface{}{}, l.path...), end.field)
+			if end.name == "" {
+				c.errorf(l.path, "link without %s", end.field)
+				valid = false
+			} else if !known[end.name] {
+				c.errorf(path, "link refers to unknown node %q", end.name)
+				valid = false
+			}
+		}
+		if valid && l.SrcNode == l.DstNode {
+			c.errorf(l.path, "link connects node %s to itself", l.SrcNode)
+			valid = false
+		}
+		if !l.generated {
+			c.checkProperties(l.Properties, append(append([]interface{}{}, l.path...), "properties"))
+		}
+		if !valid {
+			continue
+		}
+
+		dirs := [][2]string{{l.SrcNode, l.DstNode}}
+		if !l.UniDirectional {
+			dirs = append(dirs, [2]string{l.DstNode, l.SrcNode})
+		}
+		for _, dir := range dirs {
+			if first, ok := defined[dir]; ok {
+				c.errorf(l.path, "duplicate link %s -> %s, first defined at %s", dir[0], dir[1], c.position(first))
+				break
+			}
+			defined[dir] = l.path
+		}
+	}
+}
+
+func (c *checker) checkProperties(p api.LinkProperties, path []interface{}) {
+	at := func(field string) []interface{} {
+		return append(append([]interface{}{}, path...), field)
+	}
+	if p.Loss < 0 || p.Loss > 100 {
+		c.errorf(at("loss"), "loss %g is not a percentage between 0 and 100", p.Loss)
+	}
+	// netem takes the latency in us as uint32
+	if uint64(p.Latency)*1000 > math.MaxUint32 {
+		c.errorf(at("latency"), "latency %dms exceeds the netem limit of %dms", p.Latency, math.MaxUint32/1000)
+	}
+	if p.Rate > link.MaxRate {
+		c.errorf(at("rate"), "rate %dMbps exceeds the maximum of %dMbps", p.Rate, link.MaxRate)
+	}
+}
+
+func (c *checker) checkGenerator(g api.Generator, path []interface{}) {
+	c.checkProperties(g.Properties, append(append([]interface{}{}, path...), "properties"))
+	for tier, p := range g.Tiers {
+		c.checkProperties(p, append(append([]interface{}{}, path...), "tiers", tier))
+	}
+	if d := g.LatencyDistribution; d != nil {
+		at := append(append([]interface{}{}, path...), "latencyDistribution")
+		switch d.Type {
+		case "constant", "":
+		case "uniform":
+			if d.Min > d.Max {
+				c.errorf(at, "uniform distribution needs min <= max")
+			}
+		case "normal":
+			if d.Stddev < 0 {
+				c.errorf(at, "normal distribution needs stddev >= 0")
+			}
+		default:
+			c.errorf(at, "unknown distribution %q, expected constant, uniform or normal", d.Type)
+		}
+	}
+}
+
+// position formats the location of path for messages
+func (c *checker) position(path []interface{}) string {
+	if n := c.locate(path); n != nil {
+		return fmt.Sprintf("line %d", n.Line)
+	}
+	parts := make([]string, len(path))
+	for i, p := range path {
+		parts[i] = fmt.Sprint(p)
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,146 @@
+package validate
+
+import (
+	"Netlink/api"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var typeOfTopo = reflect.TypeOf(api.TopoConfig{})
+
+// walk compares the YAML tree with the Go type it is decoded into and
+// reports unknown fields and values of the wrong type where they appear
+func (c *checker) walk(n *yaml.Node, t reflect.Type, path string) {
+	if n.Kind == yaml.AliasNode && n.Alias != nil {
+		n = n.Alias
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if n.Kind == yaml.ScalarNode && n.Tag == "!!null" {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if n.Kind != yaml.MappingNode {
+			c.errorAt(n, "%s: expected a mapping", describe(path))
+			return
+		}
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			ft, ok := fields[key.Value]
+			if !ok {
+				msg := "unknown field %q in %s"
+				if guess := closest(key.Value, fields); guess != "" {
+					msg += ", did you mean %q?"
+					c.errorAt(key, msg, key.Value, describe(path), guess)
+				} else {
+					c.errorAt(key, msg, key.Value, describe(path))
+				}
+				continue
+			}
+			c.walk(value, ft, join(path, key.Value))
+		}
+	case reflect.Slice:
+		if n.Kind != yaml.SequenceNode {
+			c.errorAt(n, "%s: expected a list", describe(path))
+			return
+		}
+		for i, item := range n.Content {
+			c.walk(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+		}
+	case reflect.Map:
+		if n.Kind != yaml.MappingNode {
+			c.errorAt(n, "%s: expected a mapping", describe(path))
+			return
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			c.walk(n.Content[i+1], t.Elem(), join(path, n.Content[i].Value))
+		}
+	default:
+		if n.Kind != yaml.ScalarNode {
+			c.errorAt(n, "%s: expected a %s value", describe(path), t.Kind())
+			return
+		}
+		if err := n.Decode(reflect.New(t).Interface()); err != nil {
+			c.errorAt(n, "%s: cannot use %q as a %s value", describe(path), n.Value, t.Kind())
+		}
+	}
+}
+
+// yamlFields maps the YAML keys of a struct to the field types,
+// following the yaml.v3 rules: tag name, else the lowercased field name
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func describe(path string) string {
+	if path == "" {
+		return "topology"
+	}
+	return path
+}
+
+// closest returns the known field within edit distance 2 of key
+func closest(key string, fields map[string]reflect.Type) string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	best, bestDist := "", 3
+	for _, name := range names {
+		if d := distance(strings.ToLower(key), strings.ToLower(name)); d < bestDist {
+			best, bestDist = name, d
+		}
+	}
+	return best
+}
+
+// distance is the Levenshtein distance of a and b
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
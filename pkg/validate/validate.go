@@ -0,0 +1,166 @@
+// Package validate checks a topology before anything is created:
+// unknown or mistyped fields, duplicate nodes and links, dangling link
+// endpoints, conflicting addresses and out of range link properties.
+// Issues found in native YAML files carry file:line:column positions.
+package validate
+
+import (
+	"Netlink/api"
+	"Netlink/pkg/importer"
+	"bytes"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Issue is a single finding, warnings do not make a topology invalid
+type Issue struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+	Warning bool
+}
+
+func (i Issue) String() string {
+	var b strings.Builder
+	if i.File != "" {
+		b.WriteString(i.File)
+		b.WriteString(":")
+	}
+	if i.Line > 0 {
+		fmt.Fprintf(&b, "%d:", i.Line)
+	}
+	if i.Column > 0 {
+		fmt.Fprintf(&b, "%d:", i.Column)
+	}
+	if b.Len() > 0 {
+		b.WriteString(" ")
+	}
+	if i.Warning {
+		b.WriteString("warning: ")
+	}
+	b.WriteString(i.Message)
+	return b.String()
+}
+
+// Error is returned when a topology has at least one error
+type Error struct {
+	Issues []Issue
+}
+
+func (e *Error) Error() string {
+	lines := make([]string, 0, len(e.Issues)+1)
+	lines = append(lines, fmt.Sprintf("invalid topology, %d error(s):", len(e.Issues)))
+	for _, i := range e.Issues {
+		lines = append(lines, "  "+i.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Report collects the issues of one validation
+type Report struct {
+	Issues []Issue
+}
+
+// Err returns an *Error holding the errors of the report, nil if there are none
+func (r *Report) Err() error {
+	var errs []Issue
+	for _, i := range r.Issues {
+		if !i.Warning {
+			errs = append(errs, i)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return &Error{Issues: errs}
+}
+
+// Warnings returns the warnings of the report
+func (r *Report) Warnings() []Issue {
+	var warnings []Issue
+	for _, i := range r.Issues {
+		if i.Warning {
+			warnings = append(warnings, i)
+		}
+	}
+	return warnings
+}
+
+// Options describes the environment the topology is applied to
+type Options struct {
+	IPPool   string     // range reserved for automatic addresses, util.DefaultIPPool if empty
+	Existing []api.Node // running nodes, links may refer to them
+}
+
+// File validates a topology file, native YAML is decoded strictly and
+// reported with positions, other formats are imported first
+func File(path, format string, opts Options) (api.TopoConfig, *Report, error) {
+	if format == "" {
+		format = importer.DetectFormat(path)
+	}
+	if format != importer.FormatNative && format != "yaml" {
+		topo, err := importer.Load(path, format)
+		if err != nil {
+			return topo, nil, err
+		}
+		c := newChecker(path, nil, opts)
+		c.check(topo)
+		return topo, c.report, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return api.TopoConfig{}, nil, fmt.Errorf("error reading YAML file: %w", err)
+	}
+	topo, report := Bytes(data, path, opts)
+	return topo, report, nil
+}
+
+// Bytes validates a native YAML topology, file is only used in positions
+func Bytes(data []byte, file string, opts Options) (api.TopoConfig, *Report) {
+	var topo api.TopoConfig
+	var doc yaml.Node
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&doc); err != nil && err != io.EOF {
+		return topo, &Report{Issues: []Issue{syntaxIssue(file, err)}}
+	}
+
+	c := newChecker(file, &doc, opts)
+	if len(doc.Content) == 0 {
+		c.errorf(nil, "empty topology")
+		return topo, c.report
+	}
+	c.walk(doc.Content[0], typeOfTopo, "")
+	if len(c.report.Issues) > 0 {
+		return topo, c.report
+	}
+	if err := doc.Decode(&topo); err != nil {
+		c.errorf(nil, "%v", err)
+		return topo, c.report
+	}
+	c.check(topo)
+	return topo, c.report
+}
+
+// Topo validates an already decoded topology, issues carry no positions
+func Topo(topo api.TopoConfig, opts Options) *Report {
+	c := newChecker("", nil, opts)
+	c.check(topo)
+	return c.report
+}
+
+// syntaxIssue extracts the line from a yaml.v3 parser error ("yaml: line 3: ...")
+func syntaxIssue(file string, err error) Issue {
+	msg := strings.TrimPrefix(err.Error(), "yaml: ")
+	issue := Issue{File: file, Message: msg}
+	var line int
+	if n, _ := fmt.Sscanf(msg, "line %d:", &line); n == 1 {
+		issue.Line = line
+		issue.Message = strings.TrimSpace(msg[strings.Index(msg, ":")+1:])
+	}
+	return issue
+}
@@ -0,0 +1,260 @@
+package validate_test
+
+import (
+	"Netlink/api"
+	"Netlink/pkg/validate"
+	"strings"
+	"testing"
+)
+
+func TestBytes(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		opts validate.Options
+		want []string // issues as printed, errors and warnings
+	}{
+		{
+			name: "valid",
+			yaml: `
+nodes:
+  - name: node1
+  - name: node2
+links:
+  - srcNode: node1
+    dstNode: node2
+    properties:
+      latency: 10
+`,
+		},
+		{
+			name: "syntax",
+			yaml: "nodes:\n  - name: node1\n    image: a: b\n",
+			want: []string{"topo.yaml:3: mapping values are not allowed in this context"},
+		},
+		{
+			name: "empty",
+			yaml: "",
+			want: []string{"topo.yaml: empty topology"},
+		},
+		{
+			name: "unknown field with suggestion",
+			yaml: "nodes:\n  - name: node1\n    imgae: frr\n",
+			want: []string{`topo.yaml:3:5: unknown field "imgae" in nodes[0], did you mean "image"?`},
+		},
+		{
+			name: "unknown field",
+			yaml: "nodes:\n  - name: node1\nswitches: []\n",
+			want: []string{`topo.yaml:3:1: unknown field "switches" in topology`},
+		},
+		{
+			name: "wrong type",
+			yaml: "links:\n  - srcNode: a\n    dstNode: b\n    properties:\n      latency: fast\n",
+			want: []string{`topo.yaml:5:16: links[0].properties.latency: cannot use "fast" as a uint32 value`},
+		},
+		{
+			name: "list expected",
+			yaml: "nodes:\n  name: node1\n",
+			want: []string{"topo.yaml:2:3: nodes: expected a list"},
+		},
+		{
+			name: "duplicate node",
+			yaml: "nodes:\n  - name: node1\n  - name: node1\n",
+			want: []string{`topo.yaml:3:11: duplicate node "node1", first defined at line 2`},
+		},
+		{
+			name: "invalid node name",
+			yaml: "nodes:\n  - name: node/1\n  - name: averyveryverylongname\n  - image: frr\n",
+			want: []string{
+				`topo.yaml:2:11: node name "node/1" may only contain letters, digits, '_', '.' and '-'`,
+				`topo.yaml:3:11: node name "averyveryverylongname" is longer than 9 characters, its interface name would exceed the kernel limit`,
+				"topo.yaml:4:5: node without name",
+			},
+		},
+		{
+			name: "dangling and duplicate links",
+			yaml: `nodes:
+  - name: node1
+  - name: node2
+links:
+  - srcNode: node1
+    dstNode: node3
+  - srcNode: node1
+    dstNode: node2
+  - srcNode: node2
+    dstNode: node1
+  - srcNode: node1
+    dstNode: node1
+`,
+			want: []string{
+				`topo.yaml:6:14: link refers to unknown node "node3"`,
+				"topo.yaml:9:5: duplicate link node2 -> node1, first defined at line 7",
+				"topo.yaml:11:5: link connects node node1 to itself",
+			},
+		},
+		{
+			name: "property ranges",
+			yaml: `nodes:
+  - name: node1
+  - name: node2
+links:
+  - srcNode: node1
+    dstNode: node2
+    properties:
+      loss: 101
+      latency: 5000000
+      rate: 1000000000
+`,
+			want: []string{
+				"topo.yaml:8:13: loss 101 is not a percentage between 0 and 100",
+				"topo.yaml:9:16: latency 5000000ms exceeds the netem limit of 4294967ms",
+				"topo.yaml:10:13: rate 1000000000Mbps exceeds the maximum of 102400Mbps",
+			},
+		},
+		{
+			name: "pool address",
+			yaml: "nodes:\n  - name: node1\n    interface:\n      ipv4: 192.168.10.5/24\n",
+			want: []string{"topo.yaml:4:13: node node1: 192.168.10.5/24 lies in 192.168.10.0/24 which is reserved for automatic addresses"},
+		},
+		{
+			name: "other pool",
+			yaml: "nodes:\n  - name: node1\n    interface:\n      ipv4: 192.168.10.5/24\n",
+			opts: validate.Options{IPPool: "10.99.0.0/16"},
+		},
+		{
+			name: "addresses",
+			yaml: `nodes:
+  - name: node1
+    interface:
+      ipv4: 10.0.0.1
+  - name: node2
+    interface:
+      ipv4: 10.0.0.0/24
+  - name: node3
+    interface:
+      ipv4: 10.0.0.3/24
+  - name: node4
+    interface:
+      ipv4: 10.0.0.3/24
+  - name: node5
+    interface:
+      ipv4: 10.0.0.5/16
+  - name: node6
+    interface:
+      ipv4: 300.0.0.1/24
+`,
+			want: []string{
+				"topo.yaml:4:13: node node1: ipv4 address \"10.0.0.1\" needs a prefix length, e.g. 10.0.0.1/24",
+				"topo.yaml:7:13: node node2: 10.0.0.0/24 is the network or broadcast address of its subnet",
+				"topo.yaml:13:13: node node4: address 10.0.0.3 is already used by node node3 at line 10",
+				"topo.yaml:16:13: node node5: subnet 10.0.0.0/16 overlaps subnet 10.0.0.0/24 of node node3 with a different prefix length",
+				"topo.yaml:19:13: node node6: invalid ipv4 address \"300.0.0.1/24\"",
+			},
+		},
+		{
+			name: "running node address",
+			yaml: "nodes:\n  - name: node2\n    interface:\n      ipv4: 10.0.0.1/24\n",
+			opts: validate.Options{Existing: []api.Node{{Name: "node1", Interface: api.NodeInterface{Ipv4: "10.0.0.1/24"}}}},
+			want: []string{"topo.yaml:4:13: node node2: address 10.0.0.1 is already used by running node node1"},
+		},
+		{
+			name: "mixed subnets",
+			yaml: "nodes:\n  - name: node1\n    interface:\n      ipv4: 10.0.0.1/24\n  - name: node2\n",
+			want: []string{"topo.yaml: warning: 1 node(s) get automatic addresses in 192.168.10.0/24 while others use 10.0.0.0/24, they cannot reach each other without routes"},
+		},
+		{
+			name: "links to running nodes",
+			yaml: "links:\n  - srcNode: node1\n    dstNode: node2\n",
+			opts: validate.Options{Existing: []api.Node{{Name: "node1"}, {Name: "node2"}}},
+		},
+		{
+			name: "kinds",
+			yaml: `nodes:
+  - name: gw1
+    kind: nat
+  - name: ns1
+    kind: netns
+    image: frr
+  - name: vm1
+    kind: vm
+`,
+			want: []string{
+				"topo.yaml:2:5: node gw1: nat nodes need an uplink, the host interface to masquerade out of",
+				"topo.yaml:6:12: warning: node ns1: image is ignored by netns nodes",
+				`topo.yaml:8:11: node vm1: unknown kind "vm", expected container, netns, host or nat`,
+			},
+		},
+		{
+			name: "gateways",
+			yaml: `nodes:
+  - name: node1
+    gateway: node1
+  - name: node2
+    gateway: gw9
+  - name: node3
+    gateway: node1
+`,
+			want: []string{
+				"topo.yaml:3:14: node node1 is its own gateway",
+				`topo.yaml:5:14: node node2: gateway "gw9" is not a node`,
+				"topo.yaml:7:14: node node3 has no link to its gateway node1",
+			},
+		},
+		{
+			name: "routing",
+			yaml: "routing:\n  mode: dynamic\n  metric: cost\n",
+			want: []string{
+				`topo.yaml:2:9: unknown routing mode "dynamic", expected none or static`,
+				`topo.yaml:3:11: unknown routing metric "cost", expected latency or hops`,
+			},
+		},
+		{
+			name: "frr",
+			yaml: `nodes:
+  - name: node1
+    frr:
+      routerId: one
+      bgp:
+        asn: 65001
+        neighbors: [node2]
+  - name: node2
+`,
+			want: []string{
+				`topo.yaml:4:17: node node1: router id "one" is not an ipv4 address`,
+				"topo.yaml:7:21: node node1: bgp neighbor node2 does not run bgp",
+			},
+		},
+		{
+			name: "generator",
+			yaml: "generators:\n  - type: ring\n    nodes: 3\n    properties:\n      loss: -1\n",
+			want: []string{"topo.yaml:5:13: loss -1 is not a percentage between 0 and 100"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, report := validate.Bytes([]byte(tt.yaml), "topo.yaml", tt.opts)
+			var got []string
+			for _, issue := range report.Issues {
+				got = append(got, issue.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("issues\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestTopo(t *testing.T) {
+	// decoded topologies are reported without positions
+	topo := api.TopoConfig{
+		Nodes: []api.Node{{Name: "node1"}, {Name: "node1"}},
+		Links: []api.Link{{SrcNode: "node1", DstNode: "node2"}},
+	}
+	err := validate.Topo(topo, validate.Options{}).Err()
+	want := `invalid topology, 2 error(s):
+  duplicate node "node1", first defined at nodes.0
+  link refers to unknown node "node2"`
+	if err == nil || err.Error() != want {
+		t.Errorf("err = %v, want\n%s", err, want)
+	}
+}
@@ -0,0 +1,330 @@
+package pkg
+
+import (
+	"Netlink/api"
+	"Netlink/pkg/event"
+	"Netlink/pkg/link"
+	"Netlink/pkg/ovs"
+	"Netlink/pkg/routing"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// kinds of drift
+const (
+	DriftUnreachable   = "unreachable"
+	DriftMissingQdisc  = "missing qdisc"
+	DriftMissingClass  = "missing class"
+	DriftWrongRate     = "wrong rate"
+	DriftMissingNetem  = "missing netem"
+	DriftWrongNetem    = "wrong netem"
+	DriftMissingFilter = "missing filter"
+	DriftStaleClass    = "stale class"
+	DriftStaleFilter   = "stale filter"
+	DriftMissingGroup  = "missing group"
+	DriftWrongBuckets  = "wrong buckets"
+	DriftMissingFlow   = "missing flow"
+)
+
+// Drift is a difference between Nodes and the tc or OVS configuration
+// actually present, Peer is empty for drift of the node itself
+type Drift struct {
+	Node     string `json:"node"`
+	Peer     string `json:"peer,omitempty"`
+	Kind     string `json:"kind"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+	classid  uint32 // class of stale entries
+}
+
+func (d Drift) String() string {
+	s := d.Node
+	if d.Peer != "" {
+		s += " -> " + d.Peer
+	}
+	s += ": " + d.Kind
+	if d.Expected != "" || d.Actual != "" {
+		s += fmt.Sprintf(" (expected %s, found %s)", orNone(d.Expected), orNone(d.Actual))
+	}
+	return s
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+// Verify compares Nodes with the qdiscs, classes and filters in every node
+// namespace and the groups and flows on the bridge, ordered by node
+func (m *Manager) Verify(ctx context.Context) ([]Drift, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	groups, err := m.sw.DumpGroups()
+	if err != nil {
+		return nil, err
+	}
+	flows, err := m.sw.DumpFlows()
+	if err != nil {
+		return nil, err
+	}
+
+	var drifts []Drift
+	for _, n := range m.nodeList() {
+		if err := ctx.Err(); err != nil {
+			return drifts, err
+		}
+		drifts = append(drifts, verifyOvs(n, groups, flows)...)
+		tc, err := m.tc.ReadTc(n)
+		if err != nil {
+			drifts = append(drifts, Drift{Node: n.Name, Kind: DriftUnreachable, Actual: err.Error()})
+			continue
+		}
+		drifts = append(drifts, verifyTc(n, tc)...)
+	}
+	return drifts, nil
+}
+
+func verifyOvs(n api.Node, groups map[int][]string, flows map[string]int) []Drift {
+	var drifts []Drift
+	port := n.Name + ovs.VethOvsSideSuffix
+	if group, ok := flows[port]; !ok || group != n.Uid {
+		actual := ""
+		if ok {
+			actual = fmt.Sprintf("group:%d", group)
+		}
+		drifts = append(drifts, Drift{Node: n.Name, Kind: DriftMissingFlow, Expected: fmt.Sprintf("group:%d", n.Uid), Actual: actual})
+	}
+
+	expected := make([]string, 0, len(n.Rules))
+	for dst, props := range n.Rules {
+		if !routing.Down(props) {
+			expected = append(expected, dst+ovs.VethOvsSideSuffix)
+		}
+	}
+	sort.Strings(expected)
+	buckets, ok := groups[n.Uid]
+	if !ok {
+		return append(drifts, Drift{Node: n.Name, Kind: DriftMissingGroup, Expected: fmt.Sprintf("group %d", n.Uid)})
+	}
+	actual := append([]string{}, buckets...)
+	sort.Strings(actual)
+	if strings.Join(actual, ",") != strings.Join(expected, ",") {
+		drifts = append(drifts, Drift{Node: n.Name, Kind: DriftWrongBuckets, Expected: strings.Join(expected, ","), Actual: strings.Join(actual, ",")})
+	}
+	return drifts
+}
+
+func verifyTc(n api.Node, tc *link.TcState) []Drift {
+	if !tc.RootHtb {
+		return []Drift{{Node: n.Name, Kind: DriftMissingQdisc, Expected: "htb 1: root"}}
+	}
+
+	var drifts []Drift
+	dsts := make([]string, 0, len(n.Rules))
+	for dst := range n.Rules {
+		dsts = append(dsts, dst)
+	}
+	sort.Strings(dsts)
+
+	expected := make(map[uint32]bool)
+	for _, dst := range dsts {
+		props := n.Rules[dst]
+		if props.HTBClassid == 0 {
+			continue
+		}
+		expected[props.HTBClassid] = true
+		classid := handle(props.HTBClassid)
+
+		if rate, ok := tc.Classes[props.HTBClassid]; !ok {
+			drifts = append(drifts, Drift{Node: n.Name, Peer: dst, Kind: DriftMissingClass, Expected: classid})
+		} else if !near(float64(rate), float64(link.ClassRate(props)), 0.01) {
+			drifts = append(drifts, Drift{Node: n.Name, Peer: dst, Kind: DriftWrongRate,
+				Expected: fmt.Sprintf("%dmbit", props.Rate), Actual: fmt.Sprintf("%dmbit", rate*8/1024/1024)})
+		}
+
+		netem, ok := tc.Netems[props.HTBClassid]
+		want := fmt.Sprintf("delay %dms loss %g%%", props.Latency, props.Loss)
+		switch {
+		case !ok && (props.Latency > 0 || props.Loss > 0):
+			drifts = append(drifts, Drift{Node: n.Name, Peer: dst, Kind: DriftMissingNetem, Expected: want})
+		case ok && (!near(float64(netem.Latency), float64(props.Latency)*1000, 0.01) || math.Abs(float64(netem.Loss-props.Loss)) > 0.01):
+			drifts = append(drifts, Drift{Node: n.Name, Peer: dst, Kind: DriftWrongNetem, Expected: want,
+				Actual: fmt.Sprintf("delay %gms loss %.2f%%", float64(netem.Latency)/1000, netem.Loss)})
+		}
+
+		found := false
+		for _, f := range tc.Filters {
+			if f.ClassId == props.HTBClassid && f.DstMac == props.DstMac {
+				found = true
+				break
+			}
+		}
+		if !found {
+			drifts = append(drifts, Drift{Node: n.Name, Peer: dst, Kind: DriftMissingFilter,
+				Expected: fmt.Sprintf("dst %s flowid %s", props.DstMac, classid)})
+		}
+	}
+
+	stale := make(map[uint32]bool)
+	for _, f := range tc.Filters {
+		if !expected[f.ClassId] && !stale[f.ClassId] {
+			stale[f.ClassId] = true
+			drifts = append(drifts, Drift{Node: n.Name, Kind: DriftStaleFilter, Actual: "flowid " + handle(f.ClassId), classid: f.ClassId})
+		}
+	}
+	classids := make([]uint32, 0, len(tc.Classes))
+	for classid := range tc.Classes {
+		classids = append(classids, classid)
+	}
+	sort.Slice(classids, func(i, j int) bool { return classids[i] < classids[j] })
+	for _, classid := range classids {
+		if !expected[classid] && !stale[classid] {
+			drifts = append(drifts, Drift{Node: n.Name, Kind: DriftStaleClass, Actual: handle(classid), classid: classid})
+		}
+	}
+	return drifts
+}
+
+// near reports whether actual is within the relative tolerance of expected,
+// the kernel rounds rates and delays to its clock
+func near(actual, expected, tolerance float64) bool {
+	return math.Abs(actual-expected) <= tolerance*expected+1
+}
+
+// Repair reinstalls what drifts report as missing or wrong and removes stale
+// classes and filters, it keeps going on failure and returns every error
+func (m *Manager) Repair(ctx context.Context, drifts []Drift) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	byNode := make(map[string][]Drift)
+	var names []string
+	for _, d := range drifts {
+		if _, ok := byNode[d.Node]; !ok {
+			names = append(names, d.Node)
+		}
+		byNode[d.Node] = append(byNode[d.Node], d)
+	}
+
+	var errs []error
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		n, ok := m.Nodes[name]
+		if !ok {
+			continue
+		}
+		start := time.Now()
+		err := m.repairNode(n, byNode[name])
+		m.emit(ctx, event.Event{Op: event.OpRepair, Node: name, Duration: event.Since(start)}, err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to repair node %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m *Manager) repairNode(n api.Node, drifts []Drift) error {
+	var errs []error
+	ovsDrift, rootDrift := false, false
+	peers := make(map[string]bool)
+	for _, d := range drifts {
+		switch d.Kind {
+		case DriftUnreachable:
+			errs = append(errs, fmt.Errorf("namespace unreachable: %s", d.Actual))
+		case DriftMissingGroup, DriftWrongBuckets, DriftMissingFlow:
+			ovsDrift = true
+		case DriftMissingQdisc:
+			rootDrift = true
+		case DriftStaleClass, DriftStaleFilter:
+			// removes the filters pointing to the class and the class
+			if err := m.tc.DeleteHtbClass(n, api.LinkProperties{HTBClassid: d.classid}); err != nil {
+				errs = append(errs, err)
+			}
+		default:
+			peers[d.Peer] = true
+		}
+	}
+
+	if ovsDrift {
+		port := n.Interface.OvsPort
+		if p, err := m.sw.PortId(n.Name + ovs.VethOvsSideSuffix); err == nil {
+			port = p
+		}
+		if err := m.sw.DeleteGroupTable(port, n.Uid); err != nil {
+			errs = append(errs, err)
+		}
+		if err := m.sw.AddGroupTable(n.Name+ovs.VethOvsSideSuffix, n.Uid); err != nil {
+			errs = append(errs, err)
+		} else if err = m.applyLink(n); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// classes cannot exist without the root qdisc, reinstall all of them
+	if rootDrift {
+		if err := m.tc.CreateRootQdisc(n); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		for dst, props := range n.Rules {
+			if props.HTBClassid != 0 {
+				peers[dst] = true
+			}
+		}
+	}
+	for dst := range peers {
+		props := n.Rules[dst]
+		if err := m.tc.DeleteHtbClass(n, props); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := m.tc.AddHtbClass(n, props); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WriteDrifts prints drifts as a table or json
+func WriteDrifts(w io.Writer, format string, drifts []Drift) error {
+	switch format {
+	case "json":
+		if drifts == nil {
+			drifts = []Drift{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(drifts)
+	case "table", "":
+		if len(drifts) == 0 {
+			_, err := fmt.Fprintln(w, "No drift found.")
+			return err
+		}
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "NODE\tPEER\tKIND\tEXPECTED\tACTUAL")
+		for _, d := range drifts {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", d.Node, d.Peer, d.Kind, d.Expected, d.Actual)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q, expected table or json", format)
+	}
+}
+
+// handle formats a tc handle as major:minor
+func handle(h uint32) string {
+	if h&0xffff == 0 {
+		return fmt.Sprintf("%x:", h>>16)
+	}
+	return fmt.Sprintf("%x:%x", h>>16, h&0xffff)
+}
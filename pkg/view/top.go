@@ -0,0 +1,167 @@
+package view
+
+import (
+	"Netlink/api"
+	"Netlink/pkg"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// links running at this share of their configured rate are at their cap
+const capThreshold = 0.95
+
+// sort keys of the top view
+const (
+	SortUtilization = "util"
+	SortThroughput  = "throughput"
+	SortDrops       = "drops"
+	SortBacklog     = "backlog"
+	SortName        = "name"
+)
+
+// TopRow is the activity of one link direction between two snapshots
+type TopRow struct {
+	Src         string
+	Dst         string
+	Properties  api.LinkProperties
+	Shaped      bool
+	Throughput  float64 // bits/s
+	Utilization float64 // share of the configured rate, 0 if unshaped
+	Drops       float64 // packets/s dropped by the class and netem
+	Backlog     uint64  // bytes queued in the class and netem
+}
+
+// AtCap reports whether the link runs at its configured rate
+func (r TopRow) AtCap() bool {
+	return r.Shaped && r.Utilization >= capThreshold
+}
+
+// TopRows computes the rates of every link in cur from the counters in prev,
+// links missing in prev (new or replaced) show no rate yet
+func TopRows(prev, cur *pkg.Stats) []TopRow {
+	before := make(map[[2]string]pkg.LinkStats)
+	if prev != nil {
+		for _, l := range prev.Links {
+			before[[2]string{l.Src, l.Dst}] = l
+		}
+	}
+	dt := 0.0
+	if prev != nil {
+		dt = cur.Time.Sub(prev.Time).Seconds()
+	}
+
+	rows := make([]TopRow, 0, len(cur.Links))
+	for _, l := range cur.Links {
+		row := TopRow{
+			Src:        l.Src,
+			Dst:        l.Dst,
+			Properties: l.Properties,
+			Shaped:     l.Shaped,
+			Backlog:    l.Class.Backlog + l.Netem.Backlog,
+		}
+		p, ok := before[[2]string{l.Src, l.Dst}]
+		if ok && dt > 0 && l.Shaped && p.Shaped {
+			row.Throughput = float64(delta(p.Class.Bytes, l.Class.Bytes)) * 8 / dt
+			row.Drops = float64(delta(p.Class.Drops, l.Class.Drops)+delta(p.Netem.Drops, l.Netem.Drops)) / dt
+			if l.Properties.Rate > 0 {
+				row.Utilization = row.Throughput / (float64(l.Properties.Rate) * 1024 * 1024)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// delta is the increase of a counter, a reset counter counts from 0
+func delta(prev, cur uint64) uint64 {
+	if cur < prev {
+		return cur
+	}
+	return cur - prev
+}
+
+// SortTopRows orders rows by the given key, highest first, names break ties
+func SortTopRows(rows []TopRow, by string) error {
+	var less func(a, b TopRow) bool
+	switch by {
+	case SortUtilization, "":
+		less = func(a, b TopRow) bool { return a.Utilization > b.Utilization }
+	case SortThroughput:
+		less = func(a, b TopRow) bool { return a.Throughput > b.Throughput }
+	case SortDrops:
+		less = func(a, b TopRow) bool { return a.Drops > b.Drops }
+	case SortBacklog:
+		less = func(a, b TopRow) bool { return a.Backlog > b.Backlog }
+	case SortName:
+		less = func(a, b TopRow) bool { return false }
+	default:
+		return fmt.Errorf("unknown sort key %q, expected util, throughput, drops, backlog or name", by)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if less(rows[i], rows[j]) {
+			return true
+		}
+		if less(rows[j], rows[i]) {
+			return false
+		}
+		if rows[i].Src != rows[j].Src {
+			return rows[i].Src < rows[j].Src
+		}
+		return rows[i].Dst < rows[j].Dst
+	})
+	return nil
+}
+
+// WriteTop prints one frame of the top view, links at their cap are
+// marked with '*' and highlighted when color is set
+func WriteTop(w io.Writer, rows []TopRow, color bool) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, " \tSRC\tDST\tTHROUGHPUT\tUTIL\tDROPS/s\tBACKLOG\tRATE(Mbps)\tLATENCY(ms)\tLOSS(%)")
+	for _, r := range rows {
+		mark, start, end := " ", "", ""
+		if color {
+			// same length as the highlight so the first column stays aligned
+			start, end = "\033[0;39m", "\033[0m"
+		}
+		if r.AtCap() {
+			mark = "*"
+			if color {
+				start = "\033[1;31m"
+			}
+		}
+		// unshaped links have no class to count their traffic
+		throughput, util, drops, rate := "-", "-", "-", "-"
+		if r.Shaped {
+			throughput = formatBits(r.Throughput)
+			util = fmt.Sprintf("%.0f%%", r.Utilization*100)
+			drops = fmt.Sprintf("%.1f", r.Drops)
+			rate = fmt.Sprintf("%d", r.Properties.Rate)
+		}
+		fmt.Fprintf(tw, "%s%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%.2f%s\n", start, mark, r.Src, r.Dst,
+			throughput, util, drops, formatBytes(r.Backlog), rate, r.Properties.Latency, r.Properties.Loss, end)
+	}
+	return tw.Flush()
+}
+
+func formatBits(bps float64) string {
+	units := []string{"bit/s", "Kbit/s", "Mbit/s", "Gbit/s"}
+	i := 0
+	for bps >= 1000 && i < len(units)-1 {
+		bps /= 1000
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", bps, units[i])
+}
+
+func formatBytes(b uint64) string {
+	switch {
+	case b >= 1<<20:
+		return fmt.Sprintf("%.1fMiB", float64(b)/(1<<20))
+	case b >= 1<<10:
+		return fmt.Sprintf("%.1fKiB", float64(b)/(1<<10))
+	default:
+		return fmt.Sprintf("%dB", b)
+	}
+}
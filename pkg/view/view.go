@@ -0,0 +1,390 @@
+// Package view renders nodes and links for the show command
+// as tables, JSON or re-appliable YAML.
+package view
+
+import (
+	"Netlink/api"
+	"Netlink/pkg/export"
+	"Netlink/pkg/util"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	FormatTable = "table"
+	FormatWide  = "wide"
+	FormatJSON  = "json"
+	FormatYAML  = "yaml"
+)
+
+// NodeView is the externally visible state of a node
+type NodeView struct {
+	Name        string            `json:"name"`
+	Uid         int               `json:"uid"`
+	Image       string            `json:"image"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	ContainerID string            `json:"containerId"`
+	Pid         int               `json:"pid"`
+	NetNs       string            `json:"netns"`
+	Interface   string            `json:"interface"`
+	Ipv4        string            `json:"ipv4"`
+	Mac         string            `json:"mac"`
+	OvsPort     int               `json:"ovsPort"`
+	Peers       []string          `json:"peers"`
+}
+
+// LinkView is the state of one direction of a link
+type LinkView struct {
+	Src         string  `json:"src"`
+	Dst         string  `json:"dst"`
+	Rate        uint64  `json:"rate"`    // in mbps
+	Latency     uint32  `json:"latency"` // in ms
+	Loss        float32 `json:"loss"`    // in percentage
+	DstIP       string  `json:"dstIp"`
+	Classid     string  `json:"classid"`
+	NetemHandle string  `json:"netemHandle"`
+}
+
+// RouteView is one route of the static routing mode
+type RouteView struct {
+	Node    string `json:"node" yaml:"node"`
+	Dst     string `json:"dst" yaml:"dst"`
+	Via     string `json:"via" yaml:"via"`
+	Cost    uint64 `json:"cost" yaml:"cost"` // ms or hops by the metric
+	DstIP   string `json:"dstIp" yaml:"dstIp"`
+	ViaIP   string `json:"viaIp" yaml:"viaIp"`
+	Classid string `json:"classid" yaml:"classid"`
+}
+
+// Filter selects nodes by name glob and label equality, zero Filter matches everything
+type Filter struct {
+	Names  []string
+	Labels map[string]string
+}
+
+// ParseSelector parses "k1=v1,k2=v2" into a label map
+func ParseSelector(selector string) (map[string]string, error) {
+	labels := make(map[string]string)
+	if selector == "" {
+		return labels, nil
+	}
+	for _, term := range strings.Split(selector, ",") {
+		k, v, ok := strings.Cut(term, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid label selector %q, expected key=value", term)
+		}
+		labels[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return labels, nil
+}
+
+// MatchNode reports whether n matches one of the name globs and all labels
+func (f Filter) MatchNode(n api.Node) bool {
+	if len(f.Names) > 0 {
+		matched := false
+		for _, pattern := range f.Names {
+			if ok, _ := path.Match(pattern, n.Name); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for k, v := range f.Labels {
+		if n.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterNodes keeps the nodes matching f
+func FilterNodes(nodes []api.Node, f Filter) []api.Node {
+	var res []api.Node
+	for _, n := range nodes {
+		if f.MatchNode(n) {
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+// FilterLinks keeps the links with at least one endpoint in nodes
+func FilterLinks(links []api.Link, nodes []api.Node) []api.Link {
+	names := make(map[string]bool, len(nodes))
+	for _, n := range nodes {
+		names[n.Name] = true
+	}
+	var res []api.Link
+	for _, l := range links {
+		if names[l.SrcNode] || names[l.DstNode] {
+			res = append(res, l)
+		}
+	}
+	return res
+}
+
+// Handle formats a tc handle as major:minor
+func Handle(h uint32) string {
+	if h == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%x:%x", h>>16, h&0xffff)
+}
+
+func NewNodeView(n api.Node) NodeView {
+	peers := make([]string, 0, len(n.Rules))
+	for dst := range n.Rules {
+		peers = append(peers, dst)
+	}
+	sort.Strings(peers)
+	return NodeView{
+		Name:        n.Name,
+		Uid:         n.Uid,
+		Image:       n.Image,
+		Labels:      n.Labels,
+		ContainerID: n.ContainerID,
+		Pid:         n.Pid,
+		NetNs:       n.NetNs,
+		Interface:   n.Interface.Name,
+		Ipv4:        n.Interface.Ipv4,
+		Mac:         n.Interface.Mac,
+		OvsPort:     n.Interface.OvsPort,
+		Peers:       peers,
+	}
+}
+
+func NewLinkView(l api.Link) LinkView {
+	return LinkView{
+		Src:         l.SrcNode,
+		Dst:         l.DstNode,
+		Rate:        l.Properties.Rate,
+		Latency:     l.Properties.Latency,
+		Loss:        l.Properties.Loss,
+		DstIP:       l.Properties.DstIP,
+		Classid:     Handle(l.Properties.HTBClassid),
+		NetemHandle: Handle(l.Properties.NetemHandleId),
+	}
+}
+
+// TopoConfig converts runtime state back into an appliable configuration,
+// the two directions of a link are merged when their properties are equal.
+// Addresses in ipPool (util.DefaultIPPool if empty) were assigned
+// automatically and are left out so they are assigned again.
+func TopoConfig(nodes []api.Node, links []api.Link, ipPool string) api.TopoConfig {
+	if ipPool == "" {
+		ipPool = util.DefaultIPPool
+	}
+	var cfg api.TopoConfig
+	for _, n := range nodes {
+		cfg.Nodes = append(cfg.Nodes, specNode(n, ipPool))
+	}
+
+	for _, e := range export.NewGraph(nil, links).Edges {
+		cfg.Links = append(cfg.Links, api.Link{
+			SrcNode:        e.Src,
+			DstNode:        e.Dst,
+			Properties:     specProperties(e.Properties),
+			UniDirectional: !e.Bidirectional,
+		})
+	}
+	return cfg
+}
+
+// specNode strips the fields assigned at runtime
+func specNode(n api.Node, ipPool string) api.Node {
+	spec := api.Node{
+		Name:            n.Name,
+		Kind:            n.Kind,
+		Image:           n.Image,
+		Labels:          n.Labels,
+		Command:         n.Command,
+		Uplink:          n.Uplink,
+		Gateway:         n.Gateway,
+		Frr:             n.Frr,
+		Entrypoint:      n.Entrypoint,
+		Env:             n.Env,
+		Binds:           n.Binds,
+		Workdir:         n.Workdir,
+		Cpus:            n.Cpus,
+		Memory:          n.Memory,
+		Sysctls:         n.Sysctls,
+		Capabilities:    n.Capabilities,
+		RestartPolicy:   n.RestartPolicy,
+		ImagePullPolicy: n.ImagePullPolicy,
+		ImageArchive:    n.ImageArchive,
+	}
+	if !util.InPool(n.Interface.Ipv4, ipPool) {
+		spec.Interface.Ipv4 = n.Interface.Ipv4
+	}
+	return spec
+}
+
+// specProperties strips the fields assigned at runtime
+func specProperties(p api.LinkProperties) api.LinkProperties {
+	return api.LinkProperties{Latency: p.Latency, Loss: p.Loss, Rate: p.Rate}
+}
+
+// WriteNodes prints nodes in the given format, see TopoConfig for ipPool
+func WriteNodes(w io.Writer, format string, nodes []api.Node, ipPool string) error {
+	switch format {
+	case FormatJSON:
+		views := make([]NodeView, 0, len(nodes))
+		for _, n := range nodes {
+			views = append(views, NewNodeView(n))
+		}
+		return writeJSON(w, views)
+	case FormatYAML:
+		return writeYAML(w, TopoConfig(nodes, nil, ipPool))
+	case FormatTable, FormatWide, "":
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		if format == FormatWide {
+			fmt.Fprintln(tw, "NAME\tUID\tIPV4\tIMAGE\tPEERS\tCONTAINER\tPID\tNETNS\tINTERFACE\tMAC\tOVSPORT\tLABELS")
+		} else {
+			fmt.Fprintln(tw, "NAME\tUID\tIPV4\tIMAGE\tPEERS")
+		}
+		for _, n := range nodes {
+			v := NewNodeView(n)
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s", v.Name, v.Uid, v.Ipv4, v.Image, strings.Join(v.Peers, ","))
+			if format == FormatWide {
+				fmt.Fprintf(tw, "\t%s\t%d\t%s\t%s\t%s\t%d\t%s", shortID(v.ContainerID), v.Pid, v.NetNs, v.Interface, v.Mac, v.OvsPort, formatLabels(v.Labels))
+			}
+			fmt.Fprintln(tw)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// WriteLinks prints links in the given format
+func WriteLinks(w io.Writer, format string, links []api.Link) error {
+	switch format {
+	case FormatJSON:
+		views := make([]LinkView, 0, len(links))
+		for _, l := range links {
+			views = append(views, NewLinkView(l))
+		}
+		return writeJSON(w, views)
+	case FormatYAML:
+		return writeYAML(w, TopoConfig(nil, links, ""))
+	case FormatTable, FormatWide, "":
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		if format == FormatWide {
+			fmt.Fprintln(tw, "SRC\tDST\tRATE(Mbps)\tLATENCY(ms)\tLOSS(%)\tDSTIP\tCLASSID\tNETEM")
+		} else {
+			fmt.Fprintln(tw, "SRC\tDST\tRATE(Mbps)\tLATENCY(ms)\tLOSS(%)")
+		}
+		for _, l := range links {
+			v := NewLinkView(l)
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%.2f", v.Src, v.Dst, v.Rate, v.Latency, v.Loss)
+			if format == FormatWide {
+				fmt.Fprintf(tw, "\t%s\t%s\t%s", v.DstIP, v.Classid, v.NetemHandle)
+			}
+			fmt.Fprintln(tw)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// WriteRoutes prints the routes of the nodes, by node and destination
+func WriteRoutes(w io.Writer, format string, nodes []api.Node) error {
+	views := make([]RouteView, 0)
+	for _, n := range nodes {
+		for _, r := range n.Routes {
+			views = append(views, RouteView{Node: n.Name, Dst: r.Dst, Via: r.Via, Cost: r.Cost,
+				DstIP: r.DstIP, ViaIP: r.ViaIP, Classid: Handle(r.HTBClassid)})
+		}
+	}
+	switch format {
+	case FormatJSON:
+		return writeJSON(w, views)
+	case FormatYAML:
+		return writeYAML(w, views)
+	case FormatTable, FormatWide, "":
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		if format == FormatWide {
+			fmt.Fprintln(tw, "NODE\tDST\tVIA\tCOST\tDSTIP\tVIAIP\tCLASSID")
+		} else {
+			fmt.Fprintln(tw, "NODE\tDST\tVIA\tCOST")
+		}
+		for _, v := range views {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d", v.Node, v.Dst, v.Via, v.Cost)
+			if format == FormatWide {
+				fmt.Fprintf(tw, "\t%s\t%s\t%s", v.DstIP, v.ViaIP, v.Classid)
+			}
+			fmt.Fprintln(tw)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// WriteTopology prints nodes and links together, table formats print one section each
+func WriteTopology(w io.Writer, format string, nodes []api.Node, links []api.Link, ipPool string) error {
+	switch format {
+	case FormatJSON:
+		type topology struct {
+			Nodes []NodeView `json:"nodes"`
+			Links []LinkView `json:"links"`
+		}
+		topo := topology{Nodes: []NodeView{}, Links: []LinkView{}}
+		for _, n := range nodes {
+			topo.Nodes = append(topo.Nodes, NewNodeView(n))
+		}
+		for _, l := range links {
+			topo.Links = append(topo.Links, NewLinkView(l))
+		}
+		return writeJSON(w, topo)
+	case FormatYAML:
+		return writeYAML(w, TopoConfig(nodes, links, ipPool))
+	default:
+		if err := WriteNodes(w, format, nodes, ipPool); err != nil {
+			return err
+		}
+		fmt.Fprintln(w)
+		return WriteLinks(w, format, links)
+	}
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeYAML(w io.Writer, v interface{}) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+func formatLabels(labels map[string]string) string {
+	terms := make([]string, 0, len(labels))
+	for k, v := range labels {
+		terms = append(terms, k+"="+v)
+	}
+	sort.Strings(terms)
+	return strings.Join(terms, ",")
+}